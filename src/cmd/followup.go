@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"fmt"
+
+	"baomihua/executor"
+	"baomihua/llm"
+	"baomihua/ui"
+)
+
+// fixPrompt builds the follow-up request sent when the user asks bmh to fix a failed
+// command, carrying over the original request, the exit code and the tail of stderr
+func fixPrompt(request string, run *executor.Execution) string {
+	stderr := llm.FormatOutputTail(run.Stderr)
+	if ui.IsChinese(request) {
+		return fmt.Sprintf("我的需求是: %s\n我运行的命令 `%s` 失败了，退出码是 %d，标准错误输出如下:\n%s\n请判断原因，并给我一个修复后的正确命令。",
+			request, run.Command, run.ExitCode, stderr)
+	}
+	return fmt.Sprintf("My request was: %s\nThe command `%s` failed with exit code %d. Its stderr was:\n%s\nFigure out why it failed and give me a corrected command.",
+		request, run.Command, run.ExitCode, stderr)
+}
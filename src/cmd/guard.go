@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"baomihua/config"
+	"baomihua/guard"
+	"baomihua/llm"
+
+	"github.com/spf13/cobra"
+)
+
+// guardCmd groups the commands that inspect the safety guard
+var guardCmd = &cobra.Command{
+	Use:   "guard",
+	Short: "Inspect the safety guard and its policy",
+	Args:  promptOr(cobra.NoArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// guardRulesCmd prints the merged policy that applies in the current directory
+var guardRulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "List the effective guard policy rules and where each comes from",
+	Long: `Lists the allow, deny and warn rules merged from /etc/baomihua/guard.yaml, ~/.baomihua/guard.yaml and the .baomihua/guard.yaml of the current repository.
+
+A deny from any file wins. Otherwise the matching allow or warn rule from the most specific file decides (repo over user over system). An allow never lowers a command the built-in rules block. The allows of a repository file can neither override the warns of the other files nor lower a command the built-in rules rate dangerous.
+
+Also lists the opt-in rule packs (git, k8s, terraform, docker, sql, cloud) turned on by guard.packs in the config or packs: in a policy file.`,
+	Args: promptOr(cobra.NoArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		cwd, _ := os.Getwd()
+		policy, err := guard.LoadPolicy(cwd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ %v\n", err)
+		}
+
+		if packs := guard.EnabledPacks(); len(packs) > 0 {
+			fmt.Printf("🧩 Rule packs: %s\n\n", strings.Join(packs, ", "))
+		} else {
+			fmt.Printf("🧩 No rule packs turned on (available: %s).\n\n", strings.Join(guard.Packs, ", "))
+		}
+
+		if len(policy.Files) == 0 {
+			fmt.Println("🛡️ No guard policy files found, only the built-in rules apply.")
+			fmt.Println("   Looked for /etc/baomihua/guard.yaml, ~/.baomihua/guard.yaml and .baomihua/guard.yaml in the repository.")
+			return
+		}
+
+		fmt.Println("🛡️ Guard policy files (least specific first):")
+		for _, f := range policy.Files {
+			fmt.Printf("   %s\n", f)
+		}
+		fmt.Println()
+
+		if len(policy.Rules) == 0 {
+			fmt.Println("No rules defined.")
+			return
+		}
+		// Deny rules win wherever they come from, so they are listed first
+		rules := append([]guard.Rule(nil), policy.Rules...)
+		sort.SliceStable(rules, func(i, j int) bool {
+			return (rules[i].Action == "deny") && (rules[j].Action != "deny")
+		})
+		for _, r := range rules {
+			fmt.Printf("%-5s  %-24s  %s\n", r.Action, r.ID, describeMatch(r))
+			if cond := describeCondition(r); cond != "" {
+				fmt.Printf("       %-24s  %s\n", "", cond)
+			}
+			if r.Reason != "" {
+				fmt.Printf("       %-24s  %s\n", "", r.Reason)
+			}
+			fmt.Printf("       %-24s  from %s (%s)\n", "", r.Source, r.File)
+		}
+	},
+}
+
+func init() {
+	guardCmd.AddCommand(guardRulesCmd)
+	rootCmd.AddCommand(guardCmd)
+}
+
+func describeMatch(r guard.Rule) string {
+	var parts []string
+	if r.Match != "" {
+		parts = append(parts, fmt.Sprintf("match %q", r.Match))
+	}
+	if r.Regex != "" {
+		parts = append(parts, fmt.Sprintf("regex %q", r.Regex))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeCondition(r guard.Rule) string {
+	var parts []string
+	if r.When != nil {
+		parts = append(parts, "when "+conditionString(r.When))
+	}
+	if r.Unless != nil {
+		parts = append(parts, "unless "+conditionString(r.Unless))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func conditionString(c *guard.Condition) string {
+	var parts []string
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("$%s=%s", name, c.Env[name]))
+	}
+	if c.KubeContext != "" {
+		parts = append(parts, "kube-context="+c.KubeContext)
+	}
+	if c.GitBranch != "" {
+		parts = append(parts, "git-branch="+c.GitBranch)
+	}
+	return strings.Join(parts, " ")
+}
+
+// setupGuard selects the guard rules for the user's shell, turns on the rule
+// packs of guard.packs and makes the policy files of the current directory
+// apply to every check. A broken policy file is reported but doesn't stop bmh.
+func setupGuard() {
+	guard.SetShell(llm.ShellKind(llm.DetectShell()))
+	if err := guard.SetPacks(config.Cfg.Guard.Packs); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ Skipping guard rule packs: %v\n", err)
+	}
+
+	cwd, _ := os.Getwd()
+	guard.SetWorkDir(cwd)
+	policy, err := guard.LoadPolicy(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ Skipping guard policy: %v\n", err)
+	}
+	guard.SetPolicy(policy)
+}
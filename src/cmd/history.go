@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"baomihua/config"
+	"baomihua/executor"
+	"baomihua/guard"
+	"baomihua/history"
+	"baomihua/llm"
+	"baomihua/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var historyQuery string
+
+// historyCmd browses the commands bmh generated before
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Search previously generated commands and insert, copy or re-run them",
+	Long: `Fuzzy searches ~/.baomihua/history.jsonl by prompt and command. The picked command can be inserted into the prompt, copied, or run again; a re-run happens in the directory the command was generated in, if it still exists, and the safety guard checks it again there first.
+
+Words after history make a prompt like any other ("bmh history of my commands"), a search is started with --query.`,
+	Args: promptOr(cobra.NoArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := history.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to read the history: %v\n", err)
+			os.Exit(exitError)
+		}
+		if len(entries) == 0 {
+			fmt.Println("🕘 No history yet, generate a command with bmh \"...\" first.")
+			return
+		}
+
+		ctx := llm.GetEnvContext()
+		entry, action, exitStr, err := ui.RunHistoryUI(entries, historyQuery, ctx)
+		if err != nil {
+			fmt.Printf("❌ Fatal error: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Print(exitStr)
+
+		if action != ui.ActionExecute || entry == nil {
+			return
+		}
+
+		// The menu only offers a re-run for commands the guard lets through. It
+		// runs where it was generated, so relative paths mean the same again.
+		if dir := entry.Dir(); dir != "" && dir != ctx.CWD {
+			if err := os.Chdir(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Failed to change to %s: %v\n", dir, err)
+				os.Exit(exitError)
+			}
+			ctx.CWD = dir
+		}
+		fmt.Println()
+		os.Exit(executor.ExitCode(executor.ExecuteCommand(entry.Command(), ctx)))
+	},
+}
+
+func init() {
+	historyCmd.Flags().StringVarP(&historyQuery, "query", "q", "", "Start with this search")
+	rootCmd.AddCommand(historyCmd)
+}
+
+// recordHistory appends a generation to the history file along with the guard
+// verdict it was shown with. A history that can't be written must not get in
+// the way of the command, so errors are ignored.
+func recordHistory(prompt string, ctx llm.EnvContext, res *llm.Result, verdict guard.Verdict, action string, exitCode *int) {
+	if res == nil {
+		return
+	}
+	_ = history.Append(history.Entry{
+		Time:     time.Now(),
+		CWD:      ctx.CWD,
+		Prompt:   prompt,
+		Model:    config.GetModel(),
+		Result:   res,
+		Guard:    verdict.Level.String(),
+		Rule:     verdict.RuleID,
+		Action:   action,
+		ExitCode: exitCode,
+	})
+}
@@ -4,14 +4,22 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"baomihua/config"
 )
 
 // InitWrapper generates a shell wrapper script allowing bmh to inject commands
-// directly into the terminal prompt. Currently supports: zsh, bash, powershell.
+// directly into the terminal prompt. Currently supports: zsh, bash, fish, nu, powershell.
 // Add the following to your shell configuration file:
 // Zsh (~/.zshrc):   eval "$(bmh --init zsh)"
 // Bash (~/.bashrc): eval "$(bmh --init bash)"
+// Fish (~/.config/fish/conf.d/bmh.fish): bmh --init fish | source
+// Nushell ($nu.config-path): bmh --init nu | save -f ~/.baomihua/bmh.nu; source ~/.baomihua/bmh.nu
 // PowerShell ($PROFILE): Invoke-Expression (& bmh --init powershell | Out-String)
+// The zsh and bash wrappers also bind a hotkey (Ctrl-X Ctrl-B by default) that turns
+// the text typed on the prompt line into a command in place. With guard.preexec,
+// the zsh, bash and PowerShell wrappers also check every command line before it
+// runs, see preexecHooks.
 func InitWrapper(shell string) {
 	switch shell {
 	case "zsh":
@@ -21,7 +29,7 @@ function bmh() {
     if [[ "$*" == "fuck" ]]; then
         export BAOMIHUA_LAST_CMD=$(fc -ln -1 2>/dev/null || echo "")
     fi
-    BAOMIHUA_CMD_OUTPUT="$tmp_cmd_file" command bmh "$@"
+    BAOMIHUA_SHELL=zsh BAOMIHUA_CMD_OUTPUT="$tmp_cmd_file" command bmh "$@"
     
     if [[ "$*" == "fuck" ]]; then
         unset BAOMIHUA_LAST_CMD
@@ -35,6 +43,23 @@ function bmh() {
 }
 alias "??"="bmh"
 alias fuck="bmh fuck"
+
+# Hotkey widget (default Ctrl-X Ctrl-B, override with BMH_WIDGET_KEY): converts
+# whatever is typed on the prompt line into a command, in place.
+function _bmh_widget() {
+    [[ -z "$BUFFER" ]] && return
+    local tmp_cmd_file=$(mktemp)
+    zle -I
+    BAOMIHUA_SHELL=zsh BAOMIHUA_CMD_OUTPUT="$tmp_cmd_file" command bmh --inline -- "$BUFFER" </dev/tty >/dev/tty
+    if [[ -s "$tmp_cmd_file" ]]; then
+        BUFFER=$(<"$tmp_cmd_file")
+        CURSOR=${#BUFFER}
+    fi
+    rm -f "$tmp_cmd_file"
+    zle reset-prompt
+}
+zle -N _bmh_widget
+bindkey "${BMH_WIDGET_KEY:-^X^B}" _bmh_widget
 `)
 	case "bash":
 		fmt.Print(`
@@ -43,28 +68,83 @@ function bmh() {
     if [[ "$*" == "fuck" ]]; then
         export BAOMIHUA_LAST_CMD=$(fc -ln -1 2>/dev/null || echo "")
     fi
-    BAOMIHUA_CMD_OUTPUT="$tmp_cmd_file" command bmh "$@"
+    BAOMIHUA_SHELL=bash BAOMIHUA_CMD_OUTPUT="$tmp_cmd_file" command bmh "$@"
     
     if [[ "$*" == "fuck" ]]; then
         unset BAOMIHUA_LAST_CMD
     fi
     
     if [[ -s "$tmp_cmd_file" ]]; then
-        local injected_cmd=$(cat "$tmp_cmd_file")
-        bind '"\e[0n": "'"$injected_cmd"'"'
+        __bmh_injected_cmd=$(cat "$tmp_cmd_file")
         printf '\e[5n'
     fi
     rm -f "$tmp_cmd_file"
 }
 alias "??"=bmh
 alias fuck="bmh fuck"
+
+# A function can't edit the next prompt line directly. Instead the command is parked
+# in a variable and the terminal is asked for a status report (\e[5n); its reply
+# (\e[0n) arrives as input once readline is active and triggers this handler.
+function __bmh_inject() {
+    [[ -n "${__bmh_injected_cmd+x}" ]] || return
+    READLINE_LINE="$__bmh_injected_cmd"
+    READLINE_POINT=${#READLINE_LINE}
+    unset __bmh_injected_cmd
+}
+bind -x '"\e[0n": __bmh_inject'
+
+# Hotkey widget (default Ctrl-X Ctrl-B, override with BMH_WIDGET_KEY): converts
+# whatever is typed on the prompt line into a command, in place.
+function __bmh_widget() {
+    [[ -z "$READLINE_LINE" ]] && return
+    local tmp_cmd_file=$(mktemp)
+    BAOMIHUA_SHELL=bash BAOMIHUA_CMD_OUTPUT="$tmp_cmd_file" command bmh --inline -- "$READLINE_LINE" </dev/tty >/dev/tty
+    if [[ -s "$tmp_cmd_file" ]]; then
+        READLINE_LINE=$(cat "$tmp_cmd_file")
+        READLINE_POINT=${#READLINE_LINE}
+    fi
+    rm -f "$tmp_cmd_file"
+}
+bind -x "\"${BMH_WIDGET_KEY:-\C-x\C-b}\": __bmh_widget"
 `)
-	case "powershell":
-		exePath, err := os.Executable()
-		if err != nil {
-			exePath = "bmh.exe"
-		}
+	case "fish":
+		fmt.Print(`
+function bmh --description 'BaoMiHua terminal AI assistant'
+    # Capture these first: any command below would overwrite $status
+    set -l last_status $status
+    set -l last_cmd $history[1]
+    set -l tmp_cmd_file (mktemp)
+
+    if test "$argv" = "fuck"
+        env BAOMIHUA_SHELL=fish BAOMIHUA_CMD_OUTPUT=$tmp_cmd_file BAOMIHUA_LAST_CMD="$last_cmd" BAOMIHUA_LAST_STATUS=$last_status bmh $argv
+    else
+        env BAOMIHUA_SHELL=fish BAOMIHUA_CMD_OUTPUT=$tmp_cmd_file bmh $argv
+    end
 
+    if test -s $tmp_cmd_file
+        set -g __bmh_injected_cmd (cat $tmp_cmd_file | string collect)
+    end
+    rm -f $tmp_cmd_file
+end
+
+# The command line can't be edited while a command is still running,
+# so the generated command is injected when the next prompt is drawn.
+function __bmh_inject --on-event fish_prompt
+    if set -q __bmh_injected_cmd
+        commandline -r -- $__bmh_injected_cmd
+        set -e __bmh_injected_cmd
+    end
+end
+
+abbr --add -- "??" bmh
+function fuck --description 'Ask BaoMiHua to fix the previous command'
+    bmh fuck
+end
+`)
+	case "nu", "nushell":
+		fmt.Print(nuInitScript)
+	case "powershell":
 		script := `function bmh {
     param([parameter(ValueFromRemainingArguments=$true)] $Rest)
 
@@ -121,8 +201,180 @@ public class Keyboard {
 Set-Alias -Name "??" -Value "bmh"
 function fuck { bmh fuck }
 `
-		fmt.Print(strings.Replace(script, "{{BMH_EXE}}", exePath, 1))
+		fmt.Print(strings.Replace(script, "{{BMH_EXE}}", bmhExecutable(), 1))
 	default:
-		fmt.Printf("Unsupported shell: %s. Supported shells are zsh, bash, powershell.\n", shell)
+		fmt.Printf("Unsupported shell: %s. Supported shells are zsh, bash, fish, nu, powershell.\n", shell)
+	}
+
+	if hook, ok := preexecHooks[shell]; ok && config.Cfg.Guard.Preexec {
+		fmt.Print(strings.ReplaceAll(hook, "{{BMH_EXE}}", bmhExecutable()))
 	}
 }
+
+// bmhExecutable is the path of the running bmh, for wrappers that can't rely on PATH
+func bmhExecutable() string {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "bmh.exe"
+	}
+	return exePath
+}
+
+// preexecHooks are the pre-exec guards of guard.preexec. They pass each command
+// line typed at the prompt to bmh guard check --hook, which takes a few
+// milliseconds, and ask before running one it rates dangerous or blocked.
+// Setting BMH_GUARD_PREEXEC=off turns them off for the session.
+var preexecHooks = map[string]string{
+	// preexec can't stop a command, so the zsh guard wraps accept-line instead,
+	// calling the widget it replaces, e.g. that of another plugin, to accept
+	"zsh": `
+# Pre-exec guard (guard.preexec): asks before running a dangerous command line.
+# Turn it off for this session with: export BMH_GUARD_PREEXEC=off
+zmodload zsh/zleparameter 2>/dev/null
+function _bmh_guard_accept_line() {
+    if [[ -n "${BUFFER//[[:space:]]/}" && "$BMH_GUARD_PREEXEC" != off ]]; then
+        local report answer
+        report=$(BAOMIHUA_SHELL=zsh command bmh guard check --hook --shell zsh <<<"$BUFFER" 2>&1)
+        if (( $? == 3 )); then
+            zle -I
+            print -r -- "$report" >/dev/tty
+            if ! read -q "answer?Run it anyway? [y/N] " </dev/tty; then
+                print >/dev/tty
+                return
+            fi
+            print >/dev/tty
+        fi
+    fi
+    if (( ${+widgets[_bmh_guard_orig_accept_line]} )); then
+        zle _bmh_guard_orig_accept_line -- "$@"
+    else
+        zle .accept-line
+    fi
+}
+if [[ "${widgets[accept-line]-}" != user:_bmh_guard_accept_line ]]; then
+    [[ "${widgets[accept-line]-}" == user:* ]] && zle -A accept-line _bmh_guard_orig_accept_line
+    zle -N accept-line _bmh_guard_accept_line
+fi
+`,
+	// With extdebug, a DEBUG trap that fails skips the command. The trap runs
+	// before every simple command, so PROMPT_COMMAND arms it for the first one
+	// of each command line, which is checked as a whole from the history. A
+	// DEBUG trap set before, e.g. by bash-preexec, starship or atuin, keeps
+	// running first, so it still sees the $_ and $? it expects.
+	"bash": `
+# Pre-exec guard (guard.preexec): asks before running a dangerous command line.
+# Turn it off for this session with: export BMH_GUARD_PREEXEC=off
+# It turns on extdebug for the whole session, which also makes functions and
+# subshells inherit the DEBUG and RETURN traps, fills BASH_ARGV and BASH_ARGC
+# and makes declare -F print where functions are defined.
+shopt -s extdebug
+__bmh_guard_state=
+function __bmh_guard_reset() { __bmh_guard_state=; }
+function __bmh_guard_arm() {
+    # The number the next command line gets if it goes into the history
+    __bmh_guard_histcmd=$HISTCMD
+    __bmh_guard_state=armed
+}
+function __bmh_guard_debug() {
+    # extdebug hands the trap down to functions, the guard's own included
+    [[ "$BASH_COMMAND" == __bmh_guard_* || "${FUNCNAME[1]-}" == __bmh_guard_* ]] && return 0
+    [[ -n "${COMP_LINE-}" || -n "${READLINE_LINE+x}" || -n "${__bmh_guard_busy-}" ]] && return 0
+    local line entry report answer __bmh_guard_busy=1
+    case "$__bmh_guard_state" in
+    skip) return 1 ;;
+    armed)
+        __bmh_guard_state=
+        [[ "$BMH_GUARD_PREEXEC" == off ]] && return 0
+        if [[ "$HISTCMD" == "$__bmh_guard_histcmd" ]]; then
+            entry=$(HISTTIMEFORMAT= builtin history 1)
+            [[ "$entry" =~ ^[[:space:]]*[0-9]+[*]?[[:space:]]+(.*)$ ]] || return 0
+            line="${BASH_REMATCH[1]}"
+        else
+            # Lines kept out of the history (HISTCONTROL) are checked command by command
+            __bmh_guard_state=each
+            line="$BASH_COMMAND"
+        fi
+        ;;
+    each) line="$BASH_COMMAND" ;;
+    *) return 0 ;;
+    esac
+
+    report=$(BAOMIHUA_SHELL=bash command bmh guard check --hook --shell bash <<<"$line" 2>&1)
+    (( $? == 3 )) || return 0
+    printf '%s\n' "$report" >&2
+    read -r -p "Run it anyway? [y/N] " answer </dev/tty
+    [[ "$answer" == [yY]* ]] && return 0
+    # Skip the rest of the line as well
+    __bmh_guard_state=skip
+    return 1
+}
+if [[ "$(declare -p PROMPT_COMMAND 2>/dev/null)" == "declare -a"* ]]; then
+    [[ " ${PROMPT_COMMAND[*]} " == *" __bmh_guard_arm "* ]] || PROMPT_COMMAND=(__bmh_guard_reset "${PROMPT_COMMAND[@]}" __bmh_guard_arm)
+elif [[ "$PROMPT_COMMAND" != *__bmh_guard_arm* ]]; then
+    PROMPT_COMMAND="__bmh_guard_reset${PROMPT_COMMAND:+; $PROMPT_COMMAND}; __bmh_guard_arm"
+fi
+if [[ "$(trap -p DEBUG)" != *__bmh_guard_debug* ]]; then
+    # trap -p quotes the command the way eval reads it back
+    eval "__bmh_guard_prev_trap=($(trap -p DEBUG))"
+    trap -- "${__bmh_guard_prev_trap[2]:+${__bmh_guard_prev_trap[2]}
+}__bmh_guard_debug" DEBUG
+    unset __bmh_guard_prev_trap
+fi
+`,
+	// PSReadLine runs this instead of AcceptLine when Enter is pressed
+	"powershell": `
+# Pre-exec guard (guard.preexec): asks before running a dangerous command line.
+# Turn it off for this session with: $env:BMH_GUARD_PREEXEC = "off"
+if (Get-Module PSReadLine) {
+    Set-PSReadLineKeyHandler -Key Enter -BriefDescription BmhGuardAcceptLine -ScriptBlock {
+        $line = $null
+        $cursor = $null
+        [Microsoft.PowerShell.PSConsoleReadLine]::GetBufferState([ref]$line, [ref]$cursor)
+        if ($env:BMH_GUARD_PREEXEC -ne "off" -and -not [string]::IsNullOrWhiteSpace($line)) {
+            $lastExitCode = $global:LASTEXITCODE
+            $report = $line | & "{{BMH_EXE}}" guard check --hook --shell powershell 2>&1 | Out-String
+            $flagged = $LASTEXITCODE -eq 3
+            $global:LASTEXITCODE = $lastExitCode
+            if ($flagged) {
+                Write-Host ""
+                Write-Host $report.TrimEnd() -ForegroundColor Yellow
+                if ((Read-Host "Run it anyway? [y/N]") -notmatch '^[yY]') {
+                    [Microsoft.PowerShell.PSConsoleReadLine]::InvokePrompt()
+                    return
+                }
+            }
+        }
+        [Microsoft.PowerShell.PSConsoleReadLine]::AcceptLine()
+    }
+}
+`,
+}
+
+// nuInitScript is the Nushell wrapper. Nushell can't evaluate generated code at
+// runtime, so it has to be saved to a file and sourced from config.nu.
+const nuInitScript = `
+# BaoMiHua wrapper for Nushell
+def --wrapped bmh [...rest] {
+    let tmp_cmd_file = (mktemp -t bmh.XXXXXX)
+    mut bmh_env = { BAOMIHUA_SHELL: "nu", BAOMIHUA_CMD_OUTPUT: $tmp_cmd_file }
+    if ($rest | str join " ") == "fuck" {
+        # The last history entry is this very invocation, so look one further back
+        $bmh_env = ($bmh_env | merge {
+            BAOMIHUA_LAST_CMD: (history | last 2 | get command | first | default "")
+            BAOMIHUA_LAST_STATUS: ($env.LAST_EXIT_CODE | into string)
+        })
+    }
+
+    with-env $bmh_env {
+        do --ignore-errors { ^bmh ...$rest }
+    }
+
+    let injected_cmd = (open --raw $tmp_cmd_file | str trim)
+    rm -f $tmp_cmd_file
+    if ($injected_cmd | is-not-empty) {
+        commandline edit --replace $injected_cmd
+    }
+}
+
+def fuck [] { bmh fuck }
+`
@@ -11,85 +11,295 @@ import (
 	"baomihua/llm"
 )
 
-// InstallWrapper automatically detects your shell and appends the 'bmh init' script
-// to your .zshrc, .bashrc, or PowerShell $PROFILE.
+// Delimiters of the managed block bmh owns inside shell profiles. Everything
+// between them is rewritten by 'bmh --install' and removed by 'bmh uninstall'.
+const (
+	blockBegin   = "# >>> bmh >>>"
+	blockEnd     = "# <<< bmh <<<"
+	legacyMarker = "# BaoMiHua Injection" // Single-line marker written by older versions
+)
+
+// shellProfile describes where the bmh wrapper lives for a given shell
+type shellProfile struct {
+	shell string
+	path  string
+	body  string // Lines placed inside the managed block
+	owned bool   // The whole file belongs to bmh and is deleted on uninstall
+}
+
+// InstallWrapper automatically detects your shell and writes the 'bmh init' script
+// to your .zshrc, .bashrc, PowerShell $PROFILE, Nushell config.nu, or fish conf.d directory.
+// Running it again rewrites the managed block in place, so upgrades never leave stale lines behind.
 func InstallWrapper() {
 	ctx := llm.GetEnvContext()
-	shell := ctx.Shell
 
-	var profilePath string
-	var initScript string
+	profile := profileFor(llm.ShellKind(ctx.Shell))
+	if profile == nil {
+		fmt.Printf("❌ Unsupported shell detected: %s. Please run 'bmh init' manually.\n", ctx.Shell)
+		return
+	}
+
+	if profile.shell == "nu" {
+		// config.nu can only source files that exist at parse time, so the wrapper
+		// itself is saved next to the bmh config and sourced from there.
+		scriptPath := nuScriptPath()
+		os.MkdirAll(filepath.Dir(scriptPath), 0755)
+		if err := os.WriteFile(scriptPath, []byte(nuInitScript), 0644); err != nil {
+			fmt.Printf("❌ Failed to write Nushell wrapper %s: %v\n", scriptPath, err)
+			return
+		}
+	}
 
-	// Normalizing shell name
-	if strings.Contains(strings.ToLower(shell), "powershell") || strings.Contains(strings.ToLower(shell), "pwsh") {
-		shell = "powershell"
+	// Ensure the directory exists (especially for PowerShell profile)
+	if dir := filepath.Dir(profile.path); dir != "" {
+		os.MkdirAll(dir, 0755)
+	}
 
-		// Find PowerShell Profile path
-		profileCmd := exec.Command("powershell", "-NoProfile", "-Command", "Write-Output (Join-Path (Split-Path $PROFILE.CurrentUserAllHosts -Parent) 'Microsoft.PowerShell_profile.ps1')")
-		var out bytes.Buffer
-		profileCmd.Stdout = &out
-		if err := profileCmd.Run(); err == nil && out.String() != "" {
-			profilePath = strings.TrimSpace(out.String())
+	data, err := os.ReadFile(profile.path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("❌ Failed to read profile file %s: %v\n", profile.path, err)
+		return
+	}
+
+	content := string(data)
+	updated := upsertManagedBlock(content, profile.body)
+	if updated == content {
+		fmt.Printf("✅ bmh is already installed in your %s profile (%s).\n", profile.shell, profile.path)
+		return
+	}
+
+	if err := os.WriteFile(profile.path, []byte(updated), 0644); err != nil {
+		fmt.Printf("❌ Failed to write to profile file %s: %v\n", profile.path, err)
+		return
+	}
+
+	if strings.Contains(content, blockBegin) || strings.Contains(content, legacyMarker) {
+		fmt.Printf("🔁 Updated the bmh wrapper in %s!\n", profile.path)
+	} else {
+		fmt.Printf("🎉 Successfully installed bmh wrapper to %s!\n", profile.path)
+	}
+	fmt.Printf("🔄 Please restart your terminal or run this command to apply changes immediately:\n")
+
+	if profile.shell == "powershell" {
+		fmt.Printf("   . \"%s\"\n", profile.path)
+	} else {
+		fmt.Printf("   source \"%s\"\n", profile.path)
+	}
+}
+
+// UninstallWrapper removes the managed block from every known shell profile.
+// With purge, the ~/.baomihua directory (config, model cache) is deleted as well.
+func UninstallWrapper(purge bool) {
+	removed := 0
+	for _, shell := range []string{"zsh", "bash", "fish", "nu", "powershell"} {
+		profile := profileFor(shell)
+		if profile == nil {
+			continue
+		}
+
+		data, err := os.ReadFile(profile.path)
+		if err != nil {
+			continue
+		}
+
+		content, ok := removeManagedBlock(string(data))
+		if !ok {
+			continue
+		}
+
+		if profile.owned && strings.TrimSpace(content) == "" {
+			err = os.Remove(profile.path)
 		} else {
-			// Fallback
-			homeDir, _ := os.UserHomeDir()
-			profilePath = filepath.Join(homeDir, "Documents", "WindowsPowerShell", "Microsoft.PowerShell_profile.ps1")
+			err = os.WriteFile(profile.path, []byte(content), 0644)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to clean up %s: %v\n", profile.path, err)
+			continue
 		}
+		fmt.Printf("🧹 Removed bmh wrapper from %s\n", profile.path)
+		removed++
+	}
+	os.Remove(nuScriptPath())
 
+	if removed == 0 {
+		fmt.Println("ℹ️  No bmh wrapper found in any known shell profile.")
+	}
+
+	if purge {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			fmt.Printf("❌ Failed to locate home directory: %v\n", err)
+			return
+		}
+		configDir := filepath.Join(homeDir, ".baomihua")
+		if err := os.RemoveAll(configDir); err != nil {
+			fmt.Printf("❌ Failed to delete %s: %v\n", configDir, err)
+			return
+		}
+		fmt.Printf("🗑️  Deleted %s\n", configDir)
+	}
+
+	fmt.Println("👋 bmh has been uninstalled. Restart your terminal to drop the wrapper from the current session.")
+}
+
+// profileFor returns the profile location and init lines for a normalized shell name,
+// or nil if the shell is not supported
+func profileFor(shell string) *shellProfile {
+	homeDir, _ := os.UserHomeDir()
+
+	switch shell {
+	case "powershell":
 		exePath, err := os.Executable()
 		if err != nil {
 			exePath = "bmh.exe"
 		}
-		initScript = fmt.Sprintf("\n# BaoMiHua Injection\nInvoke-Expression (& \"%s\" --init powershell | Out-String)\n", exePath)
+		return &shellProfile{
+			shell: shell,
+			path:  powershellProfilePath(),
+			body:  fmt.Sprintf("Invoke-Expression (& \"%s\" --init powershell | Out-String)", exePath),
+		}
 
-	} else if strings.Contains(strings.ToLower(shell), "zsh") {
-		shell = "zsh"
-		homeDir, _ := os.UserHomeDir()
-		profilePath = filepath.Join(homeDir, ".zshrc")
-		initScript = "\n# BaoMiHua Injection\neval \"$(bmh --init zsh)\"\n"
+	case "zsh":
+		return &shellProfile{shell: shell, path: filepath.Join(homeDir, ".zshrc"), body: `eval "$(bmh --init zsh)"`}
 
-	} else if strings.Contains(strings.ToLower(shell), "bash") {
-		shell = "bash"
-		homeDir, _ := os.UserHomeDir()
-		profilePath = filepath.Join(homeDir, ".bashrc")
-		initScript = "\n# BaoMiHua Injection\neval \"$(bmh --init bash)\"\n"
+	case "bash":
+		return &shellProfile{shell: shell, path: filepath.Join(homeDir, ".bashrc"), body: `eval "$(bmh --init bash)"`}
 
-	} else {
-		fmt.Printf("❌ Unsupported shell detected: %s. Please run 'bmh init' manually.\n", shell)
-		return
+	case "fish":
+		// Fish sources every file in conf.d, so bmh gets a file of its own
+		configDir := os.Getenv("XDG_CONFIG_HOME")
+		if configDir == "" {
+			configDir = filepath.Join(homeDir, ".config")
+		}
+		return &shellProfile{
+			shell: shell,
+			path:  filepath.Join(configDir, "fish", "conf.d", "bmh.fish"),
+			body:  "bmh --init fish | source",
+			owned: true,
+		}
+
+	case "nu":
+		return &shellProfile{shell: shell, path: nuConfigPath(), body: fmt.Sprintf("source '%s'", nuScriptPath())}
 	}
+	return nil
+}
 
-	// Ensure the directory exists (especially for PowerShell profile)
-	if dir := filepath.Dir(profilePath); dir != "" {
-		os.MkdirAll(dir, 0755)
+// powershellProfilePath asks PowerShell for the current user's profile path
+func powershellProfilePath() string {
+	profileCmd := exec.Command("powershell", "-NoProfile", "-Command", "Write-Output (Join-Path (Split-Path $PROFILE.CurrentUserAllHosts -Parent) 'Microsoft.PowerShell_profile.ps1')")
+	var out bytes.Buffer
+	profileCmd.Stdout = &out
+	if err := profileCmd.Run(); err == nil && out.String() != "" {
+		return strings.TrimSpace(out.String())
 	}
 
-	// Check if already installed
-	content, err := os.ReadFile(profilePath)
-	if err == nil && strings.Contains(string(content), "# BaoMiHua Injection") {
-		fmt.Printf("✅ bmh is already installed in your %s profile (%s).\n", shell, profilePath)
-		return
+	// Fallback
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Documents", "WindowsPowerShell", "Microsoft.PowerShell_profile.ps1")
+}
+
+// nuConfigPath asks Nushell for $nu.config-path, falling back to its default location
+func nuConfigPath() string {
+	var out bytes.Buffer
+	profileCmd := exec.Command("nu", "-c", "$nu.config-path")
+	profileCmd.Stdout = &out
+	if err := profileCmd.Run(); err == nil && strings.TrimSpace(out.String()) != "" {
+		return strings.TrimSpace(out.String())
 	}
 
-	// Append to profile
-	f, err := os.OpenFile(profilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	configDir, err := os.UserConfigDir()
 	if err != nil {
-		fmt.Printf("❌ Failed to open profile file %s: %v\n", profilePath, err)
-		return
+		homeDir, _ := os.UserHomeDir()
+		configDir = filepath.Join(homeDir, ".config")
 	}
-	defer f.Close()
+	return filepath.Join(configDir, "nushell", "config.nu")
+}
 
-	if _, err := f.WriteString(initScript); err != nil {
-		fmt.Printf("❌ Failed to write to profile file %s: %v\n", profilePath, err)
-		return
+func nuScriptPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".baomihua", "bmh.nu")
+}
+
+// managedBlock renders the delimited, versioned block written into shell profiles
+func managedBlock(body string) string {
+	return fmt.Sprintf("%s\n# Managed by bmh %s. Changes inside this block are overwritten by 'bmh --install'.\n%s\n%s\n",
+		blockBegin, Version, strings.TrimSpace(body), blockEnd)
+}
+
+// upsertManagedBlock replaces an existing managed block (or legacy injection) in content
+// with a fresh one, appending it if the profile doesn't contain one yet
+func upsertManagedBlock(content, body string) string {
+	block := managedBlock(body)
+
+	if start, end, ok := findManagedBlock(content); ok {
+		return content[:start] + block + content[end:]
 	}
 
-	fmt.Printf("🎉 Successfully installed bmh wrapper to %s!\n", profilePath)
-	fmt.Printf("🔄 Please restart your terminal or run this command to apply changes immediately:\n")
+	content, _ = removeLegacyInjection(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	return content + block
+}
 
-	if shell == "powershell" {
-		fmt.Printf("   . \"%s\"\n", profilePath)
-	} else {
-		fmt.Printf("   source \"%s\"\n", profilePath)
+// removeManagedBlock strips the managed block and any legacy injection from content.
+// The boolean reports whether anything was removed.
+func removeManagedBlock(content string) (string, bool) {
+	removed := false
+	for {
+		start, end, ok := findManagedBlock(content)
+		if !ok {
+			break
+		}
+		// Also drop the blank line that separated the block from the rest of the profile
+		if strings.HasSuffix(content[:start], "\n\n") {
+			start--
+		}
+		content = content[:start] + content[end:]
+		removed = true
+	}
+
+	content, legacy := removeLegacyInjection(content)
+	return content, removed || legacy
+}
+
+// findManagedBlock returns the byte range of the managed block including its trailing newline
+func findManagedBlock(content string) (int, int, bool) {
+	start := strings.Index(content, blockBegin)
+	if start < 0 {
+		return 0, 0, false
+	}
+	rel := strings.Index(content[start:], blockEnd)
+	if rel < 0 {
+		return 0, 0, false
+	}
+	end := start + rel + len(blockEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return start, end, true
+}
+
+// removeLegacyInjection drops the "# BaoMiHua Injection" marker written by older
+// versions together with the init line that followed it
+func removeLegacyInjection(content string) (string, bool) {
+	lines := strings.SplitAfter(content, "\n")
+	var kept []string
+	removed := false
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == legacyMarker {
+			removed = true
+			// Drop the blank separator line older versions wrote before the marker
+			if n := len(kept); n > 0 && strings.TrimSpace(kept[n-1]) == "" {
+				kept = kept[:n-1]
+			}
+			i++ // Skip the init line
+			continue
+		}
+		kept = append(kept, lines[i])
 	}
+	return strings.Join(kept, ""), removed
 }
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpsertManagedBlock(t *testing.T) {
+	original := "export PATH=$HOME/bin:$PATH\n"
+
+	installed := upsertManagedBlock(original, `eval "$(bmh --init zsh)"`)
+	if !strings.HasPrefix(installed, original) {
+		t.Fatalf("expected existing profile content to be kept, got:\n%s", installed)
+	}
+	if strings.Count(installed, blockBegin) != 1 || !strings.Contains(installed, `eval "$(bmh --init zsh)"`) {
+		t.Fatalf("expected a single managed block, got:\n%s", installed)
+	}
+
+	// Re-installing with the same body is a no-op
+	if again := upsertManagedBlock(installed, `eval "$(bmh --init zsh)"`); again != installed {
+		t.Errorf("expected re-install to be idempotent, got:\n%s", again)
+	}
+
+	// A changed wrapper invocation is rewritten in place
+	updated := upsertManagedBlock(installed+"alias ll='ls -l'\n", `eval "$(/opt/bmh --init zsh)"`)
+	if strings.Count(updated, blockBegin) != 1 || strings.Contains(updated, `eval "$(bmh --init zsh)"`) {
+		t.Errorf("expected the block to be replaced in place, got:\n%s", updated)
+	}
+	if !strings.HasSuffix(updated, "alias ll='ls -l'\n") {
+		t.Errorf("expected content after the block to be kept, got:\n%s", updated)
+	}
+}
+
+func TestUpsertManagedBlockMigratesLegacy(t *testing.T) {
+	legacy := "alias ll='ls -l'\n\n# BaoMiHua Injection\neval \"$(bmh --init bash)\"\n"
+
+	updated := upsertManagedBlock(legacy, `eval "$(bmh --init bash)"`)
+	if strings.Contains(updated, legacyMarker) {
+		t.Errorf("expected legacy injection to be removed, got:\n%s", updated)
+	}
+	if strings.Count(updated, "bmh --init bash") != 1 {
+		t.Errorf("expected exactly one init line, got:\n%s", updated)
+	}
+}
+
+func TestRemoveManagedBlock(t *testing.T) {
+	original := "alias ll='ls -l'\n"
+	installed := upsertManagedBlock(original, `eval "$(bmh --init zsh)"`)
+
+	removed, ok := removeManagedBlock(installed)
+	if !ok || removed != original {
+		t.Errorf("expected profile to be restored to %q, got %q (removed=%v)", original, removed, ok)
+	}
+
+	removed, ok = removeManagedBlock("# BaoMiHua Injection\neval \"$(bmh --init zsh)\"\n")
+	if !ok || removed != "" {
+		t.Errorf("expected legacy injection to be removed, got %q (removed=%v)", removed, ok)
+	}
+
+	if _, ok := removeManagedBlock(original); ok {
+		t.Errorf("expected nothing to be removed from a clean profile")
+	}
+}
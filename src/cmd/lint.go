@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"baomihua/guard"
+	"baomihua/llm"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkFormat string
+	checkFailOn string
+	checkShell  string
+	checkHook   bool
+)
+
+// hookBudget is how long the pre-exec hooks wait for a check. A check that
+// takes longer, e.g. counting files on a slow network drive, lets the command run.
+const hookBudget = 50 * time.Millisecond
+
+// failLevels are the thresholds of --fail-on
+var failLevels = map[string]guard.Level{
+	"caution": guard.Caution,
+	"danger":  guard.Danger,
+	"blocked": guard.Blocked,
+	"never":   guard.Blocked + 1,
+}
+
+// guardCheckCmd lints scripts with the safety guard, e.g. in code review or a
+// pre-commit hook
+var guardCheckCmd = &cobra.Command{
+	Use:   "check [file|-]...",
+	Short: "Check every command of shell scripts with the safety guard",
+	Long: `Splits each script into its commands, checks them with the safety guard and reports the line, column, level, rule and reason of every command that isn't safe. Reads stdin when no file or - is given.
+
+The rules follow the script: .ps1 files get the PowerShell rules, .bat and .cmd files the cmd.exe rules, and other files those of the shell in their #! line (also after env), or else of the current shell. --shell overrides this. Files whose #! line names another interpreter, such as python3, are skipped. Guard policy files and rule packs apply as they do to generated commands.
+
+Exits with 3 when a command is rated at or above --fail-on (danger by default), 1 when a file can't be read.
+
+--hook checks a command line typed at the prompt, read from stdin, as the pre-exec guard of bmh --init does: findings are printed without a file name and a check that takes longer than a few milliseconds lets the command run.`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		failOn, ok := failLevels[strings.ToLower(checkFailOn)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "❌ Error: --fail-on must be caution, danger, blocked or never, not %q\n", checkFailOn)
+			os.Exit(exitUsage)
+		}
+		if checkFormat != "text" && checkFormat != "json" && checkFormat != "sarif" {
+			fmt.Fprintf(os.Stderr, "❌ Error: --format must be text, json or sarif, not %q\n", checkFormat)
+			os.Exit(exitUsage)
+		}
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+		// A nil budget never runs out
+		var budget <-chan time.Time
+		if checkHook {
+			budget = time.After(hookBudget)
+		}
+
+		code := 0
+		var results []lintResult
+		for _, name := range args {
+			script, err := readScript(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Failed to read %s: %v\n", name, err)
+				code = exitError
+				continue
+			}
+			kind, ok := lintShell(name, script)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "⏭️ Skipping %s, its #! line isn't a shell\n", displayName(name))
+				continue
+			}
+			findings, ok := lintWithin(script, kind, budget)
+			if !ok {
+				// Taking too long mustn't hold up the command line
+				os.Exit(0)
+			}
+			for _, f := range findings {
+				r := lintResult{File: displayName(name), Finding: f}
+				if checkHook {
+					r.File = ""
+				}
+				results = append(results, r)
+				if f.Level >= failOn && code == 0 {
+					code = exitGuardBlocked
+				}
+			}
+		}
+
+		switch checkFormat {
+		case "json":
+			printLintJSON(results)
+		case "sarif":
+			printLintSARIF(results)
+		default:
+			printLintText(results)
+		}
+		os.Exit(code)
+	},
+}
+
+func init() {
+	guardCheckCmd.Flags().StringVarP(&checkFormat, "format", "f", "text", "Output format: text, json or sarif")
+	guardCheckCmd.Flags().StringVar(&checkFailOn, "fail-on", "danger", "Exit with 3 when a command is rated at least this: caution, danger, blocked or never")
+	guardCheckCmd.Flags().StringVar(&checkShell, "shell", "", "Check the scripts as this shell (bash, zsh, powershell, cmd, ...) instead of guessing")
+	guardCheckCmd.Flags().BoolVar(&checkHook, "hook", false, "Check a command line for the pre-exec guard of bmh --init, within a few milliseconds")
+	guardCmd.AddCommand(guardCheckCmd)
+}
+
+// lintResult is a finding in one of the checked files
+type lintResult struct {
+	File string
+	guard.Finding
+}
+
+func readScript(name string) (string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	return string(data), err
+}
+
+func displayName(name string) string {
+	if name == "-" {
+		return "stdin"
+	}
+	return filepath.ToSlash(name)
+}
+
+// lintWithin runs guard.Lint, giving up when budget runs out first
+func lintWithin(script, kind string, budget <-chan time.Time) ([]guard.Finding, bool) {
+	done := make(chan []guard.Finding, 1)
+	go func() {
+		done <- guard.Lint(script, kind)
+	}()
+	select {
+	case findings := <-done:
+		return findings, true
+	case <-budget:
+		return nil, false
+	}
+}
+
+// scriptShells are the kinds of shell a #! line may name for a script to be checked
+var scriptShells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "mksh": true, "ash": true,
+	"fish": true, "powershell": true,
+}
+
+// lintShell picks the kind of shell whose rules apply to a script: --shell,
+// else the extension, else the #! line, else the current shell. ok is false for
+// a script whose #! line names another interpreter, such as python3.
+func lintShell(name, script string) (kind string, ok bool) {
+	if checkShell != "" {
+		return llm.ShellKind(checkShell), true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ps1", ".psm1", ".psd1":
+		return "powershell", true
+	case ".bat", ".cmd":
+		return "cmd", true
+	case ".sh", ".bash", ".zsh", ".ksh":
+		return "sh", true
+	}
+	if line, _, _ := strings.Cut(script, "\n"); strings.HasPrefix(line, "#!") {
+		// #!/usr/bin/env bash, or #!/usr/bin/env -S bash -e
+		words := strings.Fields(line[2:])
+		if len(words) > 0 && path.Base(words[0]) == "env" {
+			words = words[1:]
+			for len(words) > 0 && (strings.HasPrefix(words[0], "-") || strings.Contains(words[0], "=")) {
+				if (words[0] == "-u" || words[0] == "-C") && len(words) > 1 {
+					words = words[1:]
+				}
+				words = words[1:]
+			}
+		}
+		if len(words) == 0 {
+			return "", false
+		}
+		kind = llm.ShellKind(words[0])
+		return kind, scriptShells[kind]
+	}
+	return llm.ShellKind(llm.DetectShell()), true
+}
+
+// printLintText prints one finding per line like a compiler, file:line:column,
+// followed by the command and the evidence. The command line checked by --hook
+// was just typed, so it isn't repeated.
+func printLintText(results []lintResult) {
+	for _, r := range results {
+		if r.File == "" {
+			fmt.Printf("🛡️ %s [%s] %s\n", r.Level, r.RuleID, r.Reason)
+		} else {
+			fmt.Printf("%s:%d:%d: %s [%s] %s\n", r.File, r.Line, r.Column, r.Level, r.RuleID, r.Reason)
+			fmt.Printf("    %s\n", oneLine(r.Command))
+		}
+		if r.Detail != "" {
+			fmt.Printf("    ↳ %s\n", oneLine(r.Detail))
+		}
+		if r.Alternative != "" {
+			fmt.Printf("    💡 Safer: %s\n", oneLine(r.Alternative))
+		}
+	}
+}
+
+// oneLine keeps a multi-line command or payload to one line of output
+func oneLine(s string) string {
+	if first, _, multi := strings.Cut(s, "\n"); multi {
+		return strings.TrimSpace(first) + " …"
+	}
+	return s
+}
+
+// jsonFinding is a finding in the output of --format json
+type jsonFinding struct {
+	File        string `json:"file,omitempty"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+	Level       string `json:"level"`
+	Rule        string `json:"rule"`
+	Reason      string `json:"reason"`
+	Detail      string `json:"detail,omitempty"`
+	Command     string `json:"command"`
+	Alternative string `json:"alternative,omitempty"`
+}
+
+func printLintJSON(results []lintResult) {
+	findings := make([]jsonFinding, 0, len(results))
+	for _, r := range results {
+		findings = append(findings, jsonFinding{
+			File:        r.File,
+			Line:        r.Line,
+			Column:      r.Column,
+			EndLine:     r.EndLine,
+			EndColumn:   r.EndColumn,
+			Level:       r.Level.String(),
+			Rule:        r.RuleID,
+			Reason:      r.Reason,
+			Detail:      r.Detail,
+			Command:     r.Command,
+			Alternative: r.Alternative,
+		})
+	}
+	data, _ := json.MarshalIndent(findings, "", "  ")
+	fmt.Println(string(data))
+}
+
+// SARIF 2.1.0, the format code scanning tools such as GitHub's import
+type (
+	sarifLog struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		RuleIndex int             `json:"ruleIndex"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine   int          `json:"startLine"`
+				StartColumn int          `json:"startColumn"`
+				EndLine     int          `json:"endLine"`
+				EndColumn   int          `json:"endColumn"`
+				Snippet     sarifMessage `json:"snippet"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+)
+
+func printLintSARIF(results []lintResult) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "bmh guard",
+			Version:        Version,
+			InformationURI: "https://github.com/DeaglePC/Baomihua",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	ruleIndex := map[string]int{}
+	for _, r := range results {
+		i, ok := ruleIndex[r.RuleID]
+		if !ok {
+			i = len(run.Tool.Driver.Rules)
+			ruleIndex[r.RuleID] = i
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: r.RuleID, ShortDescription: sarifMessage{Text: r.Reason}})
+		}
+
+		level := "warning"
+		if r.Level >= guard.Danger {
+			level = "error"
+		}
+		message := r.Reason
+		if r.Detail != "" {
+			message += " (" + oneLine(r.Detail) + ")"
+		}
+		var loc sarifLocation
+		loc.PhysicalLocation.ArtifactLocation.URI = cmp.Or(r.File, "stdin")
+		loc.PhysicalLocation.Region.StartLine = r.Line
+		loc.PhysicalLocation.Region.StartColumn = r.Column
+		loc.PhysicalLocation.Region.EndLine = r.EndLine
+		loc.PhysicalLocation.Region.EndColumn = r.EndColumn
+		loc.PhysicalLocation.Region.Snippet.Text = r.Command
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    r.RuleID,
+			RuleIndex: i,
+			Level:     level,
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{loc},
+		})
+	}
+
+	data, _ := json.MarshalIndent(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	fmt.Println(string(data))
+}
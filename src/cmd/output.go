@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"baomihua/config"
+	"baomihua/guard"
+	"baomihua/llm"
+)
+
+// Exit codes of the non-interactive modes, so scripts and editor plugins can tell
+// why no command was produced
+const (
+	exitError        = 1 // Generic failure (configuration, I/O, ...)
+	exitUsage        = 2 // Invalid invocation, e.g. no prompt
+	exitGuardBlocked = 3 // A command was generated but the guard flagged it as dangerous
+	exitParseFailure = 4 // The model answered, but not with a parseable result
+	exitVendorError  = 5 // The request to the model vendor failed
+)
+
+// jsonOutput is the document printed by --json
+type jsonOutput struct {
+	*llm.Result
+	Guard       string      `json:"guard,omitempty"`
+	GuardRule   string      `json:"guard_rule,omitempty"`
+	GuardReason string      `json:"guard_reason,omitempty"`
+	GuardDetail string      `json:"guard_detail,omitempty"`
+	Alternative string      `json:"alternative,omitempty"`
+	Review      *jsonReview `json:"review,omitempty"`
+	Model       string      `json:"model"`
+	LatencyMS   int64       `json:"latency_ms"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// jsonReview is the model's second opinion in the --json document
+type jsonReview struct {
+	Level      string `json:"level"`
+	Reversible bool   `json:"reversible"`
+	Rationale  string `json:"rationale"`
+	Model      string `json:"model"`
+}
+
+// runNonInteractive generates a command without the TUI and writes it to stdout,
+// either as the bare command (--print) or as a JSON document (--json).
+// It returns the process exit code.
+func runNonInteractive(prompt string, ctx llm.EnvContext, asJSON bool) int {
+	start := time.Now()
+	res, err := llm.Generate(prompt, ctx)
+
+	out := jsonOutput{
+		Result:    res,
+		Model:     config.GetModel(),
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+
+	code := 0
+	var verdict guard.Verdict
+	if err != nil {
+		out.Error = err.Error()
+		code = exitVendorError
+		if errors.Is(err, llm.ErrInvalidResponse) {
+			code = exitParseFailure
+		}
+	} else {
+		var reviewErr error
+		verdict, reviewErr = llm.CheckWithReview(prompt, res.Command, ctx)
+		if reviewErr != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ Model review failed, only the built-in rules apply: %v\n", reviewErr)
+		}
+		if r := verdict.Review; r != nil {
+			out.Review = &jsonReview{Level: r.Level.String(), Reversible: r.Reversible, Rationale: r.Rationale, Model: r.By}
+		}
+		out.Guard = verdict.Level.String()
+		out.GuardRule = verdict.RuleID
+		out.GuardReason = verdict.Reason
+		out.GuardDetail = verdict.Detail
+		out.Alternative = verdict.Alternative
+		if verdict.Level >= guard.Danger {
+			code = exitGuardBlocked
+		}
+	}
+
+	action := "print"
+	if asJSON {
+		action = "json"
+	}
+	recordHistory(prompt, ctx, res, verdict, action, nil)
+
+	if asJSON {
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+		return code
+	}
+
+	switch code {
+	case 0:
+		fmt.Println(res.Command)
+	case exitGuardBlocked:
+		fmt.Fprintf(os.Stderr, "⚠️ Refusing to print a dangerous command (%s: %s): %s\n", out.GuardRule, out.GuardReason, res.Command)
+		if out.GuardDetail != "" {
+			fmt.Fprintf(os.Stderr, "   ↳ %s\n", out.GuardDetail)
+		}
+		if out.Alternative != "" {
+			fmt.Fprintf(os.Stderr, "💡 Safer: %s\n", out.Alternative)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	}
+	return code
+}
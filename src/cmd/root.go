@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"baomihua/config"
@@ -10,6 +12,7 @@ import (
 	"baomihua/llm"
 	"baomihua/ui"
 
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -20,6 +23,11 @@ var (
 	switchFlag  string
 	installFlag bool
 	initFlag    string
+	inlineFlag  bool
+	printFlag   bool
+	jsonFlag    bool
+	yesFlag     bool
+	planFlag    bool
 )
 
 var Version = "dev"
@@ -83,7 +91,29 @@ var rootCmd = &cobra.Command{
 			return
 		}
 
+		// Pipes, CI jobs and editor plugins can't drive the TUI
+		nonInteractive := printFlag || jsonFlag || !isTerminal(os.Stdout)
+
+		// Piped data is read before anything else touches stdin, the TUI then
+		// reopens the terminal for keyboard input
+		var stdinSample string
+		if !inlineFlag && isPiped(os.Stdin) {
+			stdinSample = llm.FormatStdinSample(readStdin(os.Stdin))
+		}
+
 		prompt := strings.Join(args, " ")
+		if prompt == "" && inlineFlag {
+			// The hotkey widget was triggered on an empty prompt line
+			return
+		}
+		if planFlag && (nonInteractive || inlineFlag) {
+			fmt.Fprintln(os.Stderr, "❌ Error: --plan walks through the steps interactively and can't be combined with --print, --json, --inline or a redirected stdout")
+			os.Exit(exitUsage)
+		}
+		if prompt == "" && nonInteractive {
+			fmt.Fprintln(os.Stderr, "❌ Error: a prompt is required in non-interactive mode, e.g. bmh --print \"list open ports\"")
+			os.Exit(exitUsage)
+		}
 		if prompt == "" {
 			p, err := ui.RunPromptUI()
 			if err != nil {
@@ -100,9 +130,12 @@ var rootCmd = &cobra.Command{
 		if strings.ToLower(strings.TrimSpace(prompt)) == "fuck" {
 			lastCmd := strings.TrimSpace(os.Getenv("BAOMIHUA_LAST_CMD"))
 			lastErr := strings.TrimSpace(os.Getenv("BAOMIHUA_LAST_ERROR"))
+			lastStatus := strings.TrimSpace(os.Getenv("BAOMIHUA_LAST_STATUS"))
 
 			if lastErr != "" {
 				prompt = fmt.Sprintf("我刚刚运行的命令 `%s` 报错了，错误信息是: `%s`。请判断原因，并给我一个修复后的正确命令。", lastCmd, lastErr)
+			} else if lastCmd != "" && lastStatus != "" && lastStatus != "0" {
+				prompt = fmt.Sprintf("我刚刚运行的命令 `%s` 失败了，退出码是 %s。请判断原因，并给我一个修复后的正确命令。", lastCmd, lastStatus)
 			} else if lastCmd != "" {
 				prompt = fmt.Sprintf("我刚刚运行的命令 `%s` 似乎出错了（或不符合预期）。请帮我检查原因，并提供一个修复后的正确命令。", lastCmd)
 			} else {
@@ -112,50 +145,217 @@ var rootCmd = &cobra.Command{
 
 		// Pre-flight check: ensure at least one vendor is configured
 		if len(config.GetAllVendors()) == 0 {
-			fmt.Println("❌ Error: No API keys configured. Please configure at least one vendor's API key.")
-			fmt.Println("Example: export OPENAI_API_KEY=\"sk-...\" or set it in ~/.baomihua/config.yaml")
-			os.Exit(1)
+			fmt.Fprintln(os.Stderr, "❌ Error: No API keys configured. Please configure at least one vendor's API key.")
+			fmt.Fprintln(os.Stderr, "Example: export OPENAI_API_KEY=\"sk-...\" or set it in ~/.baomihua/config.yaml")
+			os.Exit(exitError)
 		}
 
-		res, action, exitStr, err := ui.RunUI(prompt)
-		if err != nil {
-			if ui.IsChinese(prompt) {
-				fmt.Printf("❌ 发生致命错误: %v\n", err)
-			} else {
-				fmt.Printf("❌ Fatal error: %v\n", err)
-			}
-			os.Exit(1)
+		ctx := llm.GetEnvContext()
+		ctx.Stdin = stdinSample
+		// Only the command generation prompt shows the workspace snapshot, so it is
+		// collected once here and reused by the fix-it rounds
+		if config.Cfg.WorkspaceContext && !planFlag && ctx.CWD != "unknown" {
+			ctx.Workspace = llm.CollectWorkspace(ctx.CWD)
 		}
 
-		if exitStr != "" {
-			fmt.Print(exitStr)
+		if nonInteractive {
+			os.Exit(runNonInteractive(prompt, ctx, jsonFlag))
+		}
+
+		if planFlag {
+			steps, code, err := ui.RunPlanUI(prompt, ctx)
+			for _, step := range steps {
+				res := &llm.Result{Command: step.Command, Explanation: step.Explanation}
+				recordHistory(prompt, ctx, res, step.Verdict, step.Action.String(), step.ExitCode)
+			}
+			if err != nil {
+				if ui.IsChinese(prompt) {
+					fmt.Printf("❌ 发生致命错误: %v\n", err)
+				} else {
+					fmt.Printf("❌ Fatal error: %v\n", err)
+				}
+			}
+			os.Exit(code)
 		}
 
-		if action == ui.ActionExecute && res != nil {
+		// Exit status of the last command that ran, bmh exits with it so wrappers
+		// and scripts see the same $? as if they had run the command themselves
+		status := 0
+		for {
+			res, verdict, action, exitStr, err := ui.RunUI(prompt, ctx, ui.Options{
+				Inline:           inlineFlag,
+				AutoExecute:      yesFlag || config.Cfg.AutoExecute.Enabled,
+				AutoExecuteAllow: config.Cfg.AutoExecute.Allow,
+			})
+			if err != nil {
+				if ui.IsChinese(prompt) {
+					fmt.Printf("❌ 发生致命错误: %v\n", err)
+				} else {
+					fmt.Printf("❌ Fatal error: %v\n", err)
+				}
+				os.Exit(exitError)
+			}
+
+			if exitStr != "" {
+				fmt.Print(exitStr)
+			}
+
+			// A sandbox run that was discarded is recorded as such
+			chosen := action
+			if action == ui.ActionSandbox && res != nil {
+				fmt.Println()
+				sandboxed, err := executor.ExecuteSandboxed(res.Command, ctx, config.Cfg.Sandbox.Network)
+				if err != nil {
+					if ui.IsChinese(prompt) {
+						fmt.Printf("\n❌ 沙箱执行失败: %v\n", err)
+					} else {
+						fmt.Printf("\n❌ Sandbox failed: %v\n", err)
+					}
+					os.Exit(exitError)
+				}
+
+				action, exitStr, err = ui.RunSandboxUI(prompt, sandboxed, verdict)
+				if err != nil {
+					fmt.Printf("❌ Fatal error: %v\n", err)
+					os.Exit(exitError)
+				}
+				fmt.Print(exitStr)
+				if action != ui.ActionCancel {
+					chosen = action
+				}
+			}
+
+			if action != ui.ActionExecute || res == nil {
+				recordHistory(prompt, ctx, res, verdict, chosen.String(), nil)
+				os.Exit(status)
+			}
+
 			fmt.Println()
-			err := executor.ExecuteCommand(res.Command, llm.GetEnvContext())
+			run, err := executor.ExecuteCapture(res.Command, ctx)
 			if err != nil {
 				if ui.IsChinese(prompt) {
 					fmt.Printf("\n❌ 执行异常: %v\n", err)
 				} else {
 					fmt.Printf("\n❌ Execution exception: %v\n", err)
 				}
-				os.Exit(1)
+				status = executor.ExitCode(err)
+				recordHistory(prompt, ctx, res, verdict, ui.ActionExecute.String(), &status)
+				os.Exit(status)
 			}
+			status = run.ExitCode
+			recordHistory(prompt, ctx, res, verdict, ui.ActionExecute.String(), &status)
+			if !run.Failed() {
+				return
+			}
+
+			// Keep the failure's context around: offer to fix it or explain the output
+			next, err := ui.RunFollowUpUI(prompt, run, ctx)
+			if err != nil || next != ui.FollowUpFix {
+				os.Exit(status)
+			}
+			prompt = fixPrompt(prompt, run)
 		}
 	},
 }
 
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
+// A subcommand that gets words it doesn't take, as in "bmh uninstall nginx
+// completely", hands the whole line to the root command as a prompt.
 func Execute() {
-	err := rootCmd.Execute()
+	cmd, err := rootCmd.ExecuteC()
+	if errors.Is(err, errPrompt) {
+		rootCmd.SetArgs(asPrompt(os.Args[1:], topLevel(cmd).Name()))
+		cmd, err = rootCmd.ExecuteC()
+	}
 	if err != nil {
+		cmd.PrintErrln(cmd.ErrPrefix(), err.Error())
+		cmd.PrintErrln(cmd.UsageString())
 		os.Exit(1)
 	}
 }
 
+// errPrompt is returned by subcommands whose words are a prompt instead
+var errPrompt = errors.New("not a subcommand but a prompt")
+
+// promptOr wraps the argument validator of a subcommand: arguments it rejects
+// make the command line a prompt, like "bmh guard my server against ssh brute
+// force", rather than an error
+func promptOr(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return fmt.Errorf("%w: %v", errPrompt, err)
+		}
+		return nil
+	}
+}
+
+// promptFlags makes flags a subcommand doesn't know part of a prompt as well.
+// The root command's own flags are still checked.
+func promptFlags(cmd *cobra.Command, err error) error {
+	if cmd == rootCmd {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errPrompt, err)
+}
+
+// topLevel returns the subcommand of the root command that cmd belongs to
+func topLevel(cmd *cobra.Command) *cobra.Command {
+	for cmd.HasParent() && cmd.Parent() != rootCmd {
+		cmd = cmd.Parent()
+	}
+	return cmd
+}
+
+// asPrompt ends the flags of a command line before the subcommand name, so the
+// root command takes the subcommand and everything after it as the prompt
+func asPrompt(args []string, name string) []string {
+	for i, arg := range args {
+		if arg == name {
+			return slices.Concat(args[:i], []string{"--"}, args[i:])
+		}
+	}
+	return args
+}
+
+// helpCmd replaces cobra's help command, which would take "bmh help me find
+// large files" for a help topic that doesn't exist
+var helpCmd = &cobra.Command{
+	Use:   "help [command]",
+	Short: "Help about any command",
+	Args:  promptOr(helpTopic),
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _, _ := rootCmd.Find(args)
+		target.Help()
+	},
+}
+
+// helpTopic accepts the words of help when they name a command
+func helpTopic(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	target, rest, err := rootCmd.Find(args)
+	if err != nil || target == rootCmd || len(rest) > 0 {
+		return fmt.Errorf("unknown help topic %q", strings.Join(args, " "))
+	}
+	return nil
+}
+
 func init() {
-	cobra.OnInitialize(config.InitConfig)
+	cobra.OnInitialize(config.InitConfig, setupGuard)
+
+	// Any other first word is part of a natural language prompt, so don't let cobra's
+	// default subcommands swallow requests like "bmh help me find large files".
+	// Execute reports errors, a subcommand's words may turn out to be a prompt.
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.SetHelpCommand(helpCmd)
+	rootCmd.SetFlagErrorFunc(promptFlags)
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
 
 	// Define command line flags
 	rootCmd.PersistentFlags().StringVarP(&modelFlag, "model", "m", "", "Override the default or configured model")
@@ -164,6 +364,11 @@ func init() {
 	rootCmd.Flags().BoolP("refresh", "r", false, "Force refresh the models cache from configured vendors")
 	rootCmd.Flags().BoolVar(&installFlag, "install", false, "Install the bmh shell wrapper into your terminal profile")
 	rootCmd.Flags().StringVar(&initFlag, "init", "", "Generate shell wrapper script for terminal injection (e.g. --init zsh)")
+	rootCmd.Flags().BoolVar(&printFlag, "print", false, "Print only the generated command to stdout, without the interactive UI")
+	rootCmd.Flags().BoolVar(&jsonFlag, "json", false, "Print the result, guard level, model and latency as JSON, without the interactive UI")
+	rootCmd.Flags().BoolVarP(&yesFlag, "yes", "y", false, "Execute immediately if the command is safe and matches the auto-execute allowlist")
+	rootCmd.Flags().BoolVar(&planFlag, "plan", false, "Break the task down into steps and run, skip or edit them one at a time")
+	rootCmd.Flags().BoolVar(&inlineFlag, "inline", false, "Use the compact inline UI that replaces the prompt line (used by the shell hotkey widget)")
 
 	// Bind flag to viper
 	viper.BindPFlag("model", rootCmd.PersistentFlags().Lookup("model"))
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"baomihua/executor"
+
+	"github.com/spf13/cobra"
+)
+
+// sandboxCmd is what bmh re-executes itself with inside the namespaces of the
+// "Execute in sandbox" action, to set up the mounts before the command starts.
+// It is not meant to be run by hand.
+var sandboxCmd = &cobra.Command{
+	Use:                executor.SandboxChildCommand,
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		code, err := executor.SandboxChild(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Sandbox setup failed: %v\n", err)
+			os.Exit(exitError)
+		}
+		os.Exit(code)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sandboxCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"baomihua/llm"
+)
+
+// Piped data is read with timeouts, so a producer that never closes its end
+// (e.g. 'tail -f app.log | bmh ...') can't hang bmh. The first-byte timeout is
+// short as well: editors and other callers often start bmh with a stdin pipe
+// they never write to, and every call would stall for the whole wait.
+const (
+	stdinFirstByteTimeout = 300 * time.Millisecond
+	stdinIdleTimeout      = 500 * time.Millisecond
+)
+
+// isPiped reports whether f is a pipe or a redirected file rather than a terminal
+func isPiped(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0 && !isTerminal(f)
+}
+
+// readStdin reads up to llm.StdinMaxBytes from f. It stops at EOF, once the limit
+// is reached, or when the producer goes quiet for longer than the timeouts allow.
+func readStdin(f *os.File) []byte {
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				chunks <- append([]byte(nil), buf[:n]...)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var data []byte
+	timeout := time.NewTimer(stdinFirstByteTimeout)
+	defer timeout.Stop()
+	for len(data) < llm.StdinMaxBytes {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return data
+			}
+			data = append(data, chunk...)
+			timeout.Reset(stdinIdleTimeout)
+		case <-timeout.C:
+			return data
+		}
+	}
+	return trimPartialRune(data[:llm.StdinMaxBytes])
+}
+
+// trimPartialRune drops a multi-byte character cut in half at the end of data,
+// which would make the text look like binary data
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
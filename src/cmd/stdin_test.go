@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"baomihua/llm"
+)
+
+func TestReadStdinKeepsWholeRunes(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The limit falls right after the first byte of 错
+	log := "错误: 连接超时\n" + strings.Repeat("x", llm.StdinMaxBytes-1-len("错误: 连接超时\n")) + "错误: 连接超时\n"
+	go func() {
+		w.WriteString(log)
+		w.Close()
+	}()
+
+	data := readStdin(r)
+	if len(data) > llm.StdinMaxBytes || len(data) < llm.StdinMaxBytes-utf8.UTFMax {
+		t.Fatalf("read %d bytes, want about %d", len(data), llm.StdinMaxBytes)
+	}
+	if !utf8.Valid(data) {
+		t.Fatal("the read data ends in a partial character")
+	}
+	if sample := llm.FormatStdinSample(data); !strings.Contains(sample, "连接超时") {
+		t.Errorf("expected the text to be kept, got %q", sample)
+	}
+}
+
+func TestReadStdinIdlePipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	start := time.Now()
+	if data := readStdin(r); len(data) != 0 {
+		t.Errorf("read %q from a pipe nobody writes to", data)
+	}
+	if elapsed := time.Since(start); elapsed > 2*stdinFirstByteTimeout {
+		t.Errorf("an idle pipe held bmh up for %v", elapsed)
+	}
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var purgeFlag bool
+
+// uninstallCmd removes everything 'bmh --install' wrote into shell profiles
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the bmh shell wrapper from all known shell profiles",
+	Long:  `Removes the managed bmh block from the zsh, bash, fish, Nushell and PowerShell profiles. With --purge, ~/.baomihua (config and model cache) is deleted as well.`,
+	Args:  promptOr(cobra.NoArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		UninstallWrapper(purgeFlag)
+	},
+}
+
+func init() {
+	uninstallCmd.Flags().BoolVar(&purgeFlag, "purge", false, "Also delete ~/.baomihua (config and model cache)")
+	rootCmd.AddCommand(uninstallCmd)
+}
@@ -15,10 +15,41 @@ type VendorConfig struct {
 	BaseURL string
 }
 
+// AutoExecuteConfig controls when a generated command may run without the menu
+type AutoExecuteConfig struct {
+	Enabled bool     `mapstructure:"enabled"` // Behave as if --yes was always passed
+	Allow   []string `mapstructure:"allow"`   // Command prefixes allowed to run unattended, e.g. "git status"
+}
+
+// SandboxConfig controls the "Execute in sandbox" action
+type SandboxConfig struct {
+	Network bool `mapstructure:"network"` // Allow network access inside the sandbox
+}
+
+// GuardConfig tunes the safety guard
+type GuardConfig struct {
+	Review      string   `mapstructure:"review"`       // "model" asks a model for a second opinion on each command, "off" doesn't
+	ReviewModel string   `mapstructure:"review-model"` // Model for the review, the main model if empty
+	Packs       []string `mapstructure:"packs"`        // Opt-in rule packs, e.g. git, k8s, terraform, docker, sql, cloud
+	Preexec     bool     `mapstructure:"preexec"`      // bmh --init also checks the commands typed by hand before they run
+}
+
 // AppConfig defines the application configuration
 type AppConfig struct {
-	Model   string `mapstructure:"model"`
-	Vendors []VendorConfig
+	Model            string            `mapstructure:"model"`
+	WorkspaceContext bool              `mapstructure:"workspace-context"` // Include a project/directory snapshot of CWD in the prompt
+	AutoExecute      AutoExecuteConfig `mapstructure:"auto-execute"`
+	Sandbox          SandboxConfig     `mapstructure:"sandbox"`
+	Guard            GuardConfig       `mapstructure:"guard"`
+	Vendors          []VendorConfig
+}
+
+// DefaultAutoExecuteAllow only contains read-only tools. guard.AutoExecutable
+// also refuses the options with which date and git branch, log and diff change
+// something, like date -s or git branch -D.
+var DefaultAutoExecuteAllow = []string{
+	"ls", "pwd", "whoami", "date", "uptime", "df", "du", "ps", "free",
+	"git status", "git log", "git diff", "git branch",
 }
 
 var Cfg AppConfig
@@ -40,6 +71,8 @@ var DefaultVendors = []VendorConfig{
 func InitConfig() {
 	// 1. Initial setup for Viper
 	viper.SetDefault("model", "gpt-4o")
+	viper.SetDefault("workspace-context", true)
+	viper.SetDefault("auto-execute.allow", DefaultAutoExecuteAllow)
 
 	// Set config file search paths
 	home, err := os.UserHomeDir()
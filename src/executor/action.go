@@ -1,36 +1,95 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
-	"strings"
+	"syscall"
 
 	"baomihua/llm"
 
 	"github.com/atotto/clipboard"
 )
 
-// ExecuteCommand runs a command in the current OS shell directly
+// ExecuteCommand runs a command in the current OS shell directly, in the
+// foreground of the terminal
 func ExecuteCommand(cmdStr string, ctx llm.EnvContext) error {
-	var cmd *exec.Cmd
+	cmd := Command(cmdStr, ctx)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	wait, err := startForeground(cmd)
+	if err != nil {
+		return err
+	}
+	return wait()
+}
 
+// Command builds the *exec.Cmd that runs cmdStr in the current OS shell,
+// leaving stdio for the caller to connect. On Unix the user's zsh, bash or fish
+// runs it, since the model was told to write for that shell; anything else
+// falls back to sh.
+func Command(cmdStr string, ctx llm.EnvContext) *exec.Cmd {
+	kind := llm.ShellKind(ctx.Shell)
+
+	if kind == "nu" {
+		return exec.Command("nu", "-c", cmdStr)
+	}
 	if runtime.GOOS == "windows" {
-		if strings.Contains(strings.ToLower(ctx.Shell), "powershell") || strings.Contains(strings.ToLower(ctx.Shell), "pwsh") {
-			cmd = exec.Command("powershell", "-NoProfile", "-Command", cmdStr)
-		} else {
-			cmd = exec.Command("cmd", "/c", cmdStr)
+		if kind == "powershell" {
+			return exec.Command("powershell", "-NoProfile", "-Command", cmdStr)
 		}
-	} else {
-		cmd = exec.Command("sh", "-c", cmdStr)
+		return exec.Command("cmd", "/c", cmdStr)
 	}
 
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	switch kind {
+	case "zsh", "bash", "fish":
+		if path := shellPath(ctx.Shell, kind); path != "" {
+			return exec.Command(path, "-c", cmdStr)
+		}
+	}
+	return exec.Command("sh", "-c", cmdStr)
+}
+
+// shellPath finds the binary of the shell kind, preferring the exact path the
+// environment reported (e.g. SHELL=/opt/homebrew/bin/bash) over the PATH lookup
+func shellPath(shell, kind string) string {
+	if filepath.IsAbs(shell) {
+		if info, err := os.Stat(shell); err == nil && !info.IsDir() {
+			return shell
+		}
+	}
+	if path, err := exec.LookPath(kind); err == nil {
+		return path
+	}
+	return ""
+}
 
-	return cmd.Run()
+// ExitCode extracts the exit status from the error returned by running a command,
+// the way a shell reports it in $?: 0 for success, the process' code when it
+// exited, 128+n when it was killed by signal n, 127 when the shell binary wasn't
+// found and 1 for any other failure
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		if exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode()
+		}
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return 127
+	}
+	return 1
 }
 
 // CopyToClipboard copies the text to the system clipboard
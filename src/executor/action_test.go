@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"baomihua/llm"
+)
+
+func TestExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	ctx := llm.EnvContext{Shell: "sh"}
+
+	tests := []struct {
+		command string
+		want    int
+	}{
+		{"true", 0},
+		{"exit 7", 7},
+		{"kill -TERM $$", 143},
+		{"kill -INT $$", 130},
+	}
+	for _, tt := range tests {
+		err := Command(tt.command, ctx).Run()
+		if got := ExitCode(err); got != tt.want {
+			t.Errorf("ExitCode(%q) = %d, want %d", tt.command, got, tt.want)
+		}
+	}
+
+	if got := ExitCode(exec.Command("bmh-no-such-binary").Run()); got != 127 {
+		t.Errorf("ExitCode(missing binary) = %d, want 127", got)
+	}
+}
+
+func TestCommandUsesDetectedShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix shells only")
+	}
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	// Bash-isms break under a plain POSIX sh
+	ctx := llm.EnvContext{Shell: bash}
+	cmd := Command(`arr=(a b); [[ ${arr[1]} == b ]]`, ctx)
+	if cmd.Path != bash {
+		t.Fatalf("expected %s to run the command, got %s", bash, cmd.Path)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("bash-ism failed: %v", err)
+	}
+
+	if cmd := Command("true", llm.EnvContext{Shell: "/bin/tcsh-that-does-not-exist"}); cmd.Args[0] != "sh" {
+		t.Errorf("expected the sh fallback, got %v", cmd.Args)
+	}
+}
@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"baomihua/llm"
+)
+
+// CaptureMaxBytes is how much of the tail of stdout and stderr is kept in memory
+const CaptureMaxBytes = 8 * 1024
+
+// Execution describes a finished command run
+type Execution struct {
+	Command  string
+	ExitCode int
+	Duration time.Duration
+	Stdout   string // Last CaptureMaxBytes of stdout
+	Stderr   string // Last CaptureMaxBytes of stderr
+}
+
+// Failed reports whether the command exited with a non-zero code
+func (e *Execution) Failed() bool {
+	return e.ExitCode != 0
+}
+
+// tailBuffer is an io.Writer that only keeps the last max bytes written to it
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// captureOutput connects cmd to bmh's stdin, stdout and stderr and tees both
+// outputs into bounded buffers, so the output can be explained afterwards. The
+// command writes to a pipe, so programs that check for a terminal may drop
+// colours or progress bars.
+func captureOutput(cmd *exec.Cmd) (stdout, stderr *tailBuffer) {
+	stdout = &tailBuffer{max: CaptureMaxBytes}
+	stderr = &tailBuffer{max: CaptureMaxBytes}
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	return stdout, stderr
+}
+
+// ExecuteCapture runs a command like ExecuteCommand while teeing its output into
+// bounded buffers, so a failure can be explained or fixed afterwards. The error
+// is only set when the command could not be started at all.
+func ExecuteCapture(cmdStr string, ctx llm.EnvContext) (*Execution, error) {
+	cmd := Command(cmdStr, ctx)
+	stdout, stderr := captureOutput(cmd)
+
+	start := time.Now()
+	wait, err := startForeground(cmd)
+	if err != nil {
+		return nil, err
+	}
+	err = wait()
+
+	return &Execution{
+		Command:  cmdStr,
+		ExitCode: ExitCode(err),
+		Duration: time.Since(start),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}, nil
+}
@@ -0,0 +1,832 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"baomihua/llm"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// previewMaxEntries bounds how many filesystem entries a preview may visit
+const previewMaxEntries = 20000
+
+// Preview is the dry-run result of a command: which paths its destructive parts
+// would touch. Nothing is executed and nothing is written while building it.
+type Preview struct {
+	Entries     []PreviewEntry
+	Unsupported []string // Parts of the command that could not be previewed, and why
+	Truncated   bool     // The entry limit was hit, counts are lower bounds
+}
+
+// PreviewEntry describes what a single destructive simple command would touch
+type PreviewEntry struct {
+	Operation string   // e.g. "rm -r", "chmod 644", "find -delete", "sed -i"
+	Paths     []string // Affected paths, as the command names them
+	Missing   []string // Operands that don't exist (or globs that matched nothing)
+	Notes     []string // e.g. the mv destination
+	Files     int
+	Dirs      int
+	Bytes     int64
+}
+
+// Previewable reports whether command contains something PreviewCommand knows how
+// to dry-run: rm, mv, chmod, chown, chgrp, find -delete or sed -i
+func Previewable(command string) bool {
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return false
+	}
+	return destructiveCall(file) != ""
+}
+
+// PreviewCommand parses command and works out which files its rm, mv, chmod, chown,
+// chgrp, find -delete and sed -i parts would affect. Globs, braces, ~ and variables
+// are expanded relative to ctx.CWD; anything that can't be resolved without running
+// code, such as command substitutions or loops, is reported as unsupported.
+func PreviewCommand(command string, ctx llm.EnvContext) *Preview {
+	p := &Preview{}
+
+	switch llm.ShellKind(ctx.Shell) {
+	case "fish", "nu", "powershell", "cmd":
+		p.Unsupported = append(p.Unsupported, "the preview only understands POSIX shell syntax (sh, bash, zsh)")
+		return p
+	}
+
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		p.Unsupported = append(p.Unsupported, fmt.Sprintf("the command could not be parsed: %v", err))
+		return p
+	}
+
+	pv := &previewer{
+		preview: p,
+		cwd:     ctx.CWD,
+		cfg: &expand.Config{
+			Env:     expand.ListEnviron(append(os.Environ(), "PWD="+ctx.CWD)...),
+			ReadDir: readDir,
+		},
+	}
+	for _, stmt := range file.Stmts {
+		pv.stmt(stmt)
+	}
+
+	if len(p.Entries) == 0 && len(p.Unsupported) == 0 {
+		p.Unsupported = append(p.Unsupported, "the command has no rm, mv, chmod, chown, chgrp, find -delete or sed -i to preview")
+	}
+	return p
+}
+
+// readDir lists a directory for glob expansion
+func readDir(dir string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+type previewer struct {
+	preview *Preview
+	cwd     string
+	cfg     *expand.Config
+	visited int
+}
+
+func (pv *previewer) unsupported(format string, args ...any) {
+	pv.preview.Unsupported = append(pv.preview.Unsupported, fmt.Sprintf(format, args...))
+}
+
+func (pv *previewer) stmt(stmt *syntax.Stmt) {
+	switch cmd := stmt.Cmd.(type) {
+	case nil:
+	case *syntax.CallExpr:
+		pv.call(cmd)
+	case *syntax.BinaryCmd:
+		pv.stmt(cmd.X)
+		pv.stmt(cmd.Y)
+	default:
+		// Compound commands are only a problem if something destructive hides inside
+		if name := destructiveCall(cmd); name != "" {
+			pv.unsupported("'%s' inside %s can't be previewed", name, constructName(cmd))
+		}
+	}
+}
+
+// destructiveCall returns the name of the first previewable program called inside node
+func destructiveCall(node syntax.Node) string {
+	name := ""
+	syntax.Walk(node, func(n syntax.Node) bool {
+		if call, ok := n.(*syntax.CallExpr); ok && name == "" {
+			name = previewableCall(call)
+		}
+		return name == ""
+	})
+	return name
+}
+
+// previewableCall returns the program name if call is one of the commands the
+// preview understands, judging by its literal words only
+func previewableCall(call *syntax.CallExpr) string {
+	var words []string
+	for _, word := range call.Args {
+		words = append(words, word.Lit())
+	}
+	words = stripPrivilegePrefix(words)
+	if len(words) == 0 {
+		return ""
+	}
+
+	name := filepath.Base(words[0])
+	switch name {
+	case "rm", "mv", "chmod", "chown", "chgrp":
+		return name
+	case "find":
+		for i, word := range words {
+			if word == "-delete" || (strings.HasPrefix(word, "-exec") || strings.HasPrefix(word, "-ok")) && i+1 < len(words) && filepath.Base(words[i+1]) == "rm" {
+				return name
+			}
+		}
+	case "sed":
+		for _, word := range words[1:] {
+			if strings.HasPrefix(word, "--in-place") || strings.HasPrefix(word, "-") && !strings.HasPrefix(word, "--") && sedShortInPlace(word) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// sedShortInPlace reports whether a cluster of short sed options such as "-Ei"
+// contains -i (and not just as the value of -e, -f or -l)
+func sedShortInPlace(cluster string) bool {
+	for _, c := range cluster[1:] {
+		switch c {
+		case 'i':
+			return true
+		case 'e', 'f', 'l':
+			return false
+		}
+	}
+	return false
+}
+
+func printWords(words []*syntax.Word) string {
+	var sb strings.Builder
+	printer := syntax.NewPrinter()
+	for _, word := range words {
+		printer.Print(&sb, word)
+		sb.WriteString(" ")
+	}
+	return sb.String()
+}
+
+func constructName(cmd syntax.Command) string {
+	switch cmd.(type) {
+	case *syntax.IfClause:
+		return "an if block"
+	case *syntax.ForClause, *syntax.WhileClause:
+		return "a loop"
+	case *syntax.CaseClause:
+		return "a case block"
+	case *syntax.Subshell:
+		return "a subshell"
+	case *syntax.Block:
+		return "a { } block"
+	case *syntax.FuncDecl:
+		return "a function"
+	}
+	return "a compound command"
+}
+
+func (pv *previewer) call(call *syntax.CallExpr) {
+	// Harmless commands are skipped before expansion, so e.g. a command
+	// substitution in an echo doesn't make the preview give up
+	if previewableCall(call) == "" {
+		return
+	}
+
+	var args []string
+	var expandErr error
+	for _, word := range call.Args {
+		fields, err := expand.Fields(pv.cfg, word)
+		if err != nil {
+			if expandErr == nil {
+				expandErr = err
+			}
+			fields = []string{printWords([]*syntax.Word{word})}
+		}
+		args = append(args, fields...)
+	}
+
+	args = stripPrivilegePrefix(args)
+	if len(args) == 0 {
+		return
+	}
+	name := filepath.Base(args[0])
+	if expandErr != nil {
+		var cmdErr expand.UnexpectedCommandError
+		if errors.As(expandErr, &cmdErr) {
+			pv.unsupported("'%s' uses a command substitution, which can't be expanded without running it", name)
+		} else {
+			pv.unsupported("the arguments of '%s' could not be expanded: %v", name, expandErr)
+		}
+		return
+	}
+
+	switch name {
+	case "rm":
+		pv.rm(args[1:])
+	case "mv":
+		pv.mv(args[1:])
+	case "chmod", "chown", "chgrp":
+		pv.chmod(name, args[1:])
+	case "find":
+		pv.find(args[1:])
+	case "sed":
+		pv.sed(args[1:])
+	}
+}
+
+// stripPrivilegePrefix drops a leading sudo/doas (and its options), which doesn't
+// change what the wrapped command touches
+func stripPrivilegePrefix(args []string) []string {
+	if len(args) == 0 || (args[0] != "sudo" && args[0] != "doas") {
+		return args
+	}
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flag := args[0]
+		args = args[1:]
+		// Options of sudo that take a value
+		if flag == "-u" || flag == "-g" || flag == "-C" || flag == "-D" || flag == "-h" || flag == "-p" || flag == "-r" || flag == "-t" || flag == "-U" {
+			if len(args) > 0 {
+				args = args[1:]
+			}
+		}
+	}
+	return args
+}
+
+// splitArgs separates options from operands, honouring "--". Short options may be
+// combined ("-rf"); long options are returned whole.
+func splitArgs(args []string) (flags, operands []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return flags, append(operands, args[i+1:]...)
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			flags = append(flags, arg)
+		} else {
+			operands = append(operands, arg)
+		}
+	}
+	return flags, operands
+}
+
+// hasFlag reports whether one of the short letters or long names is set
+func hasFlag(flags []string, short string, long ...string) bool {
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "--") {
+			for _, name := range long {
+				if flag == "--"+name {
+					return true
+				}
+			}
+			continue
+		}
+		if strings.ContainsAny(flag[1:], short) {
+			return true
+		}
+	}
+	return false
+}
+
+func (pv *previewer) rm(args []string) {
+	flags, operands := splitArgs(args)
+	recursive := hasFlag(flags, "rR", "recursive")
+
+	entry := PreviewEntry{Operation: "rm"}
+	if recursive {
+		entry.Operation = "rm -r"
+	}
+	for _, path := range operands {
+		if info, ok := pv.measure(&entry, path, recursive); ok && info.IsDir() && !recursive && !hasFlag(flags, "d", "dir") {
+			entry.Notes = append(entry.Notes, fmt.Sprintf("%s is a directory, rm refuses it without -r", path))
+		}
+	}
+	pv.add(entry)
+}
+
+func (pv *previewer) mv(args []string) {
+	// The value of -t and -S is the next argument, wherever it is
+	var operands []string
+	target := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			operands = append(operands, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "--target-directory="):
+			target = strings.TrimPrefix(arg, "--target-directory=")
+		case arg == "--target-directory" || arg == "--suffix":
+			if i+1 < len(args) {
+				if arg == "--target-directory" {
+					target = args[i+1]
+				}
+				i++
+			}
+		case strings.HasPrefix(arg, "--"):
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			// -t and -S may end a group of short options or be followed by their value
+			if j := strings.IndexAny(arg, "tS"); j > 0 {
+				value := arg[j+1:]
+				if value == "" && i+1 < len(args) {
+					i++
+					value = args[i]
+				}
+				if arg[j] == 't' {
+					target = value
+				}
+			}
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	if target == "" {
+		if len(operands) < 2 {
+			pv.unsupported("'mv' needs a source and a destination")
+			return
+		}
+		target, operands = operands[len(operands)-1], operands[:len(operands)-1]
+	}
+
+	entry := PreviewEntry{Operation: "mv → " + target}
+	for _, path := range operands {
+		pv.measure(&entry, path, true)
+	}
+
+	if info, err := os.Stat(pv.abs(target)); err == nil && !info.IsDir() {
+		entry.Notes = append(entry.Notes, fmt.Sprintf("%s already exists and would be overwritten", target))
+	} else if err == nil {
+		entry.Notes = append(entry.Notes, fmt.Sprintf("moved into the existing directory %s", target))
+	}
+	pv.add(entry)
+}
+
+func (pv *previewer) chmod(name string, args []string) {
+	var flags, operands []string
+	mode := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			operands = append(operands, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "--reference="):
+			flags = append(flags, arg)
+			mode = "like " + strings.TrimPrefix(arg, "--reference=")
+		case strings.HasPrefix(arg, "--"):
+			flags = append(flags, arg)
+		case name == "chmod" && mode == "" && strings.HasPrefix(arg, "-") && strings.Trim(arg, "-+=rwxXstugoa,") == "":
+			// chmod -x file: a symbolic mode, not an option
+			mode = arg
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			flags = append(flags, arg)
+		case mode == "":
+			mode = arg
+		default:
+			operands = append(operands, arg)
+		}
+	}
+
+	recursive := hasFlag(flags, "R", "recursive")
+	entry := PreviewEntry{Operation: name + " " + mode}
+	if recursive {
+		entry.Operation = name + " -R " + mode
+	}
+	for _, path := range operands {
+		pv.measure(&entry, path, recursive)
+	}
+	pv.add(entry)
+}
+
+func (pv *previewer) sed(args []string) {
+	inPlace := false
+	hasScript := false
+	var files []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			files = append(files, args[i+1:]...)
+			i = len(args)
+		case arg == "--in-place" || strings.HasPrefix(arg, "--in-place="):
+			inPlace = true
+		case arg == "--expression" || arg == "--file":
+			hasScript = true
+			i++
+		case strings.HasPrefix(arg, "--expression=") || strings.HasPrefix(arg, "--file="):
+			hasScript = true
+		case strings.HasPrefix(arg, "--"):
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			// A cluster of short options: -i takes the rest as backup suffix,
+			// -e/-f/-l take the rest or the next argument as value
+		cluster:
+			for j, c := range arg[1:] {
+				switch c {
+				case 'i':
+					inPlace = true
+					// BSD sed takes the backup suffix as a separate, possibly empty, argument
+					if j == len(arg)-2 && i+1 < len(args) && args[i+1] == "" {
+						i++
+					}
+					break cluster
+				case 'e', 'f', 'l':
+					hasScript = hasScript || c != 'l'
+					if j == len(arg)-2 {
+						i++
+					}
+					break cluster
+				}
+			}
+		case !hasScript:
+			hasScript = true
+		default:
+			files = append(files, arg)
+		}
+	}
+	if !inPlace {
+		return
+	}
+
+	entry := PreviewEntry{Operation: "sed -i"}
+	for _, path := range files {
+		pv.measure(&entry, path, false)
+	}
+	pv.add(entry)
+}
+
+func (pv *previewer) add(entry PreviewEntry) {
+	pv.preview.Entries = append(pv.preview.Entries, entry)
+}
+
+func (pv *previewer) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(pv.cwd, path)
+}
+
+// measure records path in entry and counts what it contains. The FileInfo is
+// returned when the path exists.
+func (pv *previewer) measure(entry *PreviewEntry, path string, recursive bool) (fs.FileInfo, bool) {
+	info, err := os.Lstat(pv.abs(path))
+	if err != nil {
+		entry.Missing = append(entry.Missing, path)
+		return nil, false
+	}
+
+	entry.Paths = append(entry.Paths, path)
+	pv.count(entry, info)
+	if info.IsDir() && recursive {
+		pv.walk(pv.abs(path), func(_ string, _ int, info fs.FileInfo) {
+			pv.count(entry, info)
+		})
+	}
+	return info, true
+}
+
+func (pv *previewer) count(entry *PreviewEntry, info fs.FileInfo) {
+	if info.IsDir() {
+		entry.Dirs++
+		return
+	}
+	entry.Files++
+	entry.Bytes += info.Size()
+}
+
+// walk visits everything below root (excluding root itself) with its depth,
+// within the preview's entry budget
+func (pv *previewer) walk(root string, visit func(path string, depth int, info fs.FileInfo)) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if pv.visited >= previewMaxEntries {
+			pv.preview.Truncated = true
+			return filepath.SkipAll
+		}
+		pv.visited++
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		visit(path, strings.Count(rel, string(filepath.Separator))+1, info)
+		return nil
+	})
+}
+
+// findTest is a single predicate of a find expression. path is the file on disk,
+// name the path as find reports it, starting with the operand as it was given.
+type findTest func(path, name string, info fs.FileInfo) bool
+
+func (pv *previewer) find(args []string) {
+	i := 0
+	for i < len(args) && (args[i] == "-H" || args[i] == "-L" || args[i] == "-P") {
+		i++
+	}
+	var roots []string
+	for ; i < len(args) && !strings.HasPrefix(args[i], "-") && args[i] != "(" && args[i] != "!"; i++ {
+		roots = append(roots, args[i])
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	expr := args[i:]
+
+	deletes, recursive := false, false
+	for j := 0; j < len(expr); j++ {
+		switch expr[j] {
+		case "-delete":
+			deletes = true
+		case "-exec", "-execdir", "-ok", "-okdir":
+			end := j + 1
+			for end < len(expr) && expr[end] != ";" && expr[end] != "+" {
+				end++
+			}
+			if end > j+1 && filepath.Base(expr[j+1]) == "rm" {
+				deletes = true
+				flags, _ := splitArgs(expr[j+2 : end])
+				recursive = recursive || hasFlag(flags, "rR", "recursive")
+			}
+			j = end
+		}
+	}
+	if !deletes {
+		// find without -delete doesn't change anything
+		return
+	}
+
+	// find evaluates its expression from left to right, so the tests after the
+	// first delete don't limit what it deletes. -maxdepth and -mindepth apply
+	// wherever they are.
+	var tests []findTest
+	late := ""
+	deleted := false
+	addTest := func(arg string, test findTest) {
+		if deleted {
+			if late == "" {
+				late = arg
+			}
+			return
+		}
+		tests = append(tests, test)
+	}
+	minDepth, maxDepth := 0, -1
+	now := time.Now()
+	for j := 0; j < len(expr); j++ {
+		arg := expr[j]
+		value := ""
+		switch arg {
+		case "-name", "-iname", "-path", "-ipath", "-wholename", "-type", "-maxdepth", "-mindepth", "-mtime", "-mmin", "-size":
+			if j+1 >= len(expr) {
+				pv.unsupported("find %s is missing its argument", arg)
+				return
+			}
+			j++
+			value = expr[j]
+		}
+
+		switch arg {
+		case "-name", "-iname":
+			pattern, fold := value, arg == "-iname"
+			addTest(arg, func(path, _ string, _ fs.FileInfo) bool {
+				return globMatch(pattern, filepath.Base(path), fold)
+			})
+		case "-path", "-ipath", "-wholename":
+			re, err := pathPattern(value, arg == "-ipath")
+			if err != nil {
+				pv.unsupported("find %s %s is not supported by the preview", arg, value)
+				return
+			}
+			addTest(arg, func(_, name string, _ fs.FileInfo) bool {
+				return re.MatchString(name)
+			})
+		case "-type":
+			types := strings.Split(value, ",")
+			addTest(arg, func(_, _ string, info fs.FileInfo) bool {
+				for _, t := range types {
+					if (t == "f" && info.Mode().IsRegular()) || (t == "d" && info.IsDir()) || (t == "l" && info.Mode()&fs.ModeSymlink != 0) {
+						return true
+					}
+				}
+				return false
+			})
+		case "-maxdepth", "-mindepth":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				pv.unsupported("find %s %s is not a number", arg, value)
+				return
+			}
+			if arg == "-maxdepth" {
+				maxDepth = n
+			} else {
+				minDepth = n
+			}
+		case "-mtime", "-mmin":
+			unit := 24 * time.Hour
+			if arg == "-mmin" {
+				unit = time.Minute
+			}
+			cmp, ok := parseFindNumber(value)
+			if !ok {
+				pv.unsupported("find %s %s is not supported by the preview", arg, value)
+				return
+			}
+			addTest(arg, func(_, _ string, info fs.FileInfo) bool {
+				return cmp(int64(now.Sub(info.ModTime()) / unit))
+			})
+		case "-size":
+			test, ok := parseFindSize(value)
+			if !ok {
+				pv.unsupported("find -size %s is not supported by the preview", value)
+				return
+			}
+			addTest(arg, test)
+		case "-empty":
+			addTest(arg, func(path, _ string, info fs.FileInfo) bool {
+				if info.IsDir() {
+					entries, err := os.ReadDir(path)
+					return err == nil && len(entries) == 0
+				}
+				return info.Mode().IsRegular() && info.Size() == 0
+			})
+		case "-a", "-and", "-print", "-print0", "-ls", "-xdev", "-mount", "-depth", "-noleaf":
+		case "-delete":
+			deleted = true
+		case "-exec", "-execdir", "-ok", "-okdir":
+			deleted = deleted || j+1 < len(expr) && filepath.Base(expr[j+1]) == "rm"
+			for j < len(expr) && expr[j] != ";" && expr[j] != "+" {
+				j++
+			}
+		default:
+			pv.unsupported("find %s is not supported by the preview", arg)
+			return
+		}
+	}
+
+	entry := PreviewEntry{Operation: "find -delete"}
+	if late != "" {
+		entry.Notes = append(entry.Notes, fmt.Sprintf("%s comes after the delete, so it doesn't limit what is deleted", late))
+	}
+	for _, root := range roots {
+		info, err := os.Lstat(pv.abs(root))
+		if err != nil {
+			entry.Missing = append(entry.Missing, root)
+			continue
+		}
+
+		check := func(display, name, path string, depth int, info fs.FileInfo) {
+			if depth < minDepth || (maxDepth >= 0 && depth > maxDepth) {
+				return
+			}
+			for _, test := range tests {
+				if !test(path, name, info) {
+					return
+				}
+			}
+			entry.Paths = append(entry.Paths, display)
+			pv.count(&entry, info)
+			if info.IsDir() && recursive {
+				pv.walk(path, func(_ string, _ int, info fs.FileInfo) {
+					pv.count(&entry, info)
+				})
+			}
+		}
+
+		check(root, root, pv.abs(root), 0, info)
+		if info.IsDir() && maxDepth != 0 {
+			pv.walk(pv.abs(root), func(path string, depth int, info fs.FileInfo) {
+				if maxDepth >= 0 && depth > maxDepth {
+					return
+				}
+				rel, _ := filepath.Rel(pv.abs(root), path)
+				// find joins the operand as given and the rest: ./build/x, not build/x
+				name := strings.TrimSuffix(root, "/") + "/" + filepath.ToSlash(rel)
+				check(filepath.Join(root, rel), name, path, depth, info)
+			})
+		}
+	}
+	pv.add(entry)
+}
+
+// globMatch matches a find -name/-path pattern
+func globMatch(pattern, name string, fold bool) bool {
+	if fold {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	ok, _ := filepath.Match(pattern, name)
+	return ok
+}
+
+// pathPattern compiles a find -path pattern. Unlike in -name patterns and
+// filepath.Match, * and ? match / as well, so ./build/* matches everything below
+// ./build.
+func pathPattern(pattern string, fold bool) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	if fold {
+		sb.WriteString("(?i)")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == 0 {
+				// ] right after [ is part of the set
+				end = strings.IndexByte(pattern[i+2:], ']') + 1
+			}
+			if end <= 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			set := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(set, "!") {
+				set = "^" + set[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(set, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// parseFindNumber parses find's N, +N (more than) and -N (less than) arguments
+func parseFindNumber(value string) (func(int64) bool, bool) {
+	n, err := strconv.ParseInt(strings.TrimLeft(value, "+-"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	switch {
+	case strings.HasPrefix(value, "+"):
+		return func(v int64) bool { return v > n }, true
+	case strings.HasPrefix(value, "-"):
+		return func(v int64) bool { return v < n }, true
+	}
+	return func(v int64) bool { return v == n }, true
+}
+
+// parseFindSize parses find -size, which rounds sizes up to whole units
+func parseFindSize(value string) (findTest, bool) {
+	if value == "" {
+		return nil, false
+	}
+	units := map[byte]int64{'b': 512, 'c': 1, 'w': 2, 'k': 1024, 'M': 1024 * 1024, 'G': 1024 * 1024 * 1024}
+	unit := int64(512)
+	if last := value[len(value)-1]; last < '0' || last > '9' {
+		u, ok := units[last]
+		if !ok {
+			return nil, false
+		}
+		unit = u
+		value = value[:len(value)-1]
+	}
+	cmp, ok := parseFindNumber(value)
+	if !ok {
+		return nil, false
+	}
+	return func(_, _ string, info fs.FileInfo) bool {
+		return cmp((info.Size() + unit - 1) / unit)
+	}, true
+}
@@ -0,0 +1,155 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"baomihua/llm"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func previewIn(t *testing.T, dir, command string) *Preview {
+	t.Helper()
+	return PreviewCommand(command, llm.EnvContext{OS: "linux", Shell: "/bin/bash", CWD: dir})
+}
+
+func TestPreviewRm(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.log"), 100)
+	writeFile(t, filepath.Join(dir, "b.log"), 50)
+	writeFile(t, filepath.Join(dir, "keep.txt"), 10)
+	writeFile(t, filepath.Join(dir, "build", "out", "bin"), 1000)
+
+	p := previewIn(t, dir, "rm -rf *.log build missing.txt")
+	if len(p.Entries) != 1 || len(p.Unsupported) != 0 {
+		t.Fatalf("unexpected preview %+v", p)
+	}
+	e := p.Entries[0]
+	if e.Operation != "rm -r" {
+		t.Errorf("unexpected operation %q", e.Operation)
+	}
+	if strings.Join(e.Paths, " ") != "a.log b.log build" {
+		t.Errorf("unexpected paths %v", e.Paths)
+	}
+	if e.Files != 3 || e.Dirs != 2 || e.Bytes != 1150 {
+		t.Errorf("unexpected counts: %d files, %d dirs, %d bytes", e.Files, e.Dirs, e.Bytes)
+	}
+	if len(e.Missing) != 1 || e.Missing[0] != "missing.txt" {
+		t.Errorf("expected missing.txt to be reported, got %v", e.Missing)
+	}
+}
+
+func TestPreviewFindDelete(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "x.tmp"), 1)
+	writeFile(t, filepath.Join(dir, "sub", "y.tmp"), 2)
+	writeFile(t, filepath.Join(dir, "sub", "deep", "z.tmp"), 4)
+	writeFile(t, filepath.Join(dir, "sub", "y.txt"), 8)
+
+	e := previewIn(t, dir, "find . -maxdepth 2 -type f -name '*.tmp' -delete").Entries
+	if len(e) != 1 || e[0].Files != 2 || e[0].Bytes != 3 {
+		t.Fatalf("unexpected preview %+v", e)
+	}
+
+	if e := previewIn(t, dir, "find . -name '*.txt'").Entries; len(e) != 0 {
+		t.Errorf("expected find without -delete to be ignored, got %+v", e)
+	}
+
+	// -path matches the path as find prints it, and * crosses directories
+	writeFile(t, filepath.Join(dir, "build", "a.o"), 16)
+	writeFile(t, filepath.Join(dir, "build", "obj", "b.o"), 32)
+	e = previewIn(t, dir, "find . -path './build/*' -delete").Entries
+	if len(e) != 1 || e[0].Files != 2 || e[0].Dirs != 1 || e[0].Bytes != 48 {
+		t.Errorf("unexpected preview of find -path %+v", e)
+	}
+	if e := previewIn(t, dir, "find build -ipath 'BUILD/*.O' -delete").Entries; len(e) != 1 || e[0].Files != 2 {
+		t.Errorf("unexpected preview of find -ipath %+v", e)
+	}
+
+	// Tests after -delete come too late to spare anything
+	e = previewIn(t, dir, "find sub -delete -name y.tmp").Entries
+	if len(e) != 1 || e[0].Files != 3 || len(e[0].Notes) != 1 || !strings.Contains(e[0].Notes[0], "-name") {
+		t.Errorf("unexpected preview of find with -delete first %+v", e)
+	}
+
+	p := previewIn(t, dir, "find . -name '*.tmp' -o -name '*.bak' -delete")
+	if len(p.Unsupported) != 1 || !strings.Contains(p.Unsupported[0], "-o") {
+		t.Errorf("expected -o to be reported as unsupported, got %+v", p)
+	}
+}
+
+func TestPreviewSedMvChmod(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.conf"), 10)
+	writeFile(t, filepath.Join(dir, "b.conf"), 20)
+	writeFile(t, filepath.Join(dir, "target"), 0)
+
+	p := previewIn(t, dir, "sed -i.bak -e 's/a/b/' *.conf && mv a.conf target && chmod -x b.conf && echo done")
+	if len(p.Entries) != 3 {
+		t.Fatalf("expected three entries, got %+v", p)
+	}
+	if e := p.Entries[0]; e.Operation != "sed -i" || e.Files != 2 || e.Bytes != 30 {
+		t.Errorf("unexpected sed entry %+v", e)
+	}
+	if e := p.Entries[1]; e.Operation != "mv → target" || len(e.Notes) != 1 || !strings.Contains(e.Notes[0], "overwritten") {
+		t.Errorf("unexpected mv entry %+v", e)
+	}
+	if e := p.Entries[2]; e.Operation != "chmod -x" || e.Files != 1 {
+		t.Errorf("unexpected chmod entry %+v", e)
+	}
+
+	p = previewIn(t, dir, "mkdir -p build && mv b.conf -t build")
+	if len(p.Entries) != 1 || p.Entries[0].Operation != "mv → build" || p.Entries[0].Files != 1 || p.Entries[0].Bytes != 20 {
+		t.Errorf("unexpected preview of mv -t %+v", p)
+	}
+}
+
+func TestPreviewUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	for _, command := range []string{
+		"rm -rf $(ls)",
+		"for f in *.log; do rm \"$f\"; done",
+	} {
+		p := previewIn(t, dir, command)
+		if len(p.Entries) != 0 || len(p.Unsupported) != 1 {
+			t.Errorf("expected %q to be reported as unsupported, got %+v", command, p)
+		}
+	}
+
+	// A command substitution outside the destructive part is fine
+	if p := previewIn(t, dir, "echo $(date) && rm -f x"); len(p.Unsupported) != 0 || len(p.Entries) != 1 {
+		t.Errorf("unexpected preview %+v", p)
+	}
+}
+
+func TestPreviewable(t *testing.T) {
+	tests := map[string]bool{
+		"rm -rf build":                  true,
+		"sudo chmod 644 /etc/hosts":     true,
+		"find . -name '*.o' -delete":    true,
+		"find . -exec rm {} +":          true,
+		"sed -Ei 's/a/b/' f":            true,
+		"ls -la | grep -i foo":          false,
+		"find . -iname '*.go'":          false,
+		"sed -e 's/i/x/' f":             false,
+		"for f in *; do mv $f x; done":  true,
+		"echo 'rm -rf /' > /dev/null":   false,
+		"git status && docker ps -a -q": false,
+	}
+	for command, want := range tests {
+		if got := Previewable(command); got != want {
+			t.Errorf("Previewable(%q) = %v, want %v", command, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// startForeground starts cmd and returns the function that waits for it. The
+// console delivers Ctrl-C to the command itself, bmh only has to survive it to
+// report the command's exit status.
+func startForeground(cmd *exec.Cmd) (func() error, error) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+
+	if err := cmd.Start(); err != nil {
+		signal.Stop(sigs)
+		return nil, err
+	}
+	return func() error {
+		err := cmd.Wait()
+		signal.Stop(sigs)
+		return err
+	}, nil
+}
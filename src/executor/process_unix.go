@@ -0,0 +1,86 @@
+//go:build unix
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startForeground starts cmd in its own process group and returns the function
+// that waits for it. When bmh runs in the foreground of a terminal the group is
+// made the terminal's foreground group, so Ctrl-C, Ctrl-\ and full screen
+// programs behave as if the shell had started the command, and the terminal is
+// handed back once it exits. The terminal is opened as /dev/tty rather than taken
+// from stdin, which may be a pipe while sudo, ssh or git still prompt on the
+// terminal. SIGINT and SIGTERM sent to bmh itself are forwarded to the whole group.
+func startForeground(cmd *exec.Cmd) (func() error, error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	// Stays open until the terminal is handed back
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	hasTTY := false
+	var ttyFd, ownPgrp int
+	if err == nil {
+		ttyFd = int(tty.Fd())
+		ownPgrp, err = unix.IoctlGetInt(ttyFd, unix.TIOCGPGRP)
+		hasTTY = err == nil && ownPgrp == unix.Getpgrp()
+		if !hasTTY {
+			tty.Close()
+		}
+	}
+	if hasTTY {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = ttyFd
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	if err := cmd.Start(); err != nil {
+		signal.Stop(sigs)
+		if hasTTY {
+			restoreForeground(ttyFd, ownPgrp)
+			tty.Close()
+		}
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				_ = syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		err := cmd.Wait()
+		signal.Stop(sigs)
+		close(done)
+		if hasTTY {
+			restoreForeground(ttyFd, ownPgrp)
+			tty.Close()
+		}
+		return err
+	}, nil
+}
+
+// restoreForeground makes pgrp the terminal's foreground group again. bmh is a
+// background process at this point, so SIGTTOU has to be ignored for the call.
+func restoreForeground(ttyFd, pgrp int) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	_ = unix.IoctlSetPointerInt(ttyFd, unix.TIOCSPGRP, pgrp)
+}
@@ -0,0 +1,321 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"baomihua/llm"
+)
+
+// Limits of the working directory copy the sandbox runs in
+const (
+	sandboxMaxFiles = 20000
+	sandboxMaxBytes = 512 * 1024 * 1024
+)
+
+// ErrSandboxUnsupported is returned on systems without a usable sandbox
+var ErrSandboxUnsupported = errors.New("sandboxed execution needs Linux with bubblewrap or unprivileged user namespaces")
+
+// ChangeKind classifies how a file differs after a sandboxed run
+type ChangeKind int
+
+const (
+	ChangeCreated ChangeKind = iota
+	ChangeModified
+	ChangeDeleted
+)
+
+// FileChange is a single entry of the sandbox diff
+type FileChange struct {
+	Path    string // Relative to the working directory, with a trailing slash for directories
+	Kind    ChangeKind
+	OldSize int64
+	NewSize int64
+}
+
+// SandboxResult is the outcome of running a command in the sandbox
+type SandboxResult struct {
+	*Execution
+	Backend string // "bubblewrap" or "namespaces"
+	Network bool
+	Changes []FileChange
+}
+
+// sandboxCheck probes for a sandbox once, the result doesn't change while bmh runs
+var sandboxCheck = sync.OnceValue(sandboxSupported)
+
+// SandboxAvailable reports whether ExecuteSandboxed can work on this system
+func SandboxAvailable() bool {
+	return sandboxCheck() == nil
+}
+
+// ExecuteSandboxed runs cmdStr over a throwaway copy of ctx.CWD and reports what it
+// created, modified and deleted there. The rest of the filesystem is read-only for
+// the command, and with network false it gets no network access. The copy is
+// removed afterwards, so nothing the command did survives.
+func ExecuteSandboxed(cmdStr string, ctx llm.EnvContext, network bool) (*SandboxResult, error) {
+	if err := sandboxCheck(); err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "bmh-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	workDir := filepath.Join(tmpDir, "work")
+	if err := copyTree(ctx.CWD, workDir); err != nil {
+		return nil, fmt.Errorf("failed to copy the working directory into the sandbox: %w", err)
+	}
+
+	cmd, backend, err := sandboxCommand(cmdStr, ctx, workDir, network)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr := captureOutput(cmd)
+
+	start := time.Now()
+	wait, err := startForeground(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the sandbox: %w", err)
+	}
+	err = wait()
+
+	res := &SandboxResult{
+		Execution: &Execution{
+			Command:  cmdStr,
+			ExitCode: ExitCode(err),
+			Duration: time.Since(start),
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+		},
+		Backend: backend,
+		Network: network,
+	}
+
+	res.Changes, err = diffTrees(ctx.CWD, workDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare the sandbox with the working directory: %w", err)
+	}
+	return res, nil
+}
+
+// copyTree copies regular files, directories and symlinks from src to dst, keeping
+// modes and modification times so untouched files compare equal afterwards
+func copyTree(src, dst string) error {
+	files := 0
+	var total int64
+	type dirMode struct {
+		path string
+		mode fs.FileMode
+	}
+	var dirs []dirMode
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files++
+		if files > sandboxMaxFiles {
+			return fmt.Errorf("the working directory has more than %d entries", sandboxMaxFiles)
+		}
+
+		switch {
+		case d.IsDir():
+			// Created writable, the original mode is applied once the content is in place
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMode{target, chmodBits(info.Mode())})
+			return nil
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			total += info.Size()
+			if total > sandboxMaxBytes {
+				return fmt.Errorf("the working directory is larger than %d MiB", sandboxMaxBytes/1024/1024)
+			}
+			if err := copyFile(path, target); err != nil {
+				return err
+			}
+			// The umask applies when the file is created, so set the mode explicitly
+			if err := os.Chmod(target, chmodBits(info.Mode())); err != nil {
+				return err
+			}
+		default:
+			// Sockets, devices and FIFOs are left out
+			return nil
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chmodBits keeps the parts of a FileMode that os.Chmod can set
+func chmodBits(mode fs.FileMode) fs.FileMode {
+	return mode & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// diffTrees compares the sandbox copy with the original working directory
+func diffTrees(orig, copy string) ([]FileChange, error) {
+	before, err := listTree(orig)
+	if err != nil {
+		return nil, err
+	}
+	after, err := listTree(copy)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	for rel, a := range after {
+		b, ok := before[rel]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: displayPath(rel, a), Kind: ChangeCreated, NewSize: a.Size()})
+		case !sameEntry(filepath.Join(orig, rel), filepath.Join(copy, rel), b, a):
+			changes = append(changes, FileChange{Path: displayPath(rel, a), Kind: ChangeModified, OldSize: b.Size(), NewSize: a.Size()})
+		}
+	}
+	for rel, b := range before {
+		if _, ok := after[rel]; !ok {
+			changes = append(changes, FileChange{Path: displayPath(rel, b), Kind: ChangeDeleted, OldSize: b.Size()})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// listTree maps every path below root (relative to it) to its FileInfo
+func listTree(root string) (map[string]fs.FileInfo, error) {
+	entries := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The sandboxed command may have left unreadable directories behind
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		entries[rel] = info
+		return nil
+	})
+	return entries, err
+}
+
+func displayPath(rel string, info fs.FileInfo) string {
+	if info.IsDir() {
+		return rel + string(filepath.Separator)
+	}
+	return rel
+}
+
+// sameEntry reports whether two entries have the same type, permissions and content
+func sameEntry(pathA, pathB string, a, b fs.FileInfo) bool {
+	if a.Mode() != b.Mode() {
+		return false
+	}
+	switch {
+	case a.IsDir():
+		return true
+	case a.Mode()&fs.ModeSymlink != 0:
+		linkA, errA := os.Readlink(pathA)
+		linkB, errB := os.Readlink(pathB)
+		return errA == nil && errB == nil && linkA == linkB
+	}
+	if a.Size() != b.Size() {
+		return false
+	}
+	if a.ModTime().Equal(b.ModTime()) {
+		return true
+	}
+	return sameContent(pathA, pathB)
+}
+
+func sameContent(pathA, pathB string) bool {
+	fa, err := os.Open(pathA)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+	fb, err := os.Open(pathB)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+
+	// The sizes are known to be equal, so both files end at the same read
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, _ := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return true
+		}
+		if errA != nil {
+			return false
+		}
+	}
+}
@@ -0,0 +1,164 @@
+//go:build linux
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"baomihua/llm"
+
+	"golang.org/x/sys/unix"
+)
+
+// SandboxChildCommand is the hidden subcommand bmh re-executes itself with inside
+// the new namespaces, see SandboxChild
+const SandboxChildCommand = "__sandbox"
+
+// sandboxSupported checks for bubblewrap, or else for working unprivileged
+// user namespaces
+func sandboxSupported() error {
+	if _, err := exec.LookPath("bwrap"); err == nil {
+		return nil
+	}
+	probe := exec.Command("/bin/true")
+	probe.SysProcAttr = namespaceAttr(false)
+	if err := probe.Run(); err != nil {
+		return fmt.Errorf("%w (creating a user namespace failed: %v)", ErrSandboxUnsupported, err)
+	}
+	return nil
+}
+
+// resolverDir keeps /etc/resolv.conf working on systemd-resolved systems, where
+// it points into /run, which the sandbox masks
+const resolverDir = "/run/systemd/resolve"
+
+// maskedEnv are variables that point the command at sockets of agents and
+// services outside the sandbox, such as the ssh agent and the session D-Bus
+var maskedEnv = []string{"SSH_AUTH_SOCK", "DBUS_SESSION_BUS_ADDRESS", "DOCKER_HOST"}
+
+// sandboxCommand wraps the shell command so it sees workDir mounted at ctx.CWD and a
+// read-only view of everything else, with a private /tmp, /run and process table.
+// Sockets below / stay usable despite the read-only mount, so the empty /run
+// hides those of docker, systemd and the user session, and maskedEnv is unset.
+func sandboxCommand(cmdStr string, ctx llm.EnvContext, workDir string, network bool) (*exec.Cmd, string, error) {
+	argv := Command(cmdStr, ctx).Args
+	env := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return slices.Contains(maskedEnv, name)
+	})
+
+	if bwrap, err := exec.LookPath("bwrap"); err == nil {
+		args := []string{
+			"--ro-bind", "/", "/",
+			"--dev", "/dev",
+			"--proc", "/proc",
+			"--tmpfs", "/tmp",
+			"--tmpfs", "/run",
+			"--ro-bind-try", resolverDir, resolverDir,
+			"--bind", workDir, ctx.CWD,
+			"--chdir", ctx.CWD,
+			"--unshare-pid",
+			"--die-with-parent",
+		}
+		if !network {
+			args = append(args, "--unshare-net")
+		}
+		args = append(append(args, "--"), argv...)
+		cmd := exec.Command(bwrap, args...)
+		cmd.Env = env
+		return cmd, "bubblewrap", nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, "", err
+	}
+	cmd := exec.Command(exe, append([]string{SandboxChildCommand, workDir, ctx.CWD, "--"}, argv...)...)
+	cmd.SysProcAttr = namespaceAttr(!network)
+	cmd.Env = env
+	return cmd, "namespaces", nil
+}
+
+// namespaceAttr starts a process in new user, mount and PID namespaces, mapped to
+// the current user, and optionally in an empty network namespace
+func namespaceAttr(isolateNetwork bool) *syscall.SysProcAttr {
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if isolateNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	return &syscall.SysProcAttr{
+		Cloneflags:  uintptr(flags),
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+	}
+}
+
+// SandboxChild runs inside the namespaces created by sandboxCommand. args are the
+// work directory, the directory to mount it on, "--" and the command to run.
+// It makes the whole filesystem read-only, mounts a fresh /tmp, /run and /proc,
+// attaches the work directory copy writable over the original one and runs the
+// command, returning its exit code.
+func SandboxChild(args []string) (int, error) {
+	if len(args) < 4 || args[2] != "--" {
+		return 0, errors.New("usage: bmh " + SandboxChildCommand + " <work-dir> <cwd> -- <command...>")
+	}
+	workDir, cwd, argv := args[0], args[1], args[3:]
+
+	// Keep every mount change inside this namespace
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return 0, fmt.Errorf("making mounts private: %w", err)
+	}
+
+	// Detach a writable clone of the work directory before everything turns read-only,
+	// it is attached again once /tmp (where it may live) is covered by the new tmpfs
+	fd, err := unix.OpenTree(unix.AT_FDCWD, workDir, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC)
+	if err != nil {
+		return 0, fmt.Errorf("cloning the work directory mount: %w", err)
+	}
+	resolverFd, resolverErr := unix.OpenTree(unix.AT_FDCWD, resolverDir, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC|unix.AT_RECURSIVE)
+
+	if err := unix.MountSetattr(-1, "/", unix.AT_RECURSIVE, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return 0, fmt.Errorf("making the filesystem read-only: %w", err)
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return 0, fmt.Errorf("mounting /tmp: %w", err)
+	}
+	// Hides the sockets of docker, systemd and the user session
+	if err := unix.Mount("tmpfs", "/run", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return 0, fmt.Errorf("mounting /run: %w", err)
+	}
+	if resolverErr == nil {
+		os.MkdirAll(resolverDir, 0755)
+		unix.MoveMount(resolverFd, "", unix.AT_FDCWD, resolverDir, unix.MOVE_MOUNT_F_EMPTY_PATH)
+	}
+	// This process is the first of the new PID namespace, so a fresh /proc only
+	// lists what runs in the sandbox
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return 0, fmt.Errorf("mounting /proc: %w", err)
+	}
+
+	// Only possible below the fresh /tmp and /run, elsewhere the directory already exists
+	os.MkdirAll(cwd, 0755)
+	if err := unix.MoveMount(fd, "", unix.AT_FDCWD, cwd, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+		return 0, fmt.Errorf("mounting the work directory: %w", err)
+	}
+
+	if err := os.Chdir(cwd); err != nil {
+		return 0, err
+	}
+
+	// As init of the namespace this process would ignore Ctrl-C in place of the
+	// command, so the command runs as its child. The signals reach the command
+	// through the process group, and everything it leaves behind ends with init.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return ExitCode(cmd.Run()), nil
+}
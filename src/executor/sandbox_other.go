@@ -0,0 +1,25 @@
+//go:build !linux
+
+package executor
+
+import (
+	"os/exec"
+
+	"baomihua/llm"
+)
+
+// SandboxChildCommand is the hidden subcommand used by the Linux sandbox
+const SandboxChildCommand = "__sandbox"
+
+func sandboxSupported() error {
+	return ErrSandboxUnsupported
+}
+
+func sandboxCommand(cmdStr string, ctx llm.EnvContext, workDir string, network bool) (*exec.Cmd, string, error) {
+	return nil, "", ErrSandboxUnsupported
+}
+
+// SandboxChild is only used on Linux
+func SandboxChild(args []string) (int, error) {
+	return 0, ErrSandboxUnsupported
+}
@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyTreeAndDiff(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "keep.txt"), 10)
+	writeFile(t, filepath.Join(src, "edit.txt"), 10)
+	writeFile(t, filepath.Join(src, "old", "gone.txt"), 5)
+	if err := os.Chmod(filepath.Join(src, "keep.txt"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("keep.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "work")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if changes, err := diffTrees(src, dst); err != nil || len(changes) != 0 {
+		t.Fatalf("expected a faithful copy, got %+v (%v)", changes, err)
+	}
+
+	// Same size, different content
+	if err := os.WriteFile(filepath.Join(dst, "edit.txt"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dst, "new.txt"), 3)
+	if err := os.RemoveAll(filepath.Join(dst, "old")); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := diffTrees(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileChange{
+		{Path: "edit.txt", Kind: ChangeModified, OldSize: 10, NewSize: 10},
+		{Path: "new.txt", Kind: ChangeCreated, NewSize: 3},
+		{Path: "old" + string(filepath.Separator), Kind: ChangeDeleted},
+		{Path: filepath.Join("old", "gone.txt"), Kind: ChangeDeleted, OldSize: 5},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i := range want {
+		got := changes[i]
+		if got.Path != want[i].Path || got.Kind != want[i].Kind || (got.Kind != ChangeDeleted && got.NewSize != want[i].NewSize) {
+			t.Errorf("change %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package guard
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// AutoExecutable reports whether command may run without asking the user first.
+// It has to be Safe, and every simple command in it (joined by &&, || and |)
+// must start with the words of an allowlist entry, e.g. "git status" allows
+// "git status -s" but not "git push", and ./ls is not ls. Commands run through
+// wrappers such as env or sudo, with variable assignments, redirections or
+// substitutions are refused, as are the options with which a listed command
+// changes something, like date -s. When auto-run is refused, the reason says why.
+func AutoExecutable(command string, allow []string) (bool, string) {
+	if strings.TrimSpace(command) == "" {
+		return false, "the command is empty"
+	}
+	if v := Check(command); v.Level != Safe {
+		return false, fmt.Sprintf("the safety guard rated it %s: %s", v.Level, v.Reason)
+	}
+
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return false, "it isn't a plain shell command the allowlist can vet"
+	}
+	var calls []*syntax.Stmt
+	for _, stmt := range file.Stmts {
+		var reason string
+		if calls, reason = simpleCommands(stmt, calls); reason != "" {
+			return false, reason
+		}
+	}
+
+	for _, stmt := range calls {
+		call := stmt.Cmd.(*syntax.CallExpr)
+		if len(call.Assigns) > 0 {
+			return false, fmt.Sprintf("it sets %s for the command", call.Assigns[0].Name.Value)
+		}
+		if len(call.Args) == 0 {
+			continue
+		}
+		if reason := expansions(call); reason != "" {
+			return false, reason
+		}
+		words, wrapped := callWords(stmt)
+		if wrapped > 0 {
+			return false, fmt.Sprintf("it runs a command through %s", commandName(wordText(call.Args[0])))
+		}
+		args := make([]string, len(words))
+		for i, w := range words {
+			args[i] = w.text
+		}
+		if !matchesAllowlist(args, allow) {
+			return false, fmt.Sprintf("'%s' is not in the auto-execute allowlist", args[0])
+		}
+		if !readOnly(args) {
+			return false, fmt.Sprintf("'%s' is run with options that change something", strings.Join(args, " "))
+		}
+	}
+	return true, ""
+}
+
+// simpleCommands collects the simple commands of a list or pipeline. The reason
+// is set for anything else, such as a redirection, a subshell or a loop, which a
+// prefix allowlist can't vet.
+func simpleCommands(stmt *syntax.Stmt, calls []*syntax.Stmt) ([]*syntax.Stmt, string) {
+	switch {
+	case stmt.Background || stmt.Coprocess:
+		return calls, "it runs in the background"
+	case len(stmt.Redirs) > 0:
+		return calls, "it redirects input or output, which the allowlist cannot vet"
+	}
+	switch c := stmt.Cmd.(type) {
+	case *syntax.CallExpr:
+		return append(calls, stmt), ""
+	case *syntax.BinaryCmd:
+		calls, reason := simpleCommands(c.X, calls)
+		if reason != "" {
+			return calls, reason
+		}
+		return simpleCommands(c.Y, calls)
+	}
+	return calls, "it isn't a list of simple commands, which the allowlist cannot vet"
+}
+
+// expansions returns why the arguments of call can't be vetted: substitutions
+// and arithmetic run or compute something the allowlist can't see
+func expansions(call *syntax.CallExpr) string {
+	reason := ""
+	for _, arg := range call.Args {
+		syntax.Walk(arg, func(node syntax.Node) bool {
+			switch node.(type) {
+			case *syntax.CmdSubst, *syntax.ProcSubst:
+				reason = "it contains a command substitution, which the allowlist cannot vet"
+			case *syntax.ArithmExp:
+				reason = "it contains arithmetic, which the allowlist cannot vet"
+			}
+			return reason == ""
+		})
+	}
+	return reason
+}
+
+// matchesAllowlist reports whether the words of a simple command start with
+// the words of any allowlist entry. The command has to be the bare name as
+// listed, so ./ls or /tmp/x/ps, which could be a file a repository dropped,
+// doesn't pass for ls or ps.
+func matchesAllowlist(words []string, allow []string) bool {
+	if strings.ContainsAny(words[0], `/\`) {
+		return false
+	}
+	for _, entry := range allow {
+		entryWords := strings.Fields(entry)
+		if len(entryWords) == 0 || len(entryWords) > len(words) {
+			continue
+		}
+		if slices.Equal(entryWords, words[:len(entryWords)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// branchListOptions are the options of git branch that only list branches
+var branchListOptions = []string{
+	"-a", "--all", "-r", "--remotes", "-l", "--list", "-v", "-vv", "--verbose",
+	"--show-current", "--contains", "--no-contains", "--merged", "--no-merged",
+	"--points-at", "--sort", "--format", "--color", "--no-color", "--column",
+	"--no-column", "-i", "--ignore-case", "--abbrev", "--no-abbrev",
+}
+
+// branchValueOptions are those of branchListOptions that take a value
+var branchValueOptions = []string{"--contains", "--no-contains", "--merged", "--no-merged", "--points-at", "--sort", "--format"}
+
+// gitRunOptions make git run a program or change its configuration, which
+// turns any git command into one that can do anything
+var gitRunOptions = []string{"-c", "--config", "--config-env", "--ext-diff", "--textconv", "--exec-path", "--upload-pack", "--receive-pack"}
+
+// dateShowOptions are the options of date that only print a date
+var dateShowOptions = []string{
+	"-u", "--utc", "--universal", "-R", "--rfc-email", "-d", "--date",
+	"-r", "--reference", "-I", "--iso-8601", "--rfc-3339", "--debug",
+}
+
+// readOnly reports whether a command that is read-only in its usual form, but
+// can also change something, is run in the usual form: git branch only lists,
+// git log, diff and show don't write --output files, no git command runs an
+// external diff or textconv program or is given config, and date doesn't set
+// the clock. The options are an allowlist where there are few read-only ones.
+func readOnly(words []string) bool {
+	name := commandName(words[0])
+	args := words[1:]
+	if name == "git" {
+		for _, arg := range args {
+			if arg == "--" {
+				break
+			}
+			opt, _, _ := strings.Cut(arg, "=")
+			if slices.Contains(gitRunOptions, opt) {
+				return false
+			}
+		}
+	}
+	switch {
+	case name == "date":
+		for i := 0; i < len(args); i++ {
+			opt, _, _ := strings.Cut(args[i], "=")
+			switch {
+			case strings.HasPrefix(args[i], "+"):
+			case strings.HasPrefix(opt, "-I"):
+			case slices.Contains(dateShowOptions, opt):
+				if (opt == "-d" || opt == "--date" || opt == "-r" || opt == "--reference") && opt == args[i] {
+					i++
+				}
+			default:
+				// -s, --set and an MMDDhhmm operand set the clock
+				return false
+			}
+		}
+	case name == "git" && len(args) > 0 && args[0] == "branch":
+		list := hasArg(args, "-l", "--list")
+		for i := 1; i < len(args); i++ {
+			arg := args[i]
+			opt, _, _ := strings.Cut(arg, "=")
+			switch {
+			case slices.Contains(branchListOptions, opt):
+				if slices.Contains(branchValueOptions, arg) && i+1 < len(args) {
+					i++
+				}
+			case !strings.HasPrefix(arg, "-"):
+				// Without --list an operand names a branch to create
+				if !list {
+					return false
+				}
+			default:
+				return false
+			}
+		}
+	case name == "git" && len(args) > 0 && slices.Contains([]string{"log", "diff", "show", "whatchanged"}, args[0]):
+		for _, arg := range args[1:] {
+			if arg == "--" {
+				break
+			}
+			if arg == "--output" || strings.HasPrefix(arg, "--output=") {
+				return false
+			}
+		}
+	}
+	return true
+}
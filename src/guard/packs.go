@@ -0,0 +1,317 @@
+package guard
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Packs are the opt-in rule packs for tools whose destructive commands are
+// everyday work elsewhere, such as git push --force or kubectl delete
+var Packs = []string{"git", "k8s", "terraform", "docker", "sql", "cloud"}
+
+// packCommands maps the commands each pack checks to the pack
+var packCommands = map[string]string{
+	"git":     "git",
+	"kubectl": "k8s", "oc": "k8s", "helm": "k8s",
+	"terraform": "terraform", "tofu": "terraform", "terragrunt": "terraform",
+	"docker": "docker", "podman": "docker", "docker-compose": "docker", "podman-compose": "docker",
+	"psql": "sql", "mysql": "sql", "mariadb": "sql", "sqlite3": "sql", "sqlcmd": "sql",
+	"clickhouse-client": "sql", "mongosh": "sql", "mongo": "sql", "redis-cli": "sql",
+	"aws": "cloud", "gcloud": "cloud", "gsutil": "cloud", "az": "cloud",
+}
+
+// enabledPacks are the packs turned on in the configuration. Policy files can
+// turn on more.
+var enabledPacks []string
+
+// packKubeContext caches the kube-context for the packs when there is no policy
+// to cache it
+var packKubeContext = sync.OnceValue(kubeContext)
+
+// SetPacks turns on the named rule packs for Check. Unknown names are reported
+// and skipped.
+func SetPacks(names []string) error {
+	enabledPacks = nil
+	packKubeContext = sync.OnceValue(kubeContext)
+	var unknown []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(Packs, name) {
+			unknown = append(unknown, name)
+			continue
+		}
+		enabledPacks = append(enabledPacks, name)
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown guard rule packs %s (known: %s)", strings.Join(unknown, ", "), strings.Join(Packs, ", "))
+	}
+	return nil
+}
+
+// EnabledPacks returns the packs that apply, from the configuration and the
+// policy files
+func EnabledPacks() []string {
+	var names []string
+	for _, name := range Packs {
+		if packEnabled(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func packEnabled(name string) bool {
+	return slices.Contains(enabledPacks, name) || policy != nil && slices.Contains(policy.Packs, name)
+}
+
+// currentKubeContext is the kube-context kubectl and helm use, read once and
+// shared with the kube-context conditions of the policy
+func currentKubeContext() string {
+	if policy != nil {
+		return policy.context()
+	}
+	return packKubeContext()
+}
+
+// checkPacks runs the rule pack of the command named name, if it is turned on.
+// Relative paths such as git -C are resolved against dir.
+func checkPacks(name string, words []word, dir string) Verdict {
+	pack := packCommands[name]
+	if pack == "" || !packEnabled(pack) {
+		return Verdict{Level: Safe}
+	}
+	args := make([]string, 0, len(words)-1)
+	for _, w := range words[1:] {
+		args = append(args, w.text)
+	}
+	c := packCall{name: name, args: args, dir: dir, span: Span{words[0].span.Start, words[len(words)-1].span.End}}
+
+	switch pack {
+	case "git":
+		return c.checkGit()
+	case "k8s":
+		return c.checkKube()
+	case "terraform":
+		return c.checkTerraform()
+	case "docker":
+		return c.checkDocker()
+	case "sql":
+		return c.checkSQL()
+	case "cloud":
+		return c.checkCloud()
+	}
+	return Verdict{Level: Safe}
+}
+
+// packCall is a command checked by a rule pack
+type packCall struct {
+	name  string
+	args  []string
+	dir   string
+	span  Span
+	stdin string // What is fed to the command's standard input, if it can be told
+}
+
+func (c packCall) verdict(level Level, rule, reason string) Verdict {
+	return Verdict{Level: level, RuleID: rule, Reason: reason, Span: c.span}
+}
+
+// inContext is verdict for commands that matter more in production. The target,
+// the kube-context, workspace, profile or project the command acts on, is named
+// after the reason, and Caution becomes Danger when it looks like production.
+func (c packCall) inContext(level Level, rule, reason, kind, target string) Verdict {
+	if target == "" {
+		return c.verdict(level, rule, reason)
+	}
+	where := kind + " " + target
+	if level == Caution && isProduction(target) {
+		level = Danger
+		where += ", which looks like production"
+	}
+	return c.verdict(level, rule, reason+" ("+where+")")
+}
+
+// production matches names of production environments, e.g. prod-eu or gke_x_live
+var production = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:prod|production|prd|live)(?:[^a-z0-9]|$)`)
+
+func isProduction(name string) bool {
+	return production.MatchString(name)
+}
+
+// isProtectedBranch reports whether a branch is shared and shouldn't be rewritten
+func isProtectedBranch(branch string) bool {
+	branch = strings.TrimPrefix(branch, "refs/heads/")
+	switch branch {
+	case "main", "master", "trunk", "develop", "production", "prod", "stable":
+		return true
+	}
+	return strings.HasPrefix(branch, "release/") || strings.HasPrefix(branch, "release-")
+}
+
+// operands returns the arguments that aren't options, skipping the value of
+// the options in valueOpts
+func operands(args []string, valueOpts ...string) []string {
+	var ops []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(ops, args[i+1:]...)
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			if slices.Contains(valueOpts, arg) {
+				i++
+			}
+			continue
+		}
+		ops = append(ops, arg)
+	}
+	return ops
+}
+
+// optValue returns the value of the first of the options names that is given,
+// as --name value, --name=value or -n value
+func optValue(args []string, names ...string) string {
+	for i, arg := range args {
+		for _, name := range names {
+			if arg == name && i+1 < len(args) {
+				return args[i+1]
+			}
+			if v, ok := strings.CutPrefix(arg, name+"="); ok && strings.HasPrefix(name, "--") {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// hasArg reports whether one of the arguments is exactly one of names
+func hasArg(args []string, names ...string) bool {
+	return slices.ContainsFunc(args, func(arg string) bool {
+		return slices.Contains(names, arg)
+	})
+}
+
+// checkGit covers commands that rewrite shared history or throw away work that
+// isn't committed anywhere
+func (c packCall) checkGit() Verdict {
+	// Global options come before the subcommand
+	args, dir := c.args, c.dir
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch {
+		case args[0] == "-C" && len(args) > 1:
+			if p, ok := resolvePath(args[1], dir); ok {
+				dir = p
+			}
+			args = args[1:]
+		case args[0] == "-c" && len(args) > 1:
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return Verdict{Level: Safe}
+	}
+	sub, args := args[0], args[1:]
+	flags, ops := splitArgs(args)
+
+	switch sub {
+	case "push":
+		if hasArg(flags, "--mirror") {
+			return c.verdict(Danger, "git-push-mirror", "makes the remote an exact copy of this repository, overwriting and deleting its branches")
+		}
+		force := hasFlag(flags, "f", "force")
+		lease := slices.ContainsFunc(flags, func(f string) bool { return strings.HasPrefix(f, "--force-with-lease") })
+		remove := hasFlag(flags, "d", "delete")
+		ops = operands(args, "-o", "--push-option", "--repo", "--receive-pack", "--exec")
+		var targets []string
+		if len(ops) > 1 {
+			for _, ref := range ops[1:] {
+				if strings.HasPrefix(ref, "+") {
+					force = true
+					ref = ref[1:]
+				}
+				src, dst, mapped := strings.Cut(ref, ":")
+				if mapped && src == "" {
+					remove = true
+				}
+				if !mapped {
+					dst = src
+				}
+				if dst == "HEAD" {
+					dst = gitBranch(dir)
+				}
+				targets = append(targets, strings.TrimPrefix(dst, "refs/heads/"))
+			}
+		} else {
+			targets = []string{gitBranch(dir)}
+		}
+		branch := targets[0]
+		for _, t := range targets {
+			if isProtectedBranch(t) {
+				branch = t
+			}
+		}
+
+		switch {
+		case remove && isProtectedBranch(branch):
+			return c.verdict(Danger, "git-push-delete", "deletes the protected branch "+branch+" on the remote")
+		case remove:
+			return c.verdict(Caution, "git-push-delete", "deletes branches on the remote")
+		case (force || lease) && isProtectedBranch(branch):
+			return c.verdict(Danger, "git-force-push", "force-pushes to the protected branch "+branch+", rewriting history others have pulled")
+		case force || lease:
+			reason := "force-pushes, overwriting the remote's history"
+			if branch != "" {
+				reason = "force-pushes to " + branch + ", overwriting the remote's history"
+			}
+			return c.verdict(Caution, "git-force-push", reason)
+		}
+	case "reset":
+		if hasArg(flags, "--hard") {
+			return c.verdict(Caution, "git-reset-hard", "throws away all uncommitted changes")
+		}
+	case "clean":
+		if hasFlag(flags, "f", "force") && !hasFlag(flags, "n", "dry-run") {
+			reason := "deletes untracked files"
+			if hasFlag(flags, "xX") {
+				reason = "deletes untracked and ignored files, including local config such as .env"
+			}
+			return c.verdict(Caution, "git-clean", reason)
+		}
+	case "checkout", "restore":
+		discards := hasFlag(flags, "f", "force") || hasArg(args, "--") || hasArg(ops, ".")
+		if sub == "restore" {
+			discards = !hasFlag(flags, "S", "staged") || hasFlag(flags, "W", "worktree")
+		}
+		if discards {
+			return c.verdict(Caution, "git-discard-changes", "throws away uncommitted changes to the files")
+		}
+	case "branch":
+		if hasArg(flags, "-D") || hasFlag(flags, "d", "delete") && hasFlag(flags, "f", "force") {
+			for _, b := range ops {
+				if isProtectedBranch(b) {
+					return c.verdict(Danger, "git-branch-delete", "force-deletes the protected branch "+b)
+				}
+			}
+			return c.verdict(Caution, "git-branch-delete", "deletes branches even if they were never merged")
+		}
+	case "stash":
+		if len(ops) > 0 && (ops[0] == "clear" || ops[0] == "drop") {
+			return c.verdict(Caution, "git-stash-drop", "deletes stashed changes")
+		}
+	case "filter-branch", "filter-repo":
+		return c.verdict(Caution, "git-rewrite-history", "rewrites the history of the repository")
+	case "reflog":
+		if len(ops) > 0 && ops[0] == "expire" {
+			return c.verdict(Caution, "git-expire-reflog", "drops the reflog, which is how lost commits are recovered")
+		}
+	case "gc":
+		if hasArg(flags, "--prune=now", "--prune=all") {
+			return c.verdict(Caution, "git-expire-reflog", "deletes unreachable commits for good")
+		}
+	}
+	return Verdict{Level: Safe}
+}
@@ -0,0 +1,280 @@
+package guard
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// terraformWorkspace returns the workspace terraform uses in dir
+func terraformWorkspace(dir string) string {
+	if ws := os.Getenv("TF_WORKSPACE"); ws != "" {
+		return ws
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".terraform", "environment"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// checkTerraform covers destroying infrastructure and changing it unattended
+func (c packCall) checkTerraform() Verdict {
+	args, dir := c.args, c.dir
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if d, ok := strings.CutPrefix(args[0], "-chdir="); ok {
+			if p, ok := resolvePath(d, dir); ok {
+				dir = p
+			}
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return Verdict{Level: Safe}
+	}
+	sub, args := args[0], args[1:]
+	if c.name == "terragrunt" && (sub == "run-all" || sub == "run") && len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	workspace := terraformWorkspace(dir)
+
+	switch sub {
+	case "destroy":
+		return c.inContext(Danger, "terraform-destroy", "destroys all resources managed by this configuration", "workspace", workspace)
+	case "apply":
+		if hasArg(args, "-destroy", "--destroy") {
+			return c.inContext(Danger, "terraform-destroy", "destroys all resources managed by this configuration", "workspace", workspace)
+		}
+		if hasArg(args, "-auto-approve", "--auto-approve") {
+			return c.inContext(Caution, "terraform-auto-approve", "changes infrastructure without showing the plan first", "workspace", workspace)
+		}
+		if isProduction(workspace) {
+			return c.inContext(Caution, "terraform-apply", "changes infrastructure", "workspace", workspace)
+		}
+	case "state":
+		if ops := operands(args); len(ops) > 0 && (ops[0] == "rm" || ops[0] == "push" || ops[0] == "replace-provider") {
+			return c.inContext(Caution, "terraform-state", "edits the state, which can orphan or duplicate real resources", "workspace", workspace)
+		}
+	case "force-unlock":
+		return c.inContext(Caution, "terraform-force-unlock", "removes the state lock, which can corrupt the state if someone else is applying", "workspace", workspace)
+	case "workspace":
+		if ops := operands(args); len(ops) > 1 && ops[0] == "delete" {
+			return c.inContext(Caution, "terraform-workspace-delete", "deletes the workspace and forgets its resources", "workspace", ops[1])
+		}
+	}
+	return Verdict{Level: Safe}
+}
+
+// checkDocker covers prunes and removals that take volumes, and with them
+// database files and other state, along
+func (c packCall) checkDocker() Verdict {
+	args := operands(c.args, "-H", "--host", "--context", "-c", "--config", "-l", "--log-level")
+	if c.name == "docker-compose" || c.name == "podman-compose" {
+		args = append([]string{"compose"}, c.args...)
+	}
+	if len(args) == 0 {
+		return Verdict{Level: Safe}
+	}
+	// The flags of the subcommand
+	var flags []string
+	if i := slices.Index(c.args, args[0]); i >= 0 {
+		flags, _ = splitArgs(c.args[i+1:])
+	}
+
+	switch args[0] {
+	case "system":
+		if len(args) > 1 && args[1] == "prune" {
+			if hasArg(flags, "--volumes") {
+				return c.verdict(Danger, "docker-prune-volumes", "deletes all unused volumes and the data in them, along with stopped containers and images")
+			}
+			return c.verdict(Caution, "docker-system-prune", "deletes stopped containers, unused networks and images")
+		}
+	case "volume":
+		if len(args) > 1 && args[1] == "prune" {
+			if hasFlag(flags, "a", "all") {
+				return c.verdict(Danger, "docker-volume-prune", "deletes all unused volumes and the data in them")
+			}
+			return c.verdict(Caution, "docker-volume-prune", "deletes unused anonymous volumes and the data in them")
+		}
+		if len(args) > 1 && (args[1] == "rm" || args[1] == "remove") {
+			return c.verdict(Caution, "docker-volume-rm", "deletes volumes and the data in them")
+		}
+	case "compose":
+		sub := operands(args[1:], "-f", "--file", "-p", "--project-name", "--env-file", "--profile", "--project-directory")
+		if len(sub) > 0 && sub[0] == "down" && hasFlag(flags, "v", "volumes") {
+			return c.verdict(Danger, "docker-compose-down-volumes", "deletes the project's volumes and the data in them")
+		}
+	case "rm", "rmi", "container", "image":
+		if slices.ContainsFunc(args[1:], func(a string) bool { return strings.Contains(a, "$(") }) {
+			return c.verdict(Caution, "docker-rm-all", "removes every container or image a command lists")
+		}
+		if (args[0] == "image" || args[0] == "container") && len(args) > 1 && args[1] == "prune" && hasFlag(flags, "a", "all") {
+			return c.verdict(Caution, "docker-image-prune", "deletes every image not used by a container")
+		}
+	}
+	return Verdict{Level: Safe}
+}
+
+// kubeValueOpts are the kubectl options that take a separate value
+var kubeValueOpts = []string{
+	"-n", "--namespace", "--context", "--kubeconfig", "--cluster", "--user", "-l", "--selector",
+	"-f", "--filename", "-o", "--output", "-c", "--container", "--field-selector", "--grace-period", "--timeout", "-s", "--server",
+}
+
+// checkKube covers deleting namespaces and workloads, draining nodes and
+// uninstalling releases, and is stricter in production contexts
+func (c packCall) checkKube() Verdict {
+	if c.name == "helm" {
+		return c.checkHelm()
+	}
+	ctx := contextFlag(c.args)
+	if ctx == "" {
+		ctx = currentKubeContext()
+	}
+	ops := operands(c.args, kubeValueOpts...)
+	if len(ops) == 0 {
+		return Verdict{Level: Safe}
+	}
+	all := hasArg(c.args, "--all", "-A", "--all-namespaces")
+
+	switch ops[0] {
+	case "delete":
+		resource := ""
+		if len(ops) > 1 {
+			resource, _, _ = strings.Cut(strings.ToLower(ops[1]), "/")
+		}
+		switch {
+		case resource == "namespace" || resource == "namespaces" || resource == "ns":
+			what := "namespace"
+			if len(ops) > 2 {
+				what += " " + strings.Join(ops[2:], " ")
+			} else if _, name, ok := strings.Cut(ops[1], "/"); ok {
+				what += " " + name
+			}
+			return c.inContext(Danger, "k8s-delete-namespace", "deletes the "+what+" and everything in it", "kube-context", ctx)
+		case all:
+			what := "all resources"
+			if resource != "" {
+				what += " of type " + resource
+			}
+			return c.inContext(Danger, "k8s-delete-all", "deletes "+what+" it finds", "kube-context", ctx)
+		case resource == "pv" || strings.HasPrefix(resource, "persistentvolume") || resource == "pvc" || resource == "crd" || strings.HasPrefix(resource, "customresourcedefinition"):
+			return c.inContext(Danger, "k8s-delete-storage", "deletes "+resource+" objects, and with them data or every custom resource of the kind", "kube-context", ctx)
+		default:
+			return c.inContext(Caution, "k8s-delete", "deletes Kubernetes resources", "kube-context", ctx)
+		}
+	case "drain":
+		return c.inContext(Caution, "k8s-drain", "evicts every pod from the node", "kube-context", ctx)
+	case "cordon", "taint":
+		return c.inContext(Caution, "k8s-cordon", "stops pods from being scheduled on the node", "kube-context", ctx)
+	case "scale":
+		if replicas := optValue(c.args, "--replicas"); replicas == "0" {
+			return c.inContext(Caution, "k8s-scale-zero", "scales the workload down to no pods", "kube-context", ctx)
+		}
+	case "replace", "apply":
+		if hasArg(c.args, "--force") || slices.ContainsFunc(c.args, func(a string) bool { return strings.HasPrefix(a, "--prune") }) {
+			return c.inContext(Caution, "k8s-force-apply", "deletes and recreates resources or prunes the ones missing from the manifests", "kube-context", ctx)
+		}
+		if isProduction(ctx) {
+			return c.inContext(Caution, "k8s-apply", "changes resources", "kube-context", ctx)
+		}
+	}
+	return Verdict{Level: Safe}
+}
+
+// checkHelm covers uninstalling and rolling back releases
+func (c packCall) checkHelm() Verdict {
+	ctx := optValue(c.args, "--kube-context")
+	if ctx == "" {
+		ctx = currentKubeContext()
+	}
+	ops := operands(c.args, "-n", "--namespace", "--kube-context", "--kubeconfig", "-f", "--values", "--set", "--version", "--timeout")
+	if len(ops) == 0 {
+		return Verdict{Level: Safe}
+	}
+	switch ops[0] {
+	case "uninstall", "delete", "del", "un":
+		release := "releases"
+		if len(ops) > 1 {
+			release = "the release " + strings.Join(ops[1:], " ")
+		}
+		return c.inContext(Caution, "helm-uninstall", "uninstalls "+release+" with all of its resources", "kube-context", ctx)
+	case "rollback":
+		return c.inContext(Caution, "helm-rollback", "rolls a release back to an older revision", "kube-context", ctx)
+	}
+	return Verdict{Level: Safe}
+}
+
+// awsValueOpts are the global aws options that take a separate value
+var awsValueOpts = []string{"--profile", "--region", "--output", "--endpoint-url", "--query", "--cli-input-json", "--ca-bundle", "--color"}
+
+// checkCloud covers deleting buckets, instances, databases and whole projects
+// with the AWS, Google Cloud and Azure CLIs, and is stricter for production
+// profiles, projects and subscriptions
+func (c packCall) checkCloud() Verdict {
+	flags, _ := splitArgs(c.args)
+	switch c.name {
+	case "aws":
+		profile := optValue(c.args, "--profile")
+		if profile == "" {
+			profile = cmp.Or(os.Getenv("AWS_PROFILE"), os.Getenv("AWS_DEFAULT_PROFILE"))
+		}
+		ops := operands(c.args, awsValueOpts...)
+		if len(ops) < 2 {
+			return Verdict{Level: Safe}
+		}
+		service, op := ops[0], ops[1]
+		switch {
+		case service == "s3" && op == "rm" && hasArg(c.args, "--recursive"):
+			return c.inContext(Danger, "aws-s3-rm-recursive", "deletes every object under the prefix", "profile", profile)
+		case service == "s3" && op == "rb" && hasArg(c.args, "--force"):
+			return c.inContext(Danger, "aws-s3-rb", "deletes the bucket together with all of its objects", "profile", profile)
+		case service == "s3" && op == "sync" && hasArg(c.args, "--delete"):
+			return c.inContext(Caution, "aws-s3-sync-delete", "deletes files at the destination that are missing from the source", "profile", profile)
+		case service == "s3api" && op == "delete-bucket",
+			service == "ec2" && op == "terminate-instances",
+			service == "rds" && (op == "delete-db-instance" || op == "delete-db-cluster"),
+			service == "dynamodb" && op == "delete-table",
+			service == "cloudformation" && op == "delete-stack",
+			service == "eks" && op == "delete-cluster":
+			return c.inContext(Danger, "aws-delete", "runs "+service+" "+op+", which can't be undone", "profile", profile)
+		case strings.HasPrefix(op, "delete-") || strings.HasPrefix(op, "terminate-") || strings.HasPrefix(op, "remove-"):
+			return c.inContext(Caution, "aws-delete", "runs "+service+" "+op, "profile", profile)
+		}
+	case "gcloud":
+		project := cmp.Or(optValue(c.args, "--project"), os.Getenv("CLOUDSDK_CORE_PROJECT"))
+		ops := operands(c.args, "--project", "--account", "--configuration", "--zone", "--region", "--format", "--filter", "--impersonate-service-account")
+		i := slices.Index(ops, "delete")
+		if i < 0 {
+			if len(ops) > 1 && ops[0] == "storage" && ops[1] == "rm" && hasFlag(flags, "r", "recursive") {
+				return c.inContext(Danger, "gcloud-storage-rm-recursive", "deletes every object under the path", "project", project)
+			}
+			return Verdict{Level: Safe}
+		}
+		group := strings.Join(ops[:i], " ")
+		switch group {
+		case "projects", "sql instances", "container clusters", "storage buckets", "spanner instances", "bigtable instances", "firestore databases":
+			return c.inContext(Danger, "gcloud-delete", "deletes "+group+" with all of their data", "project", project)
+		}
+		return c.inContext(Caution, "gcloud-delete", "deletes "+group, "project", project)
+	case "gsutil":
+		ops := operands(c.args, "-o", "-h", "-p")
+		if len(ops) > 0 && (ops[0] == "rm" && hasFlag(flags, "rR", "recursive") || ops[0] == "rb") {
+			return c.verdict(Danger, "gsutil-rm-recursive", "deletes buckets or every object under the path")
+		}
+	case "az":
+		subscription := optValue(c.args, "--subscription")
+		ops := operands(c.args, "--subscription", "-g", "--resource-group", "-n", "--name", "-o", "--output", "--query")
+		switch {
+		case len(ops) > 1 && ops[0] == "group" && ops[1] == "delete":
+			return c.inContext(Danger, "az-group-delete", "deletes the resource group and every resource in it", "subscription", subscription)
+		case slices.Contains(ops, "delete-batch"):
+			return c.inContext(Danger, "az-delete", "deletes every blob that matches", "subscription", subscription)
+		case slices.Contains(ops, "delete"):
+			return c.inContext(Caution, "az-delete", "deletes "+strings.Join(ops[:slices.Index(ops, "delete")], " "), "subscription", subscription)
+		}
+	}
+	return Verdict{Level: Safe}
+}
@@ -0,0 +1,161 @@
+package guard
+
+import (
+	"regexp"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// sqlRules match destructive statements, checked in order. A statement that
+// also matches unless, such as a DELETE with a WHERE clause, is fine.
+var sqlRules = []struct {
+	re, unless *regexp.Regexp
+	level      Level
+	id         string
+	reason     string
+}{
+	{regexp.MustCompile(`(?i)^\s*drop\s+(?:database|schema)\b`), nil, Danger, "sql-drop-database", "drops a whole database"},
+	{regexp.MustCompile(`(?i)^\s*drop\s+table\b`), nil, Danger, "sql-drop-table", "drops tables with all of their rows"},
+	{regexp.MustCompile(`(?i)^\s*truncate\b`), nil, Danger, "sql-truncate", "deletes every row of the table"},
+	{regexp.MustCompile(`(?i)^\s*delete\s+from\b`), where, Danger, "sql-delete-all", "deletes every row of the table, as there is no WHERE clause"},
+	{regexp.MustCompile(`(?i)^\s*update\s+\S+\s+set\b`), where, Danger, "sql-update-all", "changes every row of the table, as there is no WHERE clause"},
+	{regexp.MustCompile(`(?i)^\s*alter\s+table\b.*\bdrop\b`), nil, Caution, "sql-alter-drop", "drops columns or constraints"},
+}
+
+// where matches a WHERE clause, or a LIMIT that bounds the damage
+var where = regexp.MustCompile(`(?i)\b(?:where|limit)\b`)
+
+// mongoRules match destructive calls in mongosh scripts
+var mongoRules = []struct {
+	re     *regexp.Regexp
+	level  Level
+	id     string
+	reason string
+}{
+	{regexp.MustCompile(`\.dropDatabase\s*\(`), Danger, "sql-drop-database", "drops a whole database"},
+	{regexp.MustCompile(`\.drop\s*\(`), Danger, "sql-drop-table", "drops a collection with all of its documents"},
+	{regexp.MustCompile(`\.(?:deleteMany|remove)\s*\(\s*\{\s*\}`), Danger, "sql-delete-all", "deletes every document of the collection"},
+}
+
+// sqlOf returns the statements a database client is told to run on the command
+// line, and the host and database they run against
+func (c packCall) sqlOf() (script, target string) {
+	host := optValue(c.args, "-h", "--host")
+	db := optValue(c.args, "-d", "--dbname", "-D", "--database", "--db")
+	switch c.name {
+	case "psql":
+		script = optValue(c.args, "-c", "--command")
+		ops := operands(c.args, "-c", "--command", "-h", "--host", "-p", "--port", "-U", "--username", "-d", "--dbname", "-f", "--file", "-v", "--set", "-o", "--output")
+		if db == "" && len(ops) > 0 {
+			db = ops[0]
+		}
+	case "mysql", "mariadb":
+		script = optValue(c.args, "-e", "--execute")
+		ops := operands(c.args, "-e", "--execute", "-h", "--host", "-P", "--port", "-u", "--user", "-D", "--database", "-S", "--socket")
+		if db == "" && len(ops) > 0 {
+			db = ops[0]
+		}
+	case "sqlite3":
+		ops := operands(c.args, "-cmd", "-separator", "-newline", "-nullvalue")
+		if len(ops) > 0 {
+			db, script = ops[0], strings.Join(ops[1:], " ")
+		}
+	case "sqlcmd":
+		script = optValue(c.args, "-Q", "-q")
+		host = optValue(c.args, "-S")
+	case "clickhouse-client":
+		script = optValue(c.args, "-q", "--query")
+	case "mongosh", "mongo":
+		script = optValue(c.args, "--eval")
+		if ops := operands(c.args, "--eval", "--host", "--port", "-u", "--username", "-p", "--password", "--authenticationDatabase"); len(ops) > 0 {
+			host = ops[0]
+		}
+	case "redis-cli":
+		script = strings.Join(operands(c.args, "-h", "-p", "-a", "-n", "-u", "--user", "--pass"), " ")
+	}
+	return script, strings.Trim(host+"/"+db, "/")
+}
+
+// checkSQL covers statements that drop or empty whole databases and tables,
+// passed to psql, mysql, sqlite3 and other clients on the command line or on
+// their standard input
+func (c packCall) checkSQL() Verdict {
+	script, target := c.sqlOf()
+	if strings.TrimSpace(script) == "" {
+		script = c.stdin
+	}
+	if strings.TrimSpace(script) == "" {
+		return Verdict{Level: Safe}
+	}
+
+	switch c.name {
+	case "mongosh", "mongo":
+		for _, r := range mongoRules {
+			if r.re.MatchString(script) {
+				return c.inContext(r.level, r.id, r.reason, "database", target)
+			}
+		}
+		return Verdict{Level: Safe}
+	case "redis-cli":
+		for line := range strings.Lines(script) {
+			cmd, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+			if strings.EqualFold(cmd, "flushall") || strings.EqualFold(cmd, "flushdb") {
+				return c.inContext(Danger, "sql-flush", "deletes every key", "database", target)
+			}
+		}
+		return Verdict{Level: Safe}
+	}
+
+	for stmt := range strings.SplitSeq(script, ";") {
+		for _, r := range sqlRules {
+			if r.re.MatchString(stmt) && (r.unless == nil || !r.unless.MatchString(stmt)) {
+				return c.inContext(r.level, r.id, r.reason, "database", target)
+			}
+		}
+	}
+	return Verdict{Level: Safe}
+}
+
+// checkPipedSQL checks the statements fed to a database client on its standard
+// input, echoed into it in a pipeline or given as a here-string or here-document.
+// The client's own options are checked along with the rest of the simple command.
+func checkPipedSQL(stmt *syntax.Stmt, dir string) Verdict {
+	if !packEnabled("sql") {
+		return Verdict{Level: Safe}
+	}
+	stages := pipelineStages(stmt)
+	for i, stage := range stages {
+		words, _ := callWords(stage)
+		if len(words) == 0 || packCommands[commandName(words[0].text)] != "sql" {
+			continue
+		}
+		input := ""
+		if i > 0 {
+			if prev, _ := callWords(stages[i-1]); len(prev) > 0 && (commandName(prev[0].text) == "echo" || commandName(prev[0].text) == "printf") {
+				input = echoedText(prev[1:])
+			}
+		}
+		for _, r := range stage.Redirs {
+			switch {
+			case r.Op == syntax.WordHdoc && r.Word != nil:
+				input = wordText(r.Word)
+			case (r.Op == syntax.Hdoc || r.Op == syntax.DashHdoc) && r.Hdoc != nil:
+				input = wordText(r.Hdoc)
+			}
+		}
+		if input == "" {
+			continue
+		}
+
+		args := make([]string, 0, len(words)-1)
+		for _, w := range words[1:] {
+			args = append(args, w.text)
+		}
+		c := packCall{name: commandName(words[0].text), args: args, dir: dir, span: nodeSpan(stmt), stdin: input}
+		if v := c.checkSQL(); v.Level != Safe {
+			return v
+		}
+	}
+	return Verdict{Level: Safe}
+}
@@ -0,0 +1,179 @@
+package guard
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPacks(t *testing.T) {
+	home := t.TempDir()
+	repo := filepath.Join(home, "repo")
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(home, "feature", ".git", "HEAD"), "ref: refs/heads/feature/login\n")
+	writeFile(t, filepath.Join(home, "kubeconfig"), "current-context: prod-eu\n")
+	writeFile(t, filepath.Join(repo, "infra", ".terraform", "environment"), "staging\n")
+	t.Setenv("HOME", home)
+	t.Setenv("KUBECONFIG", filepath.Join(home, "kubeconfig"))
+	t.Setenv("TF_WORKSPACE", "")
+	os.Unsetenv("TF_WORKSPACE")
+	t.Setenv("AWS_PROFILE", "")
+	os.Unsetenv("AWS_PROFILE")
+	SetWorkDir(repo)
+	defer SetWorkDir("")
+
+	incidents := []string{
+		"git push --force origin main",
+		"kubectl delete ns payments",
+		"terraform destroy",
+		"docker system prune -a --volumes",
+		`psql -c "DROP DATABASE app"`,
+		"aws s3 rm s3://backups --recursive",
+	}
+	for _, command := range incidents {
+		if v := Check(command); v.Level != Safe {
+			t.Errorf("Check(%q) with no packs = %v/%q, want Safe", command, v.Level, v.RuleID)
+		}
+	}
+
+	if err := SetPacks(append([]string{"nope"}, Packs...)); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("SetPacks with an unknown pack returned %v", err)
+	}
+	defer SetPacks(nil)
+
+	tests := []struct {
+		command string
+		level   Level
+		rule    string
+	}{
+		// git
+		{"git push --force origin main", Danger, "git-force-push"},
+		{"git push -f", Danger, "git-force-push"},
+		{"git push origin +HEAD", Danger, "git-force-push"},
+		{"git -C ../feature push --force-with-lease", Caution, "git-force-push"},
+		{"git push origin :release/1.2", Danger, "git-push-delete"},
+		{"git push --delete origin topic", Caution, "git-push-delete"},
+		{"git push --mirror backup", Danger, "git-push-mirror"},
+		{"git reset --hard HEAD~3", Caution, "git-reset-hard"},
+		{"git clean -fdx", Caution, "git-clean"},
+		{"git checkout -- .", Caution, "git-discard-changes"},
+		{"git branch -D master", Danger, "git-branch-delete"},
+		{"git stash clear", Caution, "git-stash-drop"},
+		{"git push origin topic", Safe, ""},
+		{"git clean -n", Safe, ""},
+		{"git restore --staged app.go", Safe, ""},
+		{"git checkout -b topic", Safe, ""},
+		// Kubernetes
+		{"kubectl delete ns payments", Danger, "k8s-delete-namespace"},
+		{"kubectl --context dev delete namespace/payments", Danger, "k8s-delete-namespace"},
+		{"kubectl delete pods --all -n web", Danger, "k8s-delete-all"},
+		{"kubectl delete pod web-1", Danger, "k8s-delete"},
+		{"kubectl --context kind-dev delete pod web-1", Caution, "k8s-delete"},
+		{"kubectl drain node-1 --ignore-daemonsets", Danger, "k8s-drain"},
+		{"kubectl scale deploy/web --replicas=0", Danger, "k8s-scale-zero"},
+		{"helm uninstall api -n web", Danger, "helm-uninstall"},
+		{"helm --kube-context dev uninstall api", Caution, "helm-uninstall"},
+		{"kubectl --context dev apply -f app.yaml", Safe, ""},
+		{"kubectl get pods -n delete", Safe, ""},
+		// Terraform
+		{"terraform destroy", Danger, "terraform-destroy"},
+		{"terraform apply -destroy -auto-approve", Danger, "terraform-destroy"},
+		{"terraform -chdir=infra apply -auto-approve", Caution, "terraform-auto-approve"},
+		{"terragrunt run-all destroy", Danger, "terraform-destroy"},
+		{"terraform state rm aws_instance.web", Caution, "terraform-state"},
+		{"terraform plan", Safe, ""},
+		{"terraform -chdir=infra apply", Safe, ""},
+		// Docker
+		{"docker system prune -a --volumes", Danger, "docker-prune-volumes"},
+		{"docker system prune -f", Caution, "docker-system-prune"},
+		{"docker volume prune -a", Danger, "docker-volume-prune"},
+		{"docker compose down -v", Danger, "docker-compose-down-volumes"},
+		{"docker rm -f $(docker ps -aq)", Caution, "docker-rm-all"},
+		{"docker compose down", Safe, ""},
+		{"docker ps -a", Safe, ""},
+		// SQL
+		{`psql -c "DROP DATABASE app"`, Danger, "sql-drop-database"},
+		{`psql -h db.prod.internal app -c "drop table users;"`, Danger, "sql-drop-table"},
+		{`mysql -e "DELETE FROM orders"`, Danger, "sql-delete-all"},
+		{`mysql -e "UPDATE users SET admin = 1"`, Danger, "sql-update-all"},
+		{`sqlite3 app.db "TRUNCATE logs"`, Danger, "sql-truncate"},
+		{`psql -h localhost -c "ALTER TABLE users DROP COLUMN age"`, Caution, "sql-alter-drop"},
+		{`psql -h prod-db -c "ALTER TABLE users DROP COLUMN age"`, Danger, "sql-alter-drop"},
+		{`mongosh --eval "db.dropDatabase()"`, Danger, "sql-drop-database"},
+		{"redis-cli -h cache FLUSHALL", Danger, "sql-flush"},
+		{`psql -c "DELETE FROM orders WHERE id = 7"`, Safe, ""},
+		{`mysql -e "SELECT * FROM users"`, Safe, ""},
+		{"redis-cli GET key", Safe, ""},
+		// SQL fed to the client on its standard input
+		{`echo "DROP DATABASE app;" | psql`, Danger, "sql-drop-database"},
+		{`printf 'DELETE FROM orders;' | sudo mysql shop`, Danger, "sql-delete-all"},
+		{`sqlite3 app.db <<< "DROP TABLE logs"`, Danger, "sql-drop-table"},
+		{"psql app <<EOF\nBEGIN;\nTRUNCATE sessions;\nCOMMIT;\nEOF", Danger, "sql-truncate"},
+		{"echo FLUSHALL | redis-cli", Danger, "sql-flush"},
+		{`echo "SELECT 1" | psql`, Safe, ""},
+		{`echo "DROP DATABASE app" > notes.txt`, Safe, ""},
+		// Cloud
+		{"aws s3 rm s3://backups --recursive", Danger, "aws-s3-rm-recursive"},
+		{"aws s3 rb s3://logs --force", Danger, "aws-s3-rb"},
+		{"aws ec2 terminate-instances --instance-ids i-123", Danger, "aws-delete"},
+		{"aws --profile dev sqs delete-queue --queue-url q", Caution, "aws-delete"},
+		{"aws --profile prod sqs delete-queue --queue-url q", Danger, "aws-delete"},
+		{"gcloud projects delete my-project", Danger, "gcloud-delete"},
+		{"gcloud compute instances delete vm-1 --zone us-east1-b", Caution, "gcloud-delete"},
+		{"gsutil -m rm -r gs://bucket/dir", Danger, "gsutil-rm-recursive"},
+		{"az group delete --name rg-app", Danger, "az-group-delete"},
+		{"aws s3 ls s3://backups", Safe, ""},
+		{"gsutil rm gs://bucket/file", Safe, ""},
+		// Wrapped and nested commands are checked as well
+		{"sudo docker volume rm pgdata", Caution, "docker-volume-rm"},
+		{`bash -c "git push -f origin main"`, Danger, "git-force-push"},
+	}
+
+	for _, tt := range tests {
+		v := Check(tt.command)
+		if v.Level != tt.level || v.RuleID != tt.rule {
+			t.Errorf("Check(%q) = %v/%q (%s), want %v/%q", tt.command, v.Level, v.RuleID, v.Reason, tt.level, tt.rule)
+		}
+	}
+	reasons := map[string]string{
+		"kubectl delete pods --all -n web":          "deletes all resources of type pods it finds (kube-context prod-eu)",
+		`mysql -h db1 shop -e "DELETE FROM orders"`: "deletes every row of the table, as there is no WHERE clause (database db1/shop)",
+		"kubectl --context prod-us drain node-1":    "evicts every pod from the node (kube-context prod-us, which looks like production)",
+	}
+	for command, want := range reasons {
+		if v := Check(command); v.Reason != want {
+			t.Errorf("Check(%q) gives the reason %q, want %q", command, v.Reason, want)
+		}
+	}
+}
+
+func TestPolicyPacks(t *testing.T) {
+	home := t.TempDir()
+	repo := filepath.Join(home, "repo")
+	t.Setenv("HOME", home)
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(home, ".baomihua", "guard.yaml"), "packs: [git]\n")
+	writeFile(t, filepath.Join(repo, ".baomihua", "guard.yaml"), "packs: [git, terraform]\n")
+
+	policy, err := LoadPolicy(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(policy.Packs, ",") != "git,terraform" {
+		t.Fatalf("expected the packs of both files without duplicates, got %v", policy.Packs)
+	}
+	SetPolicy(policy)
+	defer SetPolicy(nil)
+	if got := EnabledPacks(); strings.Join(got, ",") != "git,terraform" {
+		t.Errorf("EnabledPacks() = %v", got)
+	}
+	if v := Check("terraform destroy"); v.RuleID != "terraform-destroy" {
+		t.Errorf("Check(terraform destroy) = %v/%q, want the pack to apply", v.Level, v.RuleID)
+	}
+
+	writeFile(t, filepath.Join(repo, ".baomihua", "guard.yaml"), "packs: [kubernetes]\n")
+	if _, err := LoadPolicy(repo); err == nil {
+		t.Error("expected an error for an unknown pack")
+	}
+}
@@ -0,0 +1,222 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workDir is where relative paths are resolved, the current directory if empty
+var workDir string
+
+// SetWorkDir makes Check resolve relative paths against dir
+func SetWorkDir(dir string) {
+	workDir = dir
+}
+
+// baseDir is the directory a command starts in, "" if it can't be told
+func baseDir() string {
+	if workDir != "" {
+		return workDir
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// changeDir returns where cd with args leads from dir, or "" if that's unknown.
+// It doesn't know whether the cd succeeds or happens in a subshell, so the
+// result is a best guess for the commands after it.
+func changeDir(dir string, args []word) string {
+	if len(args) == 0 {
+		home, _ := os.UserHomeDir()
+		return home
+	}
+	// Options such as -P come first
+	last := args[len(args)-1].text
+	if strings.HasPrefix(last, "-") {
+		return ""
+	}
+	p, ok := resolvePath(last, dir)
+	if !ok {
+		return ""
+	}
+	return p
+}
+
+// maxFiles is how many files a recursive delete may remove before it's worth a
+// second look. Counting stops right after, so the walk stays cheap.
+var maxFiles = 1000
+
+// systemDirs are top-level directories whose loss breaks the system
+var systemDirs = map[string]bool{
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/lib": true, "/lib32": true,
+	"/lib64": true, "/libx32": true, "/opt": true, "/proc": true, "/root": true, "/sbin": true,
+	"/srv": true, "/sys": true, "/usr": true, "/var": true, "/home": true, "/Users": true,
+	"/System": true, "/Library": true, "/Applications": true, "/private": true,
+}
+
+// systemTrees are system directories whose direct children are just as vital,
+// e.g. /usr/lib or /etc/ssh
+var systemTrees = map[string]bool{
+	"/bin": true, "/boot": true, "/etc": true, "/lib": true, "/lib32": true, "/lib64": true,
+	"/libx32": true, "/sbin": true, "/usr": true, "/var": true, "/System": true, "/Library": true,
+	"/private": true,
+}
+
+// scratchDirs are meant to be emptied and are often mount points of their own
+var scratchDirs = map[string]bool{
+	"/tmp": true, "/var/tmp": true, "/dev/shm": true, "/private/tmp": true,
+}
+
+// target is what a path argument of a destructive command turned out to be
+type target struct {
+	kind  string // root, system-dir, home, repo-root, git-dir, mount-point or many-files
+	level Level
+	what  string // Describes it for the reason, e.g. "the home directory"
+	path  string // The resolved path
+}
+
+// resolvePath turns an argument into an absolute, clean path: ~ and set
+// environment variables are expanded and relative paths are taken from dir.
+// ok is false when that isn't possible without running anything.
+func resolvePath(arg, dir string) (string, bool) {
+	home, _ := os.UserHomeDir()
+	if rest, ok := strings.CutPrefix(arg, "~"); ok {
+		if home == "" || (rest != "" && rest[0] != '/') {
+			// ~user
+			return "", false
+		}
+		arg = home + rest
+	}
+	if strings.Contains(arg, "$(") || strings.Contains(arg, "$?") {
+		return "", false
+	}
+	if strings.Contains(arg, "$") {
+		unset := false
+		arg = os.Expand(arg, func(name string) string {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				unset = true
+			}
+			return value
+		})
+		if unset {
+			return "", false
+		}
+	}
+	if !filepath.IsAbs(arg) {
+		if dir == "" {
+			return "", false
+		}
+		arg = filepath.Join(dir, arg)
+	}
+	return filepath.Clean(arg), true
+}
+
+// classify resolves a path argument against dir and rates what a recursive operation on it
+// would hit. A last segment like * stands for everything in its directory. Only
+// with thorough set are repositories, mount points and the number of files
+// looked at, which matters for deletes but not for changing permissions.
+func classify(arg, dir string, thorough bool) target {
+	parent, pattern := arg, ""
+	if i := strings.LastIndex(arg, "/"); strings.ContainsAny(arg[i+1:], "*?[") {
+		parent, pattern = arg[:i+1], arg[i+1:]
+		if parent == "" {
+			parent = "."
+		}
+	}
+	if strings.ContainsAny(parent, "*?[") {
+		return target{}
+	}
+	p, ok := resolvePath(parent, dir)
+	if !ok {
+		return target{}
+	}
+
+	home, _ := os.UserHomeDir()
+	home = filepath.Clean(home)
+	switch {
+	case p == "/":
+		return target{kind: "root", level: Blocked, what: "the root directory", path: p}
+	case home != "." && p == home:
+		return target{kind: "home", level: Danger, what: "the home directory", path: p}
+	case home != "." && strings.HasPrefix(home, p+"/"):
+		return target{kind: "system-dir", level: Blocked, what: p + ", which holds the home directory", path: p}
+	case systemDirs[p]:
+		return target{kind: "system-dir", level: Blocked, what: "the system directory " + p, path: p}
+	case systemTrees[filepath.Dir(p)] && !scratchDirs[p]:
+		return target{kind: "system-dir", level: Danger, what: "the system directory " + p, path: p}
+	}
+	if !thorough {
+		return target{}
+	}
+
+	info, err := os.Lstat(p)
+	if err != nil || !info.IsDir() {
+		return target{}
+	}
+	if !scratchDirs[p] && isMountPoint(p) {
+		return target{kind: "mount-point", level: Danger, what: "the mount point " + p + ", likely a whole disk or share", path: p}
+	}
+	if pattern == "" {
+		if filepath.Base(p) == ".git" {
+			return target{kind: "git-dir", level: Danger, what: "the history of the git repository in " + filepath.Dir(p), path: p}
+		}
+		if _, err := os.Stat(filepath.Join(p, ".git")); err == nil {
+			return target{kind: "repo-root", level: Danger, what: "the git repository " + p + ", history included", path: p}
+		}
+	}
+
+	roots := []string{p}
+	if pattern != "" {
+		roots, _ = filepath.Glob(filepath.Join(p, pattern))
+	}
+	if countFiles(roots, maxFiles+1) > maxFiles {
+		return target{kind: "many-files", level: Caution, what: fmt.Sprintf("more than %d files in %s", maxFiles, p), path: p}
+	}
+	return target{}
+}
+
+// errEnough stops a walk once enough files were seen
+var errEnough = errors.New("enough files")
+
+// countFiles counts the files below roots, but stops at limit
+func countFiles(roots []string, limit int) int {
+	n := 0
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				n++
+			}
+			if n >= limit {
+				return errEnough
+			}
+			return nil
+		})
+		if errors.Is(err, errEnough) {
+			break
+		}
+	}
+	return n
+}
+
+// worstTarget classifies every path argument and returns the most severe
+func worstTarget(args []string, dir string, thorough bool) target {
+	var worst target
+	for _, arg := range args {
+		if t := classify(arg, dir, thorough); t.kind != "" && (worst.kind == "" || t.level > worst.level) {
+			worst = t
+		}
+	}
+	return worst
+}
+
+// verdict turns the target of a command into its verdict. The rule ID is the
+// command's prefix plus the kind, e.g. rm-home, and the reason is the action
+// followed by what gets hit.
+func (t target) verdict(span Span, prefix, action string) Verdict {
+	return Verdict{Level: t.level, RuleID: prefix + "-" + t.kind, Reason: action + t.what, Span: span, Detail: t.path}
+}
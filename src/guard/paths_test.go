@@ -0,0 +1,71 @@
+package guard
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPaths(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	repo := filepath.Join(home, "src", "repo")
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(repo, "src", "main.go"), "package main\n")
+	for i := range 10 {
+		writeFile(t, filepath.Join(repo, "cache", fmt.Sprint(i)), "")
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("PROJECT", repo)
+	SetWorkDir(filepath.Join(repo, "src"))
+	defer SetWorkDir("")
+	defer func(n int) { maxFiles = n }(maxFiles)
+	maxFiles = 5
+
+	tests := []struct {
+		command string
+		level   Level
+		rule    string
+		detail  string
+	}{
+		{"rm -rf ..", Danger, "rm-repo-root", repo},
+		{"rm -rf $PROJECT", Danger, "rm-repo-root", repo},
+		{"rm -rf ../.git", Danger, "rm-git-dir", filepath.Join(repo, ".git")},
+		{"cd .. && rm -rf cache", Caution, "rm-many-files", filepath.Join(repo, "cache")},
+		{"rm -rf ../cache/*", Caution, "rm-many-files", filepath.Join(repo, "cache")},
+		{"cd && rm -rf *", Danger, "rm-home", home},
+		{"cd ~/src; rm -r ../", Danger, "rm-home", home},
+		{"rm -rf " + root, Blocked, "rm-system-dir", root},
+		{"rm -rf /usr", Blocked, "rm-system-dir", "/usr"},
+		{"sudo rm -rf /usr/lib/", Danger, "rm-system-dir", "/usr/lib"},
+		{"chmod -R 777 /etc", Blocked, "chmod-system-dir", "/etc"},
+		{"find ../../.. -type f -delete", Danger, "find-delete-home", home},
+		{`cd "$NO_SUCH_DIR" && rm -rf build`, Caution, "rm-dynamic-target", ""},
+		{"rm -rf main.go ../cache/1", Safe, "", ""},
+		{"rm -r /tmp/build", Safe, "", ""},
+		{"chmod -R 755 ..", Safe, "", ""},
+	}
+
+	for _, tt := range tests {
+		v := Check(tt.command)
+		if v.Level != tt.level || v.RuleID != tt.rule || v.Detail != tt.detail {
+			t.Errorf("Check(%q) = %v/%q/%q, want %v/%q/%q", tt.command, v.Level, v.RuleID, v.Detail, tt.level, tt.rule, tt.detail)
+		}
+	}
+}
+
+func TestCheckIn(t *testing.T) {
+	home := t.TempDir()
+	repo := filepath.Join(home, "repo")
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	t.Setenv("HOME", home)
+	SetWorkDir(filepath.Join(home, "tmp"))
+	defer SetWorkDir("")
+
+	if v := CheckIn("rm -rf .", repo); v.Level != Danger || v.RuleID != "rm-repo-root" {
+		t.Errorf("CheckIn(rm -rf ., repo) = %v/%q, want danger/rm-repo-root", v.Level, v.RuleID)
+	}
+	if v := Check("rm -rf ."); v.Level != Safe {
+		t.Errorf("expected CheckIn to leave the working directory alone, got %v/%q", v.Level, v.RuleID)
+	}
+}
@@ -0,0 +1,420 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Where a policy file was found. Sources are ordered from the least to the most
+// specific, the order in which their files are listed and merged.
+type Source int
+
+const (
+	SourceSystem Source = iota // /etc/baomihua/guard.yaml
+	SourceUser                 // ~/.baomihua/guard.yaml
+	SourceRepo                 // .baomihua/guard.yaml in the current repository
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceSystem:
+		return "system"
+	case SourceUser:
+		return "user"
+	case SourceRepo:
+		return "repo"
+	}
+	return "unknown"
+}
+
+// Rule is one entry of a policy file
+type Rule struct {
+	ID     string     `yaml:"id"`
+	Action string     `yaml:"action"` // allow, deny or warn
+	Match  string     `yaml:"match"`  // Command words, * matches any text within a word
+	Regex  string     `yaml:"regex"`  // Alternatively, a regular expression for the whole simple command
+	Reason string     `yaml:"reason"`
+	When   *Condition `yaml:"when"`   // Only applies when the condition holds
+	Unless *Condition `yaml:"unless"` // Doesn't apply when the condition holds
+
+	Source Source `yaml:"-"`
+	File   string `yaml:"-"`
+
+	words []string
+	regex *regexp.Regexp
+}
+
+// Condition restricts a rule to a context. Every field that is set has to match;
+// values are patterns where * matches any text.
+type Condition struct {
+	Env         map[string]string `yaml:"env"`          // The variable is set and its value matches
+	KubeContext string            `yaml:"kube-context"` // --context of the command, or the kubeconfig's current context
+	GitBranch   string            `yaml:"git-branch"`   // The checked out branch of the current repository
+}
+
+// Policy is the merged set of rules from all policy files
+type Policy struct {
+	Rules []Rule
+	Packs []string // Rule packs the files turn on, see SetPacks
+	Files []string // The files that were loaded, least specific first
+
+	branch  func() string
+	context func() string
+}
+
+// policy is consulted by Check. It's nil, and only the built-in rules apply,
+// until SetPolicy is called.
+var policy *Policy
+
+// SetPolicy makes Check apply p on top of the built-in rules
+func SetPolicy(p *Policy) {
+	policy = p
+}
+
+// PolicyPaths returns the policy files that apply in cwd and where they come
+// from. The repository file is looked up from cwd to the root of its git
+// repository; files that don't exist are left out.
+func PolicyPaths(cwd string) ([]string, []Source) {
+	var paths []string
+	var sources []Source
+	add := func(p string, s Source) {
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			paths = append(paths, p)
+			sources = append(sources, s)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("ProgramData"); dir != "" {
+			add(filepath.Join(dir, "baomihua", "guard.yaml"), SourceSystem)
+		}
+	} else {
+		add("/etc/baomihua/guard.yaml", SourceSystem)
+	}
+
+	home, _ := os.UserHomeDir()
+	if home != "" {
+		add(filepath.Join(home, ".baomihua", "guard.yaml"), SourceUser)
+	}
+
+	// Stop at the home directory, its .baomihua is the user's own
+	for dir := cwd; dir != "" && dir != home; {
+		p := filepath.Join(dir, ".baomihua", "guard.yaml")
+		if _, err := os.Stat(p); err == nil {
+			add(p, SourceRepo)
+			break
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return paths, sources
+}
+
+// LoadPolicy reads the policy files that apply in cwd. Files that fail to parse
+// are skipped and reported in the error; the rules of the others are returned.
+func LoadPolicy(cwd string) (*Policy, error) {
+	p := newPolicy(cwd)
+	var errs []error
+
+	paths, sources := PolicyPaths(cwd)
+	for i, path := range paths {
+		rules, packs, err := readPolicyFile(path, sources[i])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p.Rules = append(p.Rules, rules...)
+		for _, pack := range packs {
+			if !slices.Contains(p.Packs, pack) {
+				p.Packs = append(p.Packs, pack)
+			}
+		}
+		p.Files = append(p.Files, path)
+	}
+	return p, errors.Join(errs...)
+}
+
+func newPolicy(cwd string) *Policy {
+	return &Policy{
+		branch:  sync.OnceValue(func() string { return gitBranch(cwd) }),
+		context: sync.OnceValue(kubeContext),
+	}
+}
+
+func readPolicyFile(path string, source Source) ([]Rule, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var file struct {
+		Packs []string `yaml:"packs"`
+		Rules []Rule   `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i, pack := range file.Packs {
+		file.Packs[i] = strings.ToLower(strings.TrimSpace(pack))
+		if !slices.Contains(Packs, file.Packs[i]) {
+			return nil, nil, fmt.Errorf("%s: unknown rule pack %q (known: %s)", path, pack, strings.Join(Packs, ", "))
+		}
+	}
+	for i := range file.Rules {
+		r := &file.Rules[i]
+		r.Source = source
+		r.File = path
+		if err := r.compile(); err != nil {
+			return nil, nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+		}
+	}
+	return file.Rules, file.Packs, nil
+}
+
+func (r *Rule) compile() error {
+	switch r.Action {
+	case "allow", "deny", "warn":
+	default:
+		return fmt.Errorf("action must be allow, deny or warn, not %q", r.Action)
+	}
+	if r.ID == "" {
+		return errors.New("id is missing")
+	}
+	r.words = strings.Fields(r.Match)
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("regex: %w", err)
+		}
+		r.regex = re
+	}
+	if len(r.words) == 0 && r.regex == nil {
+		return errors.New("either match or regex is required")
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a simple command. deny and warn
+// rules match when their words appear in the command in order, so
+// "kubectl delete" also catches "kubectl --context prod delete pod x". allow
+// rules have to match the command word for word.
+func (r *Rule) matches(args []string) bool {
+	if len(r.words) > 0 && !matchWords(r.words, args, r.Action == "allow") {
+		return false
+	}
+	if r.regex != nil && !r.regex.MatchString(strings.Join(args, " ")) {
+		return false
+	}
+	return true
+}
+
+func matchWords(pattern, args []string, exact bool) bool {
+	if len(args) == 0 || !globMatch(strings.ToLower(pattern[0]), commandName(args[0])) {
+		return false
+	}
+	if exact {
+		if len(pattern) != len(args) {
+			return false
+		}
+		for i := 1; i < len(args); i++ {
+			if !globMatch(pattern[i], args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	i := 1
+	for _, arg := range args[1:] {
+		if i < len(pattern) && globMatch(pattern[i], arg) {
+			i++
+		}
+	}
+	return i == len(pattern)
+}
+
+// globMatch matches s against a pattern where * stands for any text, / included
+func globMatch(pattern, s string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == s
+	}
+	re := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	ok, _ := regexp.MatchString(re, s)
+	return ok
+}
+
+// holds reports whether the condition is true for the command args
+func (p *Policy) holds(c *Condition, args []string) bool {
+	for name, want := range c.Env {
+		value, ok := os.LookupEnv(name)
+		if !ok || !globMatch(want, value) {
+			return false
+		}
+	}
+	if c.KubeContext != "" {
+		ctx := contextFlag(args)
+		if ctx == "" {
+			ctx = p.context()
+		}
+		if !globMatch(c.KubeContext, ctx) {
+			return false
+		}
+	}
+	if c.GitBranch != "" && !globMatch(c.GitBranch, p.branch()) {
+		return false
+	}
+	return true
+}
+
+// apply lets the rules of the policy adjust the built-in verdict of a simple
+// command. A deny from any file wins. Otherwise the matching allow or warn rule
+// from the most specific file decides, and a warn wins within a file. An allow
+// never lowers Blocked. Cloning a repository mustn't be enough to disarm the
+// guard, so the allows of a repository file neither override the warns of other
+// files nor lower Danger.
+func (p *Policy) apply(words []word, v Verdict) Verdict {
+	if p == nil || len(words) == 0 {
+		return v
+	}
+	args := make([]string, 0, len(words))
+	for _, w := range words {
+		args = append(args, w.text)
+	}
+	span := Span{words[0].span.Start, words[len(words)-1].span.End}
+
+	var decisive *Rule
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.matches(args) {
+			continue
+		}
+		if r.When != nil && !p.holds(r.When, args) {
+			continue
+		}
+		if r.Unless != nil && p.holds(r.Unless, args) {
+			continue
+		}
+		if r.Action == "deny" {
+			return r.verdict(Blocked, "denied by the "+r.Source.String()+" guard policy", span)
+		}
+		if r.Action == "allow" && r.Source == SourceRepo && decisive != nil && decisive.Action == "warn" {
+			continue
+		}
+		if decisive == nil || r.Source > decisive.Source || (r.Source == decisive.Source && r.Action == "warn") {
+			decisive = r
+		}
+	}
+
+	switch {
+	case decisive == nil:
+		return v
+	case decisive.Action == "warn":
+		if w := decisive.verdict(Caution, "flagged by the "+decisive.Source.String()+" guard policy", span); w.stricter(v) {
+			return w
+		}
+	case v.Level == Blocked, v.Level == Danger && decisive.Source == SourceRepo:
+		return v
+	default:
+		return Verdict{Level: Safe}
+	}
+	return v
+}
+
+func (r *Rule) verdict(level Level, fallback string, span Span) Verdict {
+	reason := r.Reason
+	if reason == "" {
+		reason = fallback
+	}
+	return Verdict{Level: level, RuleID: r.ID, Reason: reason, Span: span}
+}
+
+// contextFlag returns the value of kubectl's --context option, if given
+func contextFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--context" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if v, ok := strings.CutPrefix(arg, "--context="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// kubeContext returns the current context of the kubeconfig kubectl would use
+func kubeContext() string {
+	path := ""
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		path = filepath.SplitList(env)[0]
+	} else if home, err := os.UserHomeDir(); err == nil {
+		path = filepath.Join(home, ".kube", "config")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var config struct {
+		CurrentContext string `yaml:"current-context"`
+	}
+	if yaml.Unmarshal(data, &config) != nil {
+		return ""
+	}
+	return config.CurrentContext
+}
+
+// gitBranch returns the checked out branch of the repository containing dir by
+// reading its HEAD, so no git process is started for every check
+func gitBranch(dir string) string {
+	for dir != "" {
+		gitPath := filepath.Join(dir, ".git")
+		info, err := os.Stat(gitPath)
+		if err == nil {
+			if !info.IsDir() {
+				// Worktrees and submodules point at their git directory
+				data, err := os.ReadFile(gitPath)
+				if err != nil {
+					return ""
+				}
+				gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+				if !ok {
+					return ""
+				}
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+				gitPath = gitDir
+			}
+			head, err := os.ReadFile(filepath.Join(gitPath, "HEAD"))
+			if err != nil {
+				return ""
+			}
+			ref, _ := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+			return ref
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+	return ""
+}
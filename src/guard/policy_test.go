@@ -0,0 +1,156 @@
+package guard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	home := t.TempDir()
+	repo := filepath.Join(home, "src", "repo")
+	t.Setenv("HOME", home)
+	t.Setenv("KUBECONFIG", filepath.Join(home, "kubeconfig"))
+	t.Setenv("CI", "")
+	os.Unsetenv("CI")
+
+	writeFile(t, filepath.Join(home, "kubeconfig"), "current-context: prod-eu\n")
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(home, ".baomihua", "guard.yaml"), `
+rules:
+  - id: no-prod-delete
+    action: deny
+    match: kubectl delete
+    when:
+      kube-context: "prod*"
+    reason: production goes through the release pipeline
+  - id: terraform-apply-ci
+    action: deny
+    match: terraform apply
+    unless:
+      env: {CI: "*"}
+  - id: clean-home-cache
+    action: allow
+    match: rm -rf ~/.cache/*
+  - id: main-push
+    action: warn
+    match: git push
+    when:
+      git-branch: main
+`)
+	writeFile(t, filepath.Join(repo, ".baomihua", "guard.yaml"), `
+rules:
+  - id: clean-build
+    action: allow
+    match: rm -rf ./build
+  - id: disarm
+    action: allow
+    match: rm -rf ~
+  - id: loud-push
+    action: allow
+    match: git push
+`)
+
+	policy, err := LoadPolicy(filepath.Join(repo, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Files) != 2 || len(policy.Rules) != 7 {
+		t.Fatalf("expected the user and repo files to be merged, got %v with %d rules", policy.Files, len(policy.Rules))
+	}
+	SetPolicy(policy)
+	defer SetPolicy(nil)
+
+	tests := []struct {
+		command string
+		level   Level
+		rule    string
+	}{
+		{"kubectl delete pod web-1", Blocked, "no-prod-delete"},
+		{"kubectl --context prod-us -n web delete pod web-1", Blocked, "no-prod-delete"},
+		{"kubectl --context staging delete pod web-1", Safe, ""},
+		{"kubectl get pods", Safe, ""},
+		{"terraform plan && terraform apply -auto-approve", Blocked, "terraform-apply-ci"},
+		{"rm -rf ./build", Safe, ""},
+		{"rm -rf $OUT", Caution, "rm-dynamic-target"},
+		// An allow from the user's own file may lower Danger, the repository's can't
+		{"rm -rf ~/.cache/*", Safe, ""},
+		{"rm -rf ~", Danger, "rm-home"},
+		// Nor can it override the warns of the other files
+		{"git push", Caution, "main-push"},
+		{"git push origin main", Caution, "main-push"},
+		{"sudo rm -rf /", Blocked, "rm-root"},
+	}
+	for _, tt := range tests {
+		v := Check(tt.command)
+		if v.Level != tt.level || v.RuleID != tt.rule {
+			t.Errorf("Check(%q) = %s [%s], want %s [%s]", tt.command, v.Level, v.RuleID, tt.level, tt.rule)
+		}
+	}
+
+	// fish commands the sh parser rejects still meet the policy
+	for _, command := range []string{
+		"kubectl delete ns (kubectl get ns -o name)",
+		"for n in (kubectl get ns); kubectl delete ns $n; end",
+	} {
+		if v := CheckShell(command, "fish"); v.Level != Blocked || v.RuleID != "no-prod-delete" {
+			t.Errorf("CheckShell(%q, fish) = %s [%s], want blocked [no-prod-delete]", command, v.Level, v.RuleID)
+		}
+	}
+
+	t.Setenv("CI", "true")
+	if v := Check("terraform apply"); v.Level != Safe {
+		t.Errorf("expected terraform apply to pass in CI, got %s [%s]", v.Level, v.RuleID)
+	}
+}
+
+func TestPolicyWarn(t *testing.T) {
+	policy := newPolicy(t.TempDir())
+	policy.Rules = []Rule{
+		{ID: "push", Action: "warn", Match: "git push", Source: SourceSystem},
+		{ID: "push-ok", Action: "allow", Match: "git push", Source: SourceSystem},
+		{ID: "force", Action: "warn", Regex: `--force\b`, Reason: "rewrites the remote history", Source: SourceUser},
+	}
+	for i := range policy.Rules {
+		if err := policy.Rules[i].compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	SetPolicy(policy)
+	defer SetPolicy(nil)
+
+	if v := Check("git push"); v.Level != Caution || v.RuleID != "push" {
+		t.Errorf("expected a warn to win over an allow of the same file, got %s [%s]", v.Level, v.RuleID)
+	}
+	v := Check("ls && git push --force origin")
+	if v.Level != Caution || v.RuleID != "force" || v.Reason != "rewrites the remote history" {
+		t.Errorf("expected the more specific warn, got %+v", v)
+	}
+	if got := "ls && git push --force origin"[v.Span.Start:v.Span.End]; got != "git push --force origin" {
+		t.Errorf("expected the span to cover the simple command, got %q", got)
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeFile(t, filepath.Join(home, ".baomihua", "guard.yaml"), "rules:\n  - id: x\n    action: block\n    match: rm\n")
+
+	policy, err := LoadPolicy(t.TempDir())
+	if err == nil {
+		t.Fatal("expected an error for an unknown action")
+	}
+	if len(policy.Rules) != 0 || len(policy.Files) != 0 {
+		t.Errorf("expected the broken file to be skipped, got %v", policy.Files)
+	}
+}
@@ -0,0 +1,185 @@
+package guard
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// escalators run a command or a shell as root or another user
+var escalators = map[string]bool{
+	"sudo": true, "doas": true, "su": true, "pkexec": true, "run0": true,
+}
+
+// escalation flags a command that gains privileges through sudo, su, doas,
+// pkexec or run0, also when they are nested in other wrappers. What runs is
+// checked on its own; this only says that it runs as someone else.
+func escalation(words []word) Verdict {
+	span := Span{words[0].span.Start, words[len(words)-1].span.End}
+	for range maxNesting {
+		name := commandName(words[0].text)
+		if escalators[name] {
+			reason, ok := escalationReason(name, words[1:])
+			if !ok {
+				return Verdict{Level: Safe}
+			}
+			return Verdict{Level: Caution, RuleID: "priv-" + name, Reason: reason, Span: span}
+		}
+		inner, ok := unwrap(words)
+		if !ok {
+			break
+		}
+		words = inner
+	}
+	return Verdict{Level: Safe}
+}
+
+// escalationReason describes what sudo & co. do with args. ok is false for uses
+// that don't run anything, such as sudo -v or sudo -l.
+func escalationReason(name string, args []word) (string, bool) {
+	user, shell, command := "", name == "su", false
+	for i := 0; i < len(args); i++ {
+		arg := args[i].text
+		switch {
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			if name == "su" && user == "" && arg != "-" {
+				user = arg
+				continue
+			}
+			if name != "su" {
+				command = true
+			}
+		case name == "sudo" && (arg == "-l" || arg == "-v" || arg == "-k" || arg == "-K" || arg == "-V" || arg == "-h" ||
+			arg == "--list" || arg == "--validate" || arg == "--reset-timestamp" || arg == "--remove-timestamp" || arg == "--version" || arg == "--help"):
+			return "", false
+		case arg == "-u" || arg == "--user":
+			if i+1 < len(args) {
+				i++
+				user = args[i].text
+			}
+		case strings.HasPrefix(arg, "--user="):
+			user = strings.TrimPrefix(arg, "--user=")
+		case arg == "-c" || arg == "--command" || strings.HasPrefix(arg, "--command="):
+			command = true
+		case name == "sudo" && (arg == "-i" || arg == "-s" || arg == "--login" || arg == "--shell"):
+			shell = true
+		}
+		if command {
+			break
+		}
+	}
+
+	who := "root"
+	if user != "" && user != "root" && user != "0" {
+		who = "the user " + user
+	}
+	if shell && !command {
+		return "opens a shell as " + who + " through " + name, true
+	}
+	if who == "root" {
+		return "runs with root privileges through " + name, true
+	}
+	return "runs as " + who + " through " + name, true
+}
+
+// setuidMode matches chmod modes that set the setuid or setgid bit
+var setuidMode = regexp.MustCompile(`^(?:[ugoa]*[+=][rwxXt]*s[rwxXst]*(?:,.*)?|.*,[ugoa]*[+=][rwxXt]*s[rwxXst]*|0?[2-7][0-7]{3})$`)
+
+// adminGroups give their members root through sudo or polkit
+var adminGroups = map[string]bool{
+	"sudo": true, "wheel": true, "admin": true, "root": true,
+}
+
+// editors open a file for interactive editing
+var editors = map[string]bool{
+	"vi": true, "vim": true, "nvim": true, "nano": true, "emacs": true, "ed": true, "pico": true, "micro": true,
+	"sudoedit": true, "visudo": true,
+}
+
+// checkPrivilege flags commands that hand out privileges: setuid binaries,
+// files given to root, changes to the sudoers and new members of admin groups
+func checkPrivilege(name string, args []string, span Span) Verdict {
+	flags, operands := splitArgs(args)
+	verdict := func(level Level, rule, reason, detail string) Verdict {
+		return Verdict{Level: level, RuleID: rule, Reason: reason, Span: span, Detail: detail}
+	}
+
+	switch name {
+	case "chmod":
+		if len(operands) > 1 && setuidMode.MatchString(operands[0]) {
+			return verdict(Danger, "priv-setuid", "sets the setuid or setgid bit, so anyone who runs the file gets its owner's privileges", strings.Join(operands[1:], " "))
+		}
+	case "chown":
+		if len(operands) > 1 && !hasFlag(flags, "", "reference") {
+			owner, _, _ := strings.Cut(operands[0], ":")
+			owner, _, _ = strings.Cut(owner, ".")
+			if owner == "root" || owner == "0" {
+				return verdict(Caution, "priv-chown-root", "gives files to root, which a setuid bit would turn into root privileges", strings.Join(operands[1:], " "))
+			}
+		}
+	case "usermod":
+		for i, arg := range args {
+			if (arg == "-G" || arg == "--groups" || arg == "-aG" || arg == "-Ga") && i+1 < len(args) {
+				for group := range strings.SplitSeq(args[i+1], ",") {
+					if adminGroups[group] {
+						return verdict(Danger, "priv-admin-group", "adds a user to the "+group+" group, which grants root through sudo", group)
+					}
+				}
+			}
+		}
+	case "gpasswd", "adduser", "addgroup":
+		// gpasswd -a user sudo, adduser user sudo
+		if len(operands) == 2 && adminGroups[operands[1]] && (name != "gpasswd" || hasFlag(flags, "a", "add")) {
+			return verdict(Danger, "priv-admin-group", "adds a user to the "+operands[1]+" group, which grants root through sudo", operands[1])
+		}
+	}
+
+	for i, op := range operands {
+		if !isSudoers(op) {
+			continue
+		}
+		copies := name == "cp" || name == "mv" || name == "install" || name == "ln" || name == "rsync"
+		inPlace := (name == "sed" || name == "perl") && (hasFlag(flags, "i") || slices.ContainsFunc(flags, func(f string) bool {
+			return strings.HasPrefix(f, "--in-place")
+		}))
+		switch {
+		case name == "tee" || copies && i == len(operands)-1 || inPlace:
+			return verdict(Danger, "priv-sudoers", "changes who may run what as root", op)
+		case name == "chmod" || name == "chown" || name == "rm" || name == "truncate":
+			return verdict(Danger, "priv-sudoers", "tampers with the sudoers file, which controls who may run what as root", op)
+		case editors[name]:
+			return verdict(Caution, "priv-sudoers", "edits the rules for who may run what as root", op)
+		}
+	}
+	if name == "visudo" && !hasFlag(flags, "c", "check") {
+		return verdict(Caution, "priv-sudoers", "edits the rules for who may run what as root", "/etc/sudoers")
+	}
+	return Verdict{Level: Safe}
+}
+
+// isSudoers reports whether p is /etc/sudoers or one of its drop-in files
+func isSudoers(p string) bool {
+	if !strings.HasPrefix(p, "/") {
+		return false
+	}
+	p = path.Clean(p)
+	return p == "/etc/sudoers" || strings.HasPrefix(p, "/etc/sudoers.d/")
+}
+
+// sudoersRedirect flags output redirected into the sudoers, as in
+// echo '... ALL=(ALL) NOPASSWD: ALL' >> /etc/sudoers
+func sudoersRedirect(r *syntax.Redirect) Verdict {
+	if !writesTo(r.Op) || r.Word == nil || !isSudoers(wordText(r.Word)) {
+		return Verdict{Level: Safe}
+	}
+	return Verdict{
+		Level:  Danger,
+		RuleID: "priv-sudoers",
+		Reason: "changes who may run what as root",
+		Span:   nodeSpan(r),
+		Detail: wordText(r.Word),
+	}
+}
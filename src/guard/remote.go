@@ -0,0 +1,446 @@
+package guard
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// payload is where the script an interpreter is about to run comes from, when
+// that is a download or an encoded string
+type payload struct {
+	url        string // Set for downloads, possibly to the bare host given to curl
+	downloader string // curl or wget, whichever fetched url
+	decoder    bool   // The script is decoded from base64 or hex
+	decoded    string // The decoded script, if its encoded form is part of the command
+}
+
+func (p payload) found() bool {
+	return p.url != "" || p.decoder
+}
+
+// interpreters run a script read from stdin when no script file is given
+var interpreters = map[string]bool{
+	"fish": true, "perl": true, "ruby": true, "node": true, "php": true,
+	"pwsh": true, "powershell": true, "source": true, ".": true,
+}
+
+func isInterpreter(name string) bool {
+	return shells[name] || interpreters[name] || strings.HasPrefix(name, "python")
+}
+
+// readsStdin reports whether an interpreter invoked with args runs its stdin
+func readsStdin(args []word) bool {
+	for _, a := range args {
+		switch {
+		case a.text == "-s" || a.text == "-" || a.text == "/dev/stdin":
+			return true
+		case a.text == "--":
+			return false
+		case !strings.HasPrefix(a.text, "-"):
+			// A script file
+			return false
+		case strings.Contains(strings.TrimPrefix(a.text, "-"), "c") && !strings.HasPrefix(a.text, "--"):
+			// sh -c runs its argument, see innerScript
+			return false
+		}
+	}
+	return true
+}
+
+// callWords returns the words of a simple command with wrappers like sudo
+// removed, and how many leading words that dropped
+func callWords(stmt *syntax.Stmt) ([]word, int) {
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return nil, 0
+	}
+	words := make([]word, 0, len(call.Args))
+	for _, w := range call.Args {
+		words = append(words, word{text: wordText(w), span: nodeSpan(w)})
+	}
+	all := len(words)
+	for range maxNesting {
+		inner, ok := unwrap(words)
+		if !ok {
+			break
+		}
+		words = inner
+	}
+	return words, all - len(words)
+}
+
+// pipelineStages flattens a | b | c into its commands
+func pipelineStages(stmt *syntax.Stmt) []*syntax.Stmt {
+	if bin, ok := stmt.Cmd.(*syntax.BinaryCmd); ok && (bin.Op == syntax.Pipe || bin.Op == syntax.PipeAll) {
+		return append(pipelineStages(bin.X), pipelineStages(bin.Y)...)
+	}
+	return []*syntax.Stmt{stmt}
+}
+
+// sourceOf finds a download or a decoder among the stages of a pipeline that
+// feeds an interpreter. The text echoed into a decoder is decoded when possible.
+func sourceOf(stages []*syntax.Stmt) payload {
+	var p payload
+	echoed := ""
+	for _, stage := range stages {
+		words, _ := callWords(stage)
+		if len(words) == 0 {
+			continue
+		}
+		name := commandName(words[0].text)
+		args := words[1:]
+
+		switch {
+		case name == "echo" || name == "printf":
+			echoed = echoedText(args)
+		case name == "curl" || name == "wget" || name == "fetch" || name == "http" || name == "https":
+			p.downloader = name
+			p.url = urlOf(args)
+		case isDecoder(name, args):
+			p.decoder = true
+			input := echoed
+			for _, r := range stage.Redirs {
+				if r.Op == syntax.WordHdoc && r.Word != nil {
+					input = wordText(r.Word)
+				}
+			}
+			if input != "" && !strings.Contains(input, "$") {
+				p.decoded = decode(input, name == "xxd")
+			}
+		}
+	}
+	return p
+}
+
+// echoedText is the text echo or printf with args print, leaving out options
+func echoedText(args []word) string {
+	var texts []string
+	for _, a := range args {
+		if !strings.HasPrefix(a.text, "-") {
+			texts = append(texts, a.text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// urlOf returns the first argument that looks like a URL, or else the first operand
+func urlOf(args []word) string {
+	for _, a := range args {
+		if strings.Contains(a.text, "://") {
+			return a.text
+		}
+	}
+	for _, a := range args {
+		if !strings.HasPrefix(a.text, "-") {
+			return a.text
+		}
+	}
+	return ""
+}
+
+// isDecoder reports whether the command decodes base64 or hex to stdout
+func isDecoder(name string, args []word) bool {
+	has := func(flags ...string) bool {
+		for _, a := range args {
+			for _, f := range flags {
+				if a.text == f {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch name {
+	case "base64", "base32", "basenc":
+		return has("-d", "-D", "--decode")
+	case "openssl":
+		return has("base64", "enc") && has("-d")
+	case "xxd":
+		return has("-r", "-rp", "-pr")
+	}
+	return false
+}
+
+// decode decodes base64, or hex for xxd, and returns "" unless the result is text
+func decode(s string, hexDump bool) string {
+	s = strings.Join(strings.Fields(s), "")
+	var data []byte
+	var err error
+	if hexDump {
+		data, err = hex.DecodeString(s)
+	} else {
+		data, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+		}
+	}
+	if err != nil {
+		return ""
+	}
+	return decodedText(data)
+}
+
+// decodedText returns data as a string when it is text, reading UTF-16LE as
+// PowerShell's -EncodedCommand uses it, and "" otherwise
+func decodedText(data []byte) string {
+	if len(data) >= 2 && len(data)%2 == 0 && data[1] == 0 {
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		}
+		return string(utf16.Decode(units))
+	}
+	if !utf8.Valid(data) || strings.ContainsRune(string(data), 0) {
+		return ""
+	}
+	return string(data)
+}
+
+// checkPipeToInterpreter flags pipelines that feed a download or a decoded
+// string into an interpreter, as in curl ... | sh or echo ... | base64 -d | bash
+func checkPipeToInterpreter(stmt *syntax.Stmt, dir string, depth int) Verdict {
+	stages := pipelineStages(stmt)
+	for i := 1; i < len(stages); i++ {
+		words, dropped := callWords(stages[i])
+		if len(words) == 0 || !isInterpreter(commandName(words[0].text)) || !readsStdin(words[1:]) {
+			continue
+		}
+		p := sourceOf(stages[:i])
+		if !p.found() {
+			continue
+		}
+		run, args := callText(stages[i], dropped, words)
+		return remoteVerdict(p, run, args, commandName(words[0].text), nodeSpan(stmt), dir, depth)
+	}
+	return Verdict{Level: Safe}
+}
+
+// checkSubstToInterpreter flags interpreters that run a download or a decoded
+// string from a substitution, as in bash <(curl ...), sh -c "$(curl ...)" or
+// eval "$(echo ... | base64 -d)"
+func checkSubstToInterpreter(stmt *syntax.Stmt, dir string, depth int) Verdict {
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok {
+		return Verdict{Level: Safe}
+	}
+	words, dropped := callWords(stmt)
+	if len(words) == 0 {
+		return Verdict{Level: Safe}
+	}
+	name := commandName(words[0].text)
+	if !isInterpreter(name) && name != "eval" {
+		return Verdict{Level: Safe}
+	}
+
+	for _, arg := range call.Args[dropped:] {
+		var p payload
+		syntax.Walk(arg, func(node syntax.Node) bool {
+			if p.found() {
+				return false
+			}
+			var stmts []*syntax.Stmt
+			switch n := node.(type) {
+			case *syntax.CmdSubst:
+				stmts = n.Stmts
+			case *syntax.ProcSubst:
+				stmts = n.Stmts
+			default:
+				return true
+			}
+			for _, s := range stmts {
+				if p = sourceOf(pipelineStages(s)); p.found() {
+					break
+				}
+			}
+			return false
+		})
+		if p.found() {
+			run, args := callText(stmt, dropped, words)
+			if name == "eval" {
+				// eval runs it in the current shell, as sourcing the saved file does
+				run, args = ".", nil
+			}
+			return remoteVerdict(p, run, args, name, nodeSpan(stmt), dir, depth)
+		}
+	}
+	return Verdict{Level: Safe}
+}
+
+// callText returns the wrappers and the interpreter of a pipeline stage, e.g.
+// "sudo bash", and the arguments meant for the script, quoted for sh. run is ""
+// when a word can't be written down again: one only known at runtime, such as
+// $(go env GOPATH), or a ~ that quoting would keep from expanding.
+func callText(stage *syntax.Stmt, dropped int, words []word) (run string, args []string) {
+	var parts []string
+	call := stage.Cmd.(*syntax.CallExpr)
+	for _, w := range call.Args[:dropped] {
+		parts = append(parts, wordText(w))
+	}
+	parts = append(parts, words[0].text)
+
+	// bash -s a b and bash -s -- a b both pass a and b to the script
+	rest := words[1:]
+	for len(rest) > 0 && strings.HasPrefix(rest[0].text, "-") && rest[0].text != "-" && rest[0].text != "--" {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && (rest[0].text == "--" || rest[0].text == "-") {
+		rest = rest[1:]
+	}
+	for _, w := range rest {
+		args = append(args, quote(w.text))
+	}
+
+	for _, text := range append(parts, args...) {
+		if strings.Contains(text, "$") || strings.HasPrefix(strings.Trim(text, "'"), "~") {
+			return "", nil
+		}
+	}
+	return strings.Join(parts, " "), args
+}
+
+// remoteVerdict rates an interpreter running a download or a decoded payload.
+// A payload that decodes to something worse than Danger raises the verdict.
+// A download gets a plan to inspect it first unless run is "".
+func remoteVerdict(p payload, run string, args []string, interpreter string, span Span, dir string, depth int) Verdict {
+	if p.url != "" {
+		v := Verdict{
+			Level:  Danger,
+			RuleID: "download-exec",
+			Reason: "runs a script straight from the internet without showing it first",
+			Span:   span,
+			Detail: p.url,
+		}
+		if run != "" {
+			v.inspect = &inspectPlan{url: p.url, downloader: p.downloader, run: run, args: args}
+		}
+		return v
+	}
+
+	v := Verdict{
+		Level:  Danger,
+		RuleID: "decode-exec",
+		Reason: "runs an encoded payload, hiding what it does",
+		Span:   span,
+		Detail: p.decoded,
+	}
+	if p.decoded != "" && (shells[interpreter] || interpreter == "eval" || interpreter == "source" || interpreter == ".") && depth < maxNesting {
+		if inner, ok := checkScript(p.decoded, dir, depth+1); ok && inner.stricter(v) {
+			v.Level = inner.Level
+			v.Reason += "; the payload " + inner.Reason
+		}
+	}
+	return v
+}
+
+// inspectPlan is what's needed to rewrite a download piped into an interpreter
+// so the script is saved to a temporary file, shown in a pager, and only run
+// once confirmed
+type inspectPlan struct {
+	url        string
+	downloader string
+	run        string   // The interpreter with its wrappers, e.g. sudo bash
+	args       []string // What the script is given after its path, quoted
+}
+
+// command renders the plan for sh-like shells, or for fish
+func (p *inspectPlan) command(fish bool) string {
+	fetch := "curl -fsSL " + quote(p.url) + ` -o "$f"`
+	if p.downloader == "wget" {
+		fetch = `wget -qO "$f" ` + quote(p.url)
+	}
+	if fish {
+		run := p.run
+		if run == "." {
+			run = "source"
+		}
+		fetch = strings.ReplaceAll(fetch, `"$f"`, "$f")
+		return "set f (mktemp); and " + fetch + "; and less $f; and read -P 'Run it? [y/N] ' answer; and test \"$answer\" = y; and " + strings.Join(append([]string{run, "$f"}, p.args...), " ")
+	}
+	return `f=$(mktemp) && ` + fetch + ` && ${PAGER:-less} "$f" && printf 'Run it? [y/N] ' && read -r answer && [ "$answer" = y ] && ` + strings.Join(append([]string{p.run, `"$f"`}, p.args...), " ")
+}
+
+// quote single-quotes s for sh unless it is a plain word
+func quote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// psURL finds the first URL in a PowerShell script
+var psURL = regexp.MustCompile(`https?://[^\s'"()]+`)
+
+// psBase64 finds the string a PowerShell script decodes with [Convert]::FromBase64String
+var psBase64 = regexp.MustCompile(`(?i)frombase64string\(\s*['"]([A-Za-z0-9+/=\s]+)['"]`)
+
+// psDownloaders are the PowerShell commands that fetch a script, with aliases
+var psDownloaders = map[string]bool{
+	"invoke-webrequest": true, "iwr": true, "invoke-restmethod": true, "irm": true,
+	"curl": true, "wget": true, "start-bitstransfer": true,
+}
+
+// checkPowerShellRemote flags Invoke-Expression running a download, as in
+// iex (iwr ...) or irm ... | iex, or a string decoded from base64
+func checkPowerShellRemote(script string, commands [][]word, dir string, depth int) Verdict {
+	var iex, fetch []word
+	for _, words := range commands {
+		name := winCommandName(words[0].text)
+		if psAliases[name] == "invoke-expression" || name == "invoke-expression" {
+			iex = words
+		}
+		if psDownloaders[name] {
+			fetch = words
+		}
+		for _, w := range words {
+			// (New-Object Net.WebClient).DownloadString(...)
+			if lower := strings.ToLower(w.text); strings.Contains(lower, "downloadstring") || strings.Contains(lower, "downloaddata") {
+				fetch = words
+			}
+		}
+	}
+	if iex == nil {
+		return Verdict{Level: Safe}
+	}
+	span := Span{iex[0].span.Start, iex[len(iex)-1].span.End}
+
+	if fetch != nil {
+		span = Span{min(span.Start, fetch[0].span.Start), max(span.End, fetch[len(fetch)-1].span.End)}
+		v := Verdict{
+			Level:  Danger,
+			RuleID: "download-exec",
+			Reason: "runs a script straight from the internet without showing it first",
+			Span:   span,
+			Detail: psURL.FindString(script),
+		}
+		if v.Detail != "" {
+			v.Alternative = "$f = Join-Path $env:TEMP 'bmh-inspect.ps1'; Invoke-WebRequest -Uri '" + strings.ReplaceAll(v.Detail, "'", "''") +
+				"' -OutFile $f; Get-Content $f | Out-Host -Paging; if ((Read-Host 'Run it? [y/N]') -eq 'y') { & $f }"
+		}
+		return v
+	}
+	if m := psBase64.FindStringSubmatch(script); m != nil {
+		return encodedVerdict("decode-exec", "runs an encoded payload, hiding what it does", decode(m[1], false), span, dir, depth)
+	}
+	return Verdict{Level: Safe}
+}
+
+// encodedVerdict rates PowerShell running a decoded payload, raised to the
+// verdict of the payload itself when that is worse
+func encodedVerdict(rule, reason, decoded string, span Span, dir string, depth int) Verdict {
+	v := Verdict{Level: Danger, RuleID: rule, Reason: reason, Span: span, Detail: decoded}
+	if decoded != "" && depth < maxNesting {
+		if inner := checkWindows(decoded, powerShell, dir, depth+1); inner.stricter(v) {
+			v.Level = inner.Level
+			v.Reason += "; the payload " + inner.Reason
+		}
+	}
+	return v
+}
@@ -0,0 +1,26 @@
+package guard
+
+// Review is a second opinion on a command from outside the static rules, such
+// as a language model asked to rate its risk
+type Review struct {
+	Level      Level
+	Reversible bool
+	Rationale  string
+	By         string // Who reviewed it, e.g. the model name
+}
+
+// WithReview combines the verdict on command with a review of it. The stricter
+// of the two wins; on a tie the static rules keep the word, as they can point at
+// the offending part. The review is kept in either case so it can be shown.
+func (v Verdict) WithReview(command string, r Review) Verdict {
+	if r.Level > v.Level {
+		v = Verdict{
+			Level:  r.Level,
+			RuleID: "model-review",
+			Reason: r.Rationale,
+			Span:   Span{0, len(command)},
+		}
+	}
+	v.Review = &r
+	return v
+}
@@ -0,0 +1,133 @@
+package guard
+
+import (
+	"regexp"
+	"strings"
+)
+
+// blockDevice matches the device files of whole disks and partitions
+var blockDevice = regexp.MustCompile(`^/dev/(?:sd[a-z]+|hd[a-z]+|vd[a-z]+|xvd[a-z]+|nvme[0-9]+|disk[0-9]+|rdisk[0-9]+|mmcblk[0-9]+|md[0-9]+|dm-[0-9]+|loop[0-9]+|mapper/)`)
+
+// checkArgs evaluates a simple command whose wrappers were already removed.
+// Relative paths are resolved against dir. viaXargs is set when xargs runs it,
+// so more operands arrive on stdin.
+func checkArgs(words []word, dir string, viaXargs bool) Verdict {
+	name := commandName(words[0].text)
+	args := make([]string, 0, len(words)-1)
+	for _, w := range words[1:] {
+		args = append(args, w.text)
+	}
+	flags, operands := splitArgs(args)
+	span := Span{words[0].span.Start, words[len(words)-1].span.End}
+
+	verdict := func(level Level, rule, reason string) Verdict {
+		return Verdict{Level: level, RuleID: rule, Reason: reason, Span: span}
+	}
+
+	switch {
+	case name == "rm":
+		if hasFlag(flags, "", "no-preserve-root") {
+			return verdict(Blocked, "rm-no-preserve-root", "turns off rm's protection of the root directory")
+		}
+		if !hasFlag(flags, "rR", "recursive") {
+			break
+		}
+		if t := worstTarget(operands, dir, true); t.kind != "" {
+			return t.verdict(span, "rm", "recursively deletes ")
+		}
+		for _, op := range operands {
+			if _, ok := resolvePath(op, dir); !ok {
+				return verdict(Caution, "rm-dynamic-target", "recursively deletes a path that's only known at runtime ("+op+")")
+			}
+			if op == "*" || op == ".*" {
+				return verdict(Caution, "rm-glob", "recursively deletes everything in the current directory")
+			}
+		}
+		if viaXargs {
+			return verdict(Caution, "xargs-rm", "recursively deletes whatever paths arrive on stdin")
+		}
+	case name == "mkfs" || strings.HasPrefix(name, "mkfs."):
+		return verdict(Blocked, "mkfs", "formats a filesystem, erasing everything on the device")
+	case name == "dd":
+		for _, op := range operands {
+			if strings.HasPrefix(op, "of=") && blockDevice.MatchString(strings.TrimPrefix(op, "of=")) {
+				return verdict(Blocked, "dd-device", "writes raw data onto a disk device")
+			}
+		}
+	case name == "chmod" || name == "chown" || name == "chgrp":
+		if !hasFlag(flags, "R", "recursive") {
+			break
+		}
+		if t := worstTarget(operands, dir, false); t.kind != "" {
+			return t.verdict(span, name, "recursively changes permissions or ownership of ")
+		}
+	case name == "find":
+		if t := findDeletes(args, dir); t.kind != "" {
+			return t.verdict(span, "find-delete", "deletes files anywhere below ")
+		}
+	}
+	return checkPrivilege(name, args, span)
+}
+
+// findDeletes reports whether find deletes below a critical directory, either
+// with -delete or by running rm through -exec, and returns that directory
+func findDeletes(args []string, dir string) target {
+	var roots []string
+	i := 0
+	for ; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") || args[i] == "(" || args[i] == "!" {
+			break
+		}
+		roots = append(roots, args[i])
+	}
+	t := worstTarget(roots, dir, false)
+	if t.kind == "" {
+		return target{}
+	}
+
+	for ; i < len(args); i++ {
+		switch args[i] {
+		case "-delete":
+			return t
+		case "-exec", "-execdir", "-ok", "-okdir":
+			if i+1 < len(args) && commandName(args[i+1]) == "rm" {
+				return t
+			}
+		}
+	}
+	return target{}
+}
+
+// splitArgs separates options from operands, honouring "--"
+func splitArgs(args []string) (flags, operands []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return flags, append(operands, args[i+1:]...)
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			flags = append(flags, arg)
+		} else {
+			operands = append(operands, arg)
+		}
+	}
+	return flags, operands
+}
+
+// hasFlag reports whether one of the short letters (options may be combined, as
+// in -rf) or one of the long names is set
+func hasFlag(flags []string, short string, long ...string) bool {
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "--") {
+			for _, name := range long {
+				if flag == "--"+name {
+					return true
+				}
+			}
+			continue
+		}
+		if short != "" && strings.ContainsAny(flag[1:], short) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,373 @@
+package guard
+
+import (
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// maxNesting bounds how deep wrappers and nested scripts (sh -c, eval) are followed
+const maxNesting = 8
+
+// word is an argument of a simple command: its static text and where it is
+type word struct {
+	text string
+	span Span
+}
+
+// checkScript parses script as a shell program and returns the most severe verdict
+// for its simple commands and redirections, including those in pipelines, lists,
+// subshells and command substitutions. Relative paths are resolved against dir,
+// which follows the script's cd commands; "" means it's unknown. ok is false
+// when the script isn't valid sh/bash syntax.
+func checkScript(script, dir string, depth int) (v Verdict, ok bool) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	if err != nil {
+		return Verdict{Level: Safe}, false
+	}
+	v, _ = checkNode(file, dir, depth)
+	return v, true
+}
+
+// checkNode is checkScript for a node of a parsed script. It also returns the
+// directory the cd commands in node lead to.
+func checkNode(node syntax.Node, dir string, depth int) (v Verdict, after string) {
+	syntax.Walk(node, func(node syntax.Node) bool {
+		var found Verdict
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			found = checkPipeToInterpreter(n, dir, depth)
+			if sub := checkSubstToInterpreter(n, dir, depth); sub.stricter(found) {
+				found = sub
+			}
+			if exfil := checkExfiltration(n, dir); exfil.stricter(found) {
+				found = exfil
+			}
+			if sql := checkPipedSQL(n, dir); sql.stricter(found) {
+				found = sql
+			}
+			for _, r := range n.Redirs {
+				if writesTo(r.Op) && r.Word != nil && blockDevice.MatchString(wordText(r.Word)) {
+					found = Verdict{
+						Level:  Blocked,
+						RuleID: "redirect-device",
+						Reason: "writes output straight onto a disk device",
+						Span:   nodeSpan(r),
+					}
+				} else if sudoers := sudoersRedirect(r); sudoers.stricter(found) {
+					found = sudoers
+				}
+			}
+		case *syntax.CallExpr:
+			words := make([]word, 0, len(n.Args))
+			for _, w := range n.Args {
+				words = append(words, word{text: wordText(w), span: nodeSpan(w)})
+			}
+			if len(words) > 0 && commandName(words[0].text) == "cd" {
+				dir = changeDir(dir, words[1:])
+			}
+			found = checkCall(words, dir, depth)
+		}
+		if found.stricter(v) {
+			v = found
+		}
+		// Nothing is stricter than Blocked
+		return v.Level < Blocked
+	})
+	return v, dir
+}
+
+func nodeSpan(n syntax.Node) Span {
+	return Span{int(n.Pos().Offset()), int(n.End().Offset())}
+}
+
+// checkNested checks a script handed to sh -c, eval or su -c. The nested script
+// was unquoted, so its findings point at the whole argument it came from.
+func checkNested(script string, within Span, dir string, depth int) Verdict {
+	if depth >= maxNesting {
+		return Verdict{Level: Safe}
+	}
+	v, ok := checkScript(script, dir, depth+1)
+	if !ok {
+		v = checkUnparsed(script, dir, depth+1)
+	}
+	if v.Level != Safe {
+		v.Span = within
+		// It would only stand in for the nested script
+		v.Alternative = ""
+		v.inspect = nil
+	}
+	return v
+}
+
+// checkUnparsed checks sh-like text the parser rejects, such as a fish command.
+// It's split on quotes and separators like a Windows script, so each command
+// still meets the rules, packs and policy, and it's matched against the
+// regular expressions for what the split misses.
+func checkUnparsed(script, dir string, depth int) Verdict {
+	v := matchPatterns(script, Span{0, len(script)})
+	for _, words := range splitWindows(script, looseSh) {
+		if commandName(words[0].text) == "cd" {
+			dir = changeDir(dir, words[1:])
+		}
+		if found := checkCall(words, dir, depth); found.stricter(v) {
+			v = found
+		}
+		if v.Level == Blocked {
+			break
+		}
+	}
+	return v
+}
+
+// checkCall evaluates a simple command after peeling off wrappers such as
+// sudo, env or xargs that run the rest of their arguments as a command, runs
+// the rule packs that are turned on and lets the guard policy have the last
+// word. Running it as root is worth a second look even when the command itself
+// is harmless.
+func checkCall(words []word, dir string, depth int) Verdict {
+	if len(words) == 0 {
+		return Verdict{Level: Safe}
+	}
+	v := checkUnwrapped(words, dir, depth)
+	if e := escalation(words); e.stricter(v) {
+		return e
+	}
+	return v
+}
+
+func checkUnwrapped(words []word, dir string, depth int) Verdict {
+	viaXargs := false
+	for ; len(words) > 0 && depth < maxNesting; depth++ {
+		if script, within, ok := innerScript(words); ok {
+			return checkNested(script, within, dir, depth)
+		}
+		if commandName(words[0].text) == "xargs" {
+			viaXargs = true
+		}
+		inner, ok := unwrap(words)
+		if !ok {
+			break
+		}
+		words = inner
+	}
+	if len(words) == 0 {
+		return Verdict{Level: Safe}
+	}
+	v := checkArgs(words, dir, viaXargs)
+	if p := checkPacks(commandName(words[0].text), words, dir); p.stricter(v) {
+		v = p
+	}
+	return policy.apply(words, v)
+}
+
+func writesTo(op syntax.RedirOperator) bool {
+	switch op {
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut, syntax.RdrInOut:
+		return true
+	}
+	return false
+}
+
+// wordText returns what a word expands to as far as it's known without running
+// anything. Quotes and escapes are removed and $HOME becomes ~; other expansions
+// are kept as placeholders that never equal a literal path.
+func wordText(w *syntax.Word) string {
+	var sb strings.Builder
+	for _, part := range w.Parts {
+		writePart(&sb, part)
+	}
+	return sb.String()
+}
+
+func writePart(sb *strings.Builder, part syntax.WordPart) {
+	switch p := part.(type) {
+	case *syntax.Lit:
+		sb.WriteString(unescape(p.Value))
+	case *syntax.SglQuoted:
+		sb.WriteString(p.Value)
+	case *syntax.DblQuoted:
+		for _, q := range p.Parts {
+			writePart(sb, q)
+		}
+	case *syntax.ParamExp:
+		if p.Param == nil {
+			sb.WriteString("$?")
+			return
+		}
+		if p.Param.Value == "HOME" && p.Exp == nil && p.Repl == nil && p.Slice == nil && p.Index == nil && !p.Length && !p.Excl {
+			sb.WriteString("~")
+			return
+		}
+		sb.WriteString("$" + p.Param.Value)
+	default:
+		// Command and process substitutions are checked on their own by the walk
+		sb.WriteString("$(...)")
+	}
+}
+
+// unescape drops the backslashes of an unquoted literal, so \rm reads as rm
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// commandName normalizes the command word: /usr/bin/RM and rm are the same
+// command, and case-insensitive filesystems run either spelling
+func commandName(arg string) string {
+	if i := strings.LastIndex(arg, "/"); i >= 0 && i < len(arg)-1 {
+		arg = arg[i+1:]
+	}
+	return strings.ToLower(arg)
+}
+
+// shells whose -c option runs a script given as an argument
+var shells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "ash": true, "mksh": true,
+}
+
+// innerScript returns the script that sh -c, bash -lc, eval or su -c would run,
+// and the span of the arguments it was taken from
+func innerScript(words []word) (string, Span, bool) {
+	name := commandName(words[0].text)
+	switch {
+	case name == "eval":
+		if len(words) < 2 {
+			return "", Span{}, false
+		}
+		texts := make([]string, 0, len(words)-1)
+		for _, w := range words[1:] {
+			texts = append(texts, w.text)
+		}
+		return strings.Join(texts, " "), Span{words[1].span.Start, words[len(words)-1].span.End}, true
+	case shells[name]:
+		hasC := false
+		for i := 1; i < len(words); i++ {
+			arg := words[i].text
+			switch {
+			case arg == "-o" || arg == "+o":
+				i++
+			case arg == "--":
+				if hasC && i+1 < len(words) {
+					return words[i+1].text, words[i+1].span, true
+				}
+				return "", Span{}, false
+			case strings.HasPrefix(arg, "-") && len(arg) > 1:
+				if !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c") {
+					hasC = true
+				}
+			case strings.HasPrefix(arg, "+"):
+			default:
+				// Without -c the first operand is a script file
+				return arg, words[i].span, hasC
+			}
+		}
+	case name == "su":
+		for i := 1; i < len(words); i++ {
+			switch arg := words[i].text; {
+			case (arg == "-c" || arg == "--command") && i+1 < len(words):
+				return words[i+1].text, words[i+1].span, true
+			case strings.HasPrefix(arg, "--command="):
+				return strings.TrimPrefix(arg, "--command="), words[i].span, true
+			}
+		}
+	}
+	return "", Span{}, false
+}
+
+// wrappers maps commands that run the rest of their arguments as another command
+// to those of their options that take a separate value
+var wrappers = map[string][]string{
+	"sudo":    {"-u", "-g", "-h", "-p", "-C", "-D", "-r", "-t", "-U", "-T", "--user", "--group", "--host", "--prompt", "--close-from", "--chdir", "--role", "--type", "--other-user", "--command-timeout"},
+	"doas":    {"-u", "-C"},
+	"pkexec":  {"--user"},
+	"run0":    {"-u", "-g", "-D", "--user", "--group", "--chdir", "--setenv", "--unit", "--nice"},
+	"env":     {"-u", "-C", "--unset", "--chdir"},
+	"xargs":   {"-I", "-n", "-P", "-L", "-d", "-E", "-s", "-a", "--max-args", "--max-procs", "--max-lines", "--delimiter", "--eof", "--max-chars", "--arg-file", "--replace"},
+	"nice":    {"-n", "--adjustment"},
+	"nohup":   nil,
+	"time":    {"-f", "-o", "--format", "--output"},
+	"command": nil,
+	"builtin": nil,
+	"exec":    {"-a"},
+	"stdbuf":  {"-i", "-o", "-e", "--input", "--output", "--error"},
+	"ionice":  {"-c", "-n", "-p", "-P", "-u", "--class", "--classdata"},
+	"timeout": {"-s", "-k", "--signal", "--kill-after"},
+}
+
+// unwrap returns the command a wrapper runs, without the wrapper and its options.
+// ok is false when words isn't a wrapper or the wrapper runs nothing.
+func unwrap(words []word) ([]word, bool) {
+	name := commandName(words[0].text)
+	valueOpts, isWrapper := wrappers[name]
+	if !isWrapper {
+		return nil, false
+	}
+
+	rest := words[1:]
+	for len(rest) > 0 {
+		arg := rest[0].text
+		if arg == "--" {
+			rest = rest[1:]
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+		switch {
+		case name == "command" && (arg == "-v" || arg == "-V"):
+			// Only looks the command up
+			return nil, false
+		case name == "env" && (arg == "-S" || arg == "--split-string"):
+			if len(rest) < 2 {
+				return nil, false
+			}
+			return append(splitWord(rest[1].text, rest[1].span), rest[2:]...), true
+		case name == "env" && strings.HasPrefix(arg, "--split-string="):
+			return append(splitWord(strings.TrimPrefix(arg, "--split-string="), rest[0].span), rest[1:]...), true
+		case name == "env" && strings.HasPrefix(arg, "-S"):
+			return append(splitWord(arg[2:], rest[0].span), rest[1:]...), true
+		}
+		rest = rest[1:]
+		for _, opt := range valueOpts {
+			if arg == opt && len(rest) > 0 {
+				rest = rest[1:]
+				break
+			}
+		}
+	}
+
+	switch name {
+	case "env":
+		for len(rest) > 0 && strings.Contains(rest[0].text, "=") {
+			rest = rest[1:]
+		}
+	case "timeout":
+		// The duration comes first
+		if len(rest) > 0 {
+			rest = rest[1:]
+		}
+	}
+	return rest, len(rest) > 0
+}
+
+// splitWord splits the argument of env -S into words that all point at it
+func splitWord(text string, span Span) []word {
+	var words []word
+	for _, field := range strings.Fields(text) {
+		words = append(words, word{text: field, span: span})
+	}
+	return words
+}
@@ -0,0 +1,583 @@
+package guard
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// winSyntax selects the quoting rules and separators of a Windows shell, or of
+// sh-like text the sh parser rejects
+type winSyntax int
+
+const (
+	powerShell winSyntax = iota
+	cmdExe
+	// Such as fish's (...) substitutions and for ... end loops
+	looseSh
+)
+
+// checkWindows splits a PowerShell or cmd.exe script into simple commands and
+// returns the most severe verdict among them
+func checkWindows(script string, syn winSyntax, dir string, depth int) Verdict {
+	v := Verdict{Level: Safe}
+	commands := splitWindows(script, syn)
+	if syn == powerShell {
+		v = checkPowerShellRemote(script, commands, dir, depth)
+	}
+	for _, words := range commands {
+		var found Verdict
+		if syn == powerShell {
+			found = checkPowerShellCall(words, dir, depth)
+		} else {
+			found = checkCmdCall(words, dir, depth)
+		}
+		if p := checkPacks(winCommandName(words[0].text), words, dir); p.stricter(found) {
+			found = p
+		}
+		found = policy.apply(words, found)
+		if found.stricter(v) {
+			v = found
+		}
+		if v.Level == Blocked {
+			break
+		}
+	}
+	return v
+}
+
+// checkWindowsNested checks a script handed to cmd /c, powershell -Command or
+// Invoke-Expression. Like checkNested, findings point at the whole argument.
+func checkWindowsNested(script string, syn winSyntax, within Span, dir string, depth int) Verdict {
+	if depth >= maxNesting {
+		return Verdict{Level: Safe}
+	}
+	v := checkWindows(script, syn, dir, depth+1)
+	if v.Level != Safe {
+		v.Span = within
+		// It would only stand in for the nested script
+		v.Alternative = ""
+		v.inspect = nil
+	}
+	return v
+}
+
+// splitWindows splits a script into simple commands. There is no parser for these
+// shells, or the script didn't parse, so it only knows quotes, escapes and
+// separators. A group in parentheses
+// or braces is split as commands of its own and stands in the enclosing command
+// as the placeholder word $(...), which never equals a literal path.
+func splitWindows(script string, syn winSyntax) [][]word {
+	type frame struct {
+		words []word
+		start int
+	}
+	var (
+		done  [][]word
+		stack []frame
+		cur   []word
+		text  strings.Builder
+		start = -1 // Where the current word starts, -1 between words
+		// Parentheses opened inside the current word, as in .DownloadString(...)
+		wordParens = 0
+	)
+	endWord := func(end int) {
+		if start >= 0 {
+			cur = append(cur, word{text: text.String(), span: Span{start, end}})
+			text.Reset()
+			start = -1
+			wordParens = 0
+		}
+	}
+	endCommand := func(end int) {
+		endWord(end)
+		if len(cur) > 0 {
+			done = append(done, cur)
+		}
+		cur = nil
+	}
+	opens := func(i int) int {
+		c := script[i]
+		switch {
+		case c == '(', c == '{' && syn == powerShell:
+			return 1
+		case (c == '$' || c == '@') && syn != cmdExe && i+1 < len(script) && script[i+1] == '(':
+			return 2
+		}
+		return 0
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		if n := opens(i); n > 0 && start < 0 {
+			stack = append(stack, frame{words: cur, start: i})
+			cur = nil
+			i += n
+			continue
+		}
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || (syn == cmdExe && (c == ',' || c == ';' || c == '=')):
+			endWord(i)
+			i++
+		case c == '\n' || c == '|' || c == '&' || (c == ';' && syn != cmdExe):
+			// The PowerShell call operator & starts a command as well
+			endCommand(i)
+			i++
+		case c == ')' && wordParens > 0:
+			text.WriteByte(c)
+			wordParens--
+			i++
+		case c == ')' || (c == '}' && syn == powerShell):
+			endCommand(i)
+			i++
+			if len(stack) > 0 {
+				f := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				cur = append(f.words, word{text: "$(...)", span: Span{f.start, i}})
+			}
+		case c == '#' && syn != cmdExe && start < 0:
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case c == '\'' && syn != cmdExe:
+			if start < 0 {
+				start = i
+			}
+			for i++; i < len(script); i++ {
+				if script[i] == '\'' {
+					if syn == powerShell && i+1 < len(script) && script[i+1] == '\'' {
+						text.WriteByte('\'')
+						i++
+						continue
+					}
+					break
+				}
+				text.WriteByte(script[i])
+			}
+			i++
+		case c == '"':
+			if start < 0 {
+				start = i
+			}
+			for i++; i < len(script) && script[i] != '"'; i++ {
+				if (syn == powerShell && script[i] == '`' || syn == looseSh && script[i] == '\\') && i+1 < len(script) {
+					i++
+				}
+				text.WriteByte(script[i])
+			}
+			i++
+		case (c == '`' && syn == powerShell) || (c == '^' && syn == cmdExe) || (c == '\\' && syn == looseSh):
+			if i+1 < len(script) && (script[i+1] == '\n' || script[i+1] == '\r') {
+				// Line continuation
+				endWord(i)
+				i += 2
+				continue
+			}
+			if start < 0 {
+				start = i
+			}
+			if i+1 < len(script) {
+				text.WriteByte(script[i+1])
+			}
+			i += 2
+		default:
+			if start < 0 {
+				start = i
+			}
+			if c == '(' {
+				wordParens++
+			}
+			text.WriteByte(c)
+			i++
+		}
+	}
+	endCommand(len(script))
+	// Groups that were never closed
+	for j := len(stack) - 1; j >= 0; j-- {
+		if len(stack[j].words) > 0 {
+			done = append(done, stack[j].words)
+		}
+	}
+	return done
+}
+
+// winCommandName normalizes a Windows command word: C:\Windows\System32\cmd.exe,
+// CMD and cmd are the same command
+func winCommandName(arg string) string {
+	if i := strings.LastIndexAny(arg, `\/`); i >= 0 && i < len(arg)-1 {
+		arg = arg[i+1:]
+	}
+	return strings.TrimSuffix(strings.ToLower(arg), ".exe")
+}
+
+// psAliases maps the built-in PowerShell aliases of the cmdlets the guard knows
+// to their names
+var psAliases = map[string]string{
+	"rm":    "remove-item",
+	"ri":    "remove-item",
+	"del":   "remove-item",
+	"erase": "remove-item",
+	"rd":    "remove-item",
+	"rmdir": "remove-item",
+	"iex":   "invoke-expression",
+}
+
+// checkPowerShellCall evaluates a simple PowerShell command
+func checkPowerShellCall(words []word, dir string, depth int) Verdict {
+	// $x = <command> runs the command
+	if len(words) > 2 && strings.HasPrefix(words[0].text, "$") && words[1].text == "=" {
+		words = words[2:]
+	}
+	if name := winCommandName(words[0].text); (name == "sudo" || name == "gsudo") && len(words) > 1 {
+		words = words[1:]
+	}
+
+	name := winCommandName(words[0].text)
+	if cmdlet, ok := psAliases[name]; ok {
+		// Models like to write cmd.exe's rd /s /q and del /s in PowerShell too.
+		// It fails there, but rate it as meant in case it runs in cmd.exe after all.
+		if flags, _ := cmdArgs(words[1:]); flags["s"] && name != "rm" && name != "ri" {
+			return checkCmdCall(words, dir, depth)
+		}
+		name = cmdlet
+	}
+	span := Span{words[0].span.Start, words[len(words)-1].span.End}
+	verdict := func(level Level, rule, reason string) Verdict {
+		return Verdict{Level: level, RuleID: rule, Reason: reason, Span: span}
+	}
+
+	switch name {
+	case "remove-item":
+		switches, named, positional := psArgs(words[1:], "path", "literalpath", "pspath", "lp", "filter", "include", "exclude", "credential", "stream")
+		if !hasSwitch(switches, "recurse") {
+			break
+		}
+		paths := append(append(named["path"], named["literalpath"]...), positional...)
+		paths = append(append(paths, named["pspath"]...), named["lp"]...)
+		if len(paths) == 0 {
+			return verdict(Caution, "remove-item-pipeline", "recursively deletes whatever paths arrive from the pipeline")
+		}
+		kind := winCritical(paths)
+		if t := winLocalTarget(paths, dir); t.kind != "" && t.level > winLevels[kind] {
+			return t.verdict(span, "remove-item", "recursively deletes ")
+		}
+		switch kind {
+		case "root":
+			return verdict(Blocked, "remove-item-root", "recursively deletes a drive or a system directory")
+		case "home":
+			return verdict(Danger, "remove-item-home", "recursively deletes the user profile")
+		case "dynamic":
+			return verdict(Caution, "remove-item-dynamic-target", "recursively deletes a path that's only known at runtime")
+		case "glob":
+			return verdict(Caution, "remove-item-glob", "recursively deletes everything in the current directory")
+		}
+	case "format-volume", "clear-disk", "initialize-disk", "remove-partition":
+		return verdict(Blocked, name, "erases a disk or partition")
+	case "diskpart":
+		return verdict(Danger, "diskpart", "partitions disks, one clean command wipes a whole disk")
+	case "format":
+		if formatsDrive(words[1:]) {
+			return verdict(Blocked, "format", "formats a drive, erasing everything on it")
+		}
+	case "set-executionpolicy":
+		_, named, positional := psArgs(words[1:], "executionpolicy", "scope")
+		value := strings.ToLower(strings.Join(append(named["executionpolicy"], positional...), " "))
+		if !strings.Contains(value, "unrestricted") && !strings.Contains(value, "bypass") {
+			break
+		}
+		if scope := named["scope"]; len(scope) > 0 && strings.EqualFold(scope[0], "process") {
+			return verdict(Caution, "execution-policy", "turns off script signing checks for this PowerShell session")
+		}
+		return verdict(Danger, "execution-policy", "turns off script signing checks for PowerShell")
+	case "invoke-expression":
+		if len(words) > 1 {
+			_, named, positional := psArgs(words[1:], "command")
+			script := strings.Join(append(named["command"], positional...), " ")
+			return checkWindowsNested(script, powerShell, Span{words[1].span.Start, span.End}, dir, depth)
+		}
+	case "powershell", "pwsh", "cmd":
+		return checkShellCommand(name, words, dir, depth)
+	}
+	return Verdict{Level: Safe}
+}
+
+// checkCmdCall evaluates a simple cmd.exe command
+func checkCmdCall(words []word, dir string, depth int) Verdict {
+	name := winCommandName(words[0].text)
+	span := Span{words[0].span.Start, words[len(words)-1].span.End}
+	verdict := func(level Level, rule, reason string) Verdict {
+		return Verdict{Level: level, RuleID: rule, Reason: reason, Span: span}
+	}
+	flags, operands := cmdArgs(words[1:])
+
+	switch name {
+	case "rd", "rmdir":
+		if !flags["s"] {
+			break
+		}
+		kind := winCritical(operands)
+		if t := winLocalTarget(operands, dir); t.kind != "" && t.level > winLevels[kind] {
+			return t.verdict(span, "rd", "deletes ")
+		}
+		switch kind {
+		case "root":
+			return verdict(Blocked, "rd-root", "deletes a drive or a system directory with everything below it")
+		case "home":
+			return verdict(Danger, "rd-home", "deletes the user profile with everything below it")
+		case "dynamic":
+			return verdict(Caution, "rd-dynamic-target", "deletes a directory that's only known at runtime with everything below it")
+		}
+	case "del", "erase":
+		if !flags["s"] {
+			break
+		}
+		kind := winCritical(operands)
+		if t := winLocalTarget(operands, dir); t.kind != "" && t.level > winLevels[kind] {
+			return t.verdict(span, "del", "deletes files in ")
+		}
+		switch kind {
+		case "root":
+			return verdict(Blocked, "del-root", "deletes files on a whole drive or in a system directory")
+		case "home":
+			return verdict(Danger, "del-home", "deletes files everywhere in the user profile")
+		}
+		if flags["q"] {
+			return verdict(Caution, "del-recursive", "deletes matching files in every subdirectory without asking")
+		}
+	case "format":
+		if formatsDrive(words[1:]) {
+			return verdict(Blocked, "format", "formats a drive, erasing everything on it")
+		}
+	case "diskpart":
+		return verdict(Danger, "diskpart", "partitions disks, one clean command wipes a whole disk")
+	case "powershell", "pwsh", "cmd":
+		return checkShellCommand(name, words, dir, depth)
+	}
+	return Verdict{Level: Safe}
+}
+
+// checkShellCommand checks the script of powershell -Command and cmd /c, which
+// either shell may start
+func checkShellCommand(name string, words []word, dir string, depth int) Verdict {
+	for i := 1; i < len(words); i++ {
+		arg := strings.ToLower(words[i].text)
+		var found bool
+		if name == "cmd" {
+			found = arg == "/c" || arg == "/k"
+		} else {
+			opt := strings.TrimLeft(arg, "-/")
+			if opt != arg && i+1 < len(words) && (opt == "e" || opt == "ec" || (len(opt) >= 3 && strings.HasPrefix("encodedcommand", opt))) {
+				return encodedVerdict("encoded-command", "runs a base64 encoded PowerShell command, hiding what it does", decode(words[i+1].text, false), words[i+1].span, dir, depth)
+			}
+			found = opt != arg && (opt == "c" || (len(opt) >= 3 && strings.HasPrefix("command", opt)))
+		}
+		if !found || i+1 >= len(words) {
+			continue
+		}
+
+		rest := words[i+1:]
+		texts := make([]string, 0, len(rest))
+		for _, w := range rest {
+			texts = append(texts, w.text)
+		}
+		syn := powerShell
+		if name == "cmd" {
+			syn = cmdExe
+		}
+		return checkWindowsNested(strings.Join(texts, " "), syn, Span{rest[0].span.Start, rest[len(rest)-1].span.End}, dir, depth)
+	}
+	return Verdict{Level: Safe}
+}
+
+// psArgs sorts PowerShell arguments into switches, the values of named
+// parameters and positional arguments. Parameter names are case-insensitive and
+// may be abbreviated; valueParams are the parameters that take a value.
+func psArgs(words []word, valueParams ...string) (switches []string, named map[string][]string, positional []string) {
+	named = map[string][]string{}
+	for i := 0; i < len(words); i++ {
+		arg := words[i].text
+		if len(arg) < 2 || arg[0] != '-' || !isLetter(arg[1]) {
+			positional = append(positional, arg)
+			continue
+		}
+
+		param, value, hasValue := strings.Cut(strings.ToLower(arg[1:]), ":")
+		full := ""
+		for _, p := range valueParams {
+			if strings.HasPrefix(p, param) {
+				full = p
+				break
+			}
+		}
+		switch {
+		case full == "":
+			if value != "$false" {
+				switches = append(switches, param)
+			}
+		case hasValue:
+			named[full] = append(named[full], arg[len(arg)-len(value):])
+		case i+1 < len(words):
+			i++
+			named[full] = append(named[full], words[i].text)
+		}
+	}
+	return switches, named, positional
+}
+
+// hasSwitch reports whether one of the switches is name or an abbreviation of it
+func hasSwitch(switches []string, name string) bool {
+	for _, s := range switches {
+		if strings.HasPrefix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// cmdArgs sorts cmd.exe arguments into the letters of /x switches, which may
+// be combined as in /s/q, and operands
+func cmdArgs(words []word) (map[string]bool, []string) {
+	flags := map[string]bool{}
+	var operands []string
+	for _, w := range words {
+		if len(w.text) < 2 || w.text[0] != '/' || strings.ContainsAny(w.text, `\.:*`) {
+			operands = append(operands, w.text)
+			continue
+		}
+		for _, f := range strings.Split(strings.ToLower(w.text[1:]), "/") {
+			flags[f] = true
+		}
+	}
+	return flags, operands
+}
+
+// driveLetter matches a bare drive such as C:
+var driveLetter = regexp.MustCompile(`^[A-Za-z]:\\?$`)
+
+// formatsDrive reports whether format is given a drive rather than, say, the
+// PowerShell Format-* style arguments
+func formatsDrive(args []word) bool {
+	for _, a := range args {
+		if driveLetter.MatchString(a.text) {
+			return true
+		}
+	}
+	return false
+}
+
+// winVars are the variables that name critical directories, in PowerShell and
+// cmd.exe spelling, and what they usually expand to
+var winVars = []struct{ name, value string }{
+	{"$env:systemdrive", "c:"},
+	{"%systemdrive%", "c:"},
+	{"$env:systemroot", `c:\windows`},
+	{"%systemroot%", `c:\windows`},
+	{"$env:windir", `c:\windows`},
+	{"%windir%", `c:\windows`},
+	{"$env:programfiles", `c:\program files`},
+	{"%programfiles%", `c:\program files`},
+	{"$env:userprofile", "~"},
+	{"%userprofile%", "~"},
+	{"${home}", "~"},
+	{"$home", "~"},
+}
+
+// winSystemDirs may not be deleted any more than the drive they are on
+var winSystemDirs = map[string]bool{
+	`\windows`:             true,
+	`\windows\system32`:    true,
+	`\program files`:       true,
+	`\program files (x86)`: true,
+	`\programdata`:         true,
+	`\users`:               true,
+}
+
+// winCritical classifies the paths given to a recursive delete on Windows:
+// "root" for a drive or system directory, "home" for the user profile, and
+// otherwise "dynamic" for a path only known at runtime or "glob" for everything
+// in the current directory. Comma separated PowerShell lists are split.
+func winCritical(paths []string) string {
+	kind := ""
+	rank := map[string]int{"glob": 1, "dynamic": 2, "home": 3}
+	found := func(k string) {
+		if rank[k] > rank[kind] {
+			kind = k
+		}
+	}
+	for _, arg := range paths {
+		for _, p := range strings.Split(arg, ",") {
+			p = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(p), "/", `\`))
+			if p == "" {
+				continue
+			}
+			if strings.Contains(p, "*") && strings.Trim(p, `*.\`) == "" {
+				// *, **, *.* or .\*, which TrimRight would leave empty
+				found("glob")
+				continue
+			}
+			for _, v := range winVars {
+				p = strings.ReplaceAll(p, v.name, v.value)
+			}
+			if p == "~" || strings.HasPrefix(p, `~\`) {
+				// The profile is a directory in \users, so ~\.. is \users
+				p = `c:\users\~` + p[1:]
+			}
+			p = winClean(strings.TrimRight(p, `\*`))
+
+			drive := len(p) >= 2 && p[1] == ':' && isLetter(p[0])
+			rest := p
+			if drive {
+				rest = p[2:]
+			}
+			switch {
+			case rest == "", winSystemDirs[rest]:
+				return "root"
+			case drive && strings.HasPrefix(rest, `\users\`) && !strings.Contains(rest[len(`\users\`):], `\`):
+				found("home")
+			case strings.ContainsAny(p, "$%"):
+				found("dynamic")
+			}
+		}
+	}
+	return kind
+}
+
+// winClean resolves . and .. in a path from the root of a drive, as in
+// c:\users\me\..\.., which is c:
+func winClean(p string) string {
+	prefix, rest := "", p
+	if len(p) >= 2 && p[1] == ':' && isLetter(p[0]) {
+		prefix, rest = p[:2], p[2:]
+	}
+	if !strings.HasPrefix(rest, `\`) {
+		return p
+	}
+	rest = strings.ReplaceAll(path.Clean(strings.ReplaceAll(rest, `\`, "/")), "/", `\`)
+	return prefix + strings.TrimSuffix(rest, `\`)
+}
+
+// winLevels are the levels winCritical's kinds are reported with
+var winLevels = map[string]Level{"root": Blocked, "home": Danger, "dynamic": Caution, "glob": Caution}
+
+// winLocalTarget rates the relative paths of a recursive delete, such as . or
+// ..\src, the way the POSIX rules do: resolved against the working directory,
+// which may turn out to be the home directory or a git repository.
+func winLocalTarget(paths []string, dir string) target {
+	var local []string
+	for _, arg := range paths {
+		for _, p := range strings.Split(arg, ",") {
+			p = strings.ReplaceAll(strings.TrimSpace(p), `\`, "/")
+			drive := len(p) >= 2 && p[1] == ':' && isLetter(p[0])
+			if p == "" || drive || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "~") || strings.ContainsAny(p, "$%") {
+				continue
+			}
+			local = append(local, p)
+		}
+	}
+	return worstTarget(local, dir, true)
+}
@@ -0,0 +1,193 @@
+// Package history records every generated command in ~/.baomihua/history.jsonl,
+// one JSON document per line, so earlier answers can be searched and replayed.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"baomihua/llm"
+)
+
+// maxLineBytes bounds a single history line when reading the file back
+const maxLineBytes = 1024 * 1024
+
+// Entry is a single generation and what became of it
+type Entry struct {
+	Time     time.Time   `json:"time"`
+	CWD      string      `json:"cwd"`
+	Prompt   string      `json:"prompt"`
+	Model    string      `json:"model"`
+	Result   *llm.Result `json:"result"`
+	Guard    string      `json:"guard"`                // Guard level the command was shown with
+	Rule     string      `json:"guard_rule,omitempty"` // Guard rule behind that level, if any
+	Action   string      `json:"action"`               // What the user did with the command, e.g. "execute" or "copy"
+	ExitCode *int        `json:"exit_code,omitempty"`  // Only set when the command ran
+}
+
+// Command is the generated command, or "" for an entry without a result
+func (e Entry) Command() string {
+	if e.Result == nil {
+		return ""
+	}
+	return e.Result.Command
+}
+
+// Dir returns the directory the entry was generated in, where a replay runs,
+// or "" when it wasn't recorded or doesn't exist anymore
+func (e Entry) Dir() string {
+	if e.CWD == "" {
+		return ""
+	}
+	if info, err := os.Stat(e.CWD); err != nil || !info.IsDir() {
+		return ""
+	}
+	return e.CWD
+}
+
+// Path returns the location of the history file
+func Path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".baomihua", "history.jsonl"), nil
+}
+
+// Append adds an entry to the history file
+func Append(e Entry) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	return appendEntry(path, e)
+}
+
+// Load reads the whole history, oldest entry first
+func Load() ([]Entry, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return loadFile(path)
+}
+
+func appendEntry(path string, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Prompts and commands may contain hostnames or paths the user considers private
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func loadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		var e Entry
+		// A line cut short by a crash or written by a newer version is skipped
+		// rather than hiding the rest of the history
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Command() == "" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Search returns the entries whose prompt or command fuzzy matches query, best
+// match first. Every space separated word of the query has to match. Ties and an
+// empty query are ordered newest first.
+func Search(entries []Entry, query string) []Entry {
+	type match struct {
+		entry Entry
+		score int
+		index int
+	}
+
+	words := strings.Fields(query)
+	var matches []match
+	for i, e := range entries {
+		text := e.Prompt + "\n" + e.Command()
+		total := 0
+		ok := true
+		for _, w := range words {
+			score, found := fuzzyScore(w, text)
+			if !found {
+				ok = false
+				break
+			}
+			total += score
+		}
+		if ok {
+			matches = append(matches, match{entry: e, score: total, index: i})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].index > matches[j].index
+	})
+
+	result := make([]Entry, len(matches))
+	for i, m := range matches {
+		result[i] = m.entry
+	}
+	return result
+}
+
+// fuzzyScore reports whether the runes of query appear in text in order, ignoring
+// case. Runs of consecutive runes and matches at the start of a word score higher.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+
+	score, qi, prev := 0, 0, -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		if ti == prev+1 {
+			score += 2
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 3
+		}
+		prev = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
@@ -0,0 +1,128 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"baomihua/llm"
+)
+
+func entry(prompt, command string) Entry {
+	return Entry{Prompt: prompt, Result: &llm.Result{Command: command}}
+}
+
+func TestAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".baomihua", "history.jsonl")
+
+	if entries, err := loadFile(path); err != nil || entries != nil {
+		t.Fatalf("expected no history yet, got %v (%v)", entries, err)
+	}
+
+	code := 3
+	first := entry("clean up docker", "docker system prune -f")
+	first.Time = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first.Action = "execute"
+	first.ExitCode = &code
+	second := entry("list files", "ls -la")
+	second.Action = "copy"
+
+	for _, e := range []Entry{first, second} {
+		if err := appendEntry(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A truncated line must not hide the entries around it
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"prompt": "cut sh` + "\n")
+	f.Close()
+	if err := appendEntry(path, entry("disk usage", "du -sh .")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %+v", len(entries), entries)
+	}
+	got := entries[0]
+	if got.Command() != "docker system prune -f" || !got.Time.Equal(first.Time) || got.ExitCode == nil || *got.ExitCode != 3 {
+		t.Errorf("first entry didn't round-trip: %+v", got)
+	}
+	if entries[1].ExitCode != nil {
+		t.Errorf("an entry that didn't run shouldn't have an exit code: %+v", entries[1])
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the history file to be private, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	entries := []Entry{
+		entry("clean up docker images", "docker image prune -a"),
+		entry("show disk usage", "du -sh * | sort -h"),
+		entry("remove stopped containers", "docker container prune"),
+		entry("清理 docker 缓存", "docker builder prune"),
+	}
+
+	if got := Search(entries, ""); len(got) != 4 || got[0].Command() != "docker builder prune" {
+		t.Errorf("an empty query should list everything newest first, got %+v", got)
+	}
+
+	got := Search(entries, "dkr prune")
+	if len(got) != 3 {
+		t.Fatalf("expected the three docker entries, got %+v", got)
+	}
+	for _, e := range got {
+		if e.Command() == "du -sh * | sort -h" {
+			t.Errorf("unexpected match %q", e.Command())
+		}
+	}
+
+	if got := Search(entries, "DISK"); len(got) == 0 || got[0].Prompt != "show disk usage" {
+		t.Errorf("expected a case-insensitive match on the prompt first, got %+v", got)
+	}
+	if got := Search(entries, "缓存"); len(got) != 1 {
+		t.Errorf("expected a match on the Chinese prompt, got %+v", got)
+	}
+	if got := Search(entries, "kubectl"); len(got) != 0 {
+		t.Errorf("expected no matches, got %+v", got)
+	}
+
+	// A contiguous word beats scattered letters
+	got = Search([]Entry{entry("", "git log --oneline"), entry("", "glob -o")}, "log")
+	if got[0].Command() != "git log --oneline" {
+		t.Errorf("expected the contiguous match first, got %+v", got)
+	}
+}
+
+func TestEntryDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cwd  string
+		want string
+	}{
+		{dir, dir},
+		{"", ""},
+		{filepath.Join(dir, "gone"), ""},
+		{file, ""},
+	}
+	for _, tt := range tests {
+		if got := (Entry{CWD: tt.cwd}).Dir(); got != tt.want {
+			t.Errorf("Entry{CWD: %q}.Dir() = %q, want %q", tt.cwd, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -32,6 +33,10 @@ type ChatCompletionChunk struct {
 	} `json:"choices"`
 }
 
+// ErrInvalidResponse is wrapped by parse errors, so callers can tell a malformed
+// model response apart from a failed vendor request
+var ErrInvalidResponse = errors.New("invalid model response")
+
 // Result models the final JSON outcome expected from the LLM
 type Result struct {
 	Explanation string `json:"explanation"`
@@ -40,14 +45,23 @@ type Result struct {
 
 // StreamCompletion sends the request to the LLM and streams the response back via a channel
 func StreamCompletion(prompt string, ctx EnvContext, contentChan chan<- string, errChan chan<- error) {
+	StreamChat(BuildSystemPrompt(ctx), prompt, contentChan, errChan)
+}
+
+// StreamChat sends prompt with a custom system prompt to the configured model
+// and streams the response back via a channel
+func StreamChat(sysPrompt, prompt string, contentChan chan<- string, errChan chan<- error) {
+	StreamChatWith(config.GetModel(), sysPrompt, prompt, contentChan, errChan)
+}
+
+// StreamChatWith is StreamChat for a given model, "vendor/model" or a bare model name
+func StreamChatWith(model, sysPrompt, prompt string, contentChan chan<- string, errChan chan<- error) {
 	if GlobalRegistry == nil {
 		InitRegistry()
 		// Attempt to load without forcing refresh, ignore error if it fails to load some models
 		_ = GlobalRegistry.LoadModels(false)
 	}
 
-	model := config.GetModel()
-
 	actualModelName := model
 	var vendorName string
 	parts := strings.SplitN(model, "/", 2)
@@ -75,15 +89,13 @@ func StreamCompletion(prompt string, ctx EnvContext, contentChan chan<- string,
 		return
 	}
 
-	provider.StreamCompletion(actualModelName, prompt, ctx, contentChan, errChan)
+	provider.StreamCompletion(actualModelName, sysPrompt, prompt, contentChan, errChan)
 }
 
-func (p *OpenAICompatibleProvider) StreamCompletion(model, prompt string, ctx EnvContext, contentChan chan<- string, errChan chan<- error) {
+func (p *OpenAICompatibleProvider) StreamCompletion(model, sysPrompt, prompt string, contentChan chan<- string, errChan chan<- error) {
 	defer close(contentChan)
 	defer close(errChan)
 
-	sysPrompt := BuildSystemPrompt(ctx)
-
 	reqBody := ChatRequest{
 		Model: model,
 		Messages: []Message{
@@ -155,6 +167,67 @@ func (p *OpenAICompatibleProvider) StreamCompletion(model, prompt string, ctx En
 	}
 }
 
+// Generate streams a completion for prompt, waits for it to finish and parses the result
+func Generate(prompt string, ctx EnvContext) (*Result, error) {
+	raw, err := Complete(BuildSystemPrompt(ctx), prompt)
+	if err != nil {
+		return nil, err
+	}
+	return ParseResult(raw)
+}
+
+// Complete sends prompt with a custom system prompt and waits for the full response
+func Complete(sysPrompt, prompt string) (string, error) {
+	return CompleteWith(config.GetModel(), sysPrompt, prompt)
+}
+
+// CompleteWith is Complete for a given model
+func CompleteWith(model, sysPrompt, prompt string) (string, error) {
+	contentChan := make(chan string)
+	errChan := make(chan error)
+
+	go StreamChatWith(model, sysPrompt, prompt, contentChan, errChan)
+
+	var sb strings.Builder
+	for contentChan != nil || errChan != nil {
+		select {
+		case content, ok := <-contentChan:
+			if !ok {
+				contentChan = nil
+			} else {
+				sb.WriteString(content)
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+			} else if err != nil {
+				// The stream may still be sending, it would block forever without a reader
+				go drain(contentChan, errChan)
+				return "", err
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// drain reads a stream until both of its channels are closed, so the goroutine
+// writing to it can finish after its reader gave up
+func drain(contentChan <-chan string, errChan <-chan error) {
+	for contentChan != nil || errChan != nil {
+		select {
+		case _, ok := <-contentChan:
+			if !ok {
+				contentChan = nil
+			}
+		case _, ok := <-errChan:
+			if !ok {
+				errChan = nil
+			}
+		}
+	}
+}
+
 // ParseResult parses the accumulated raw string from the stream into Result
 func ParseResult(raw string) (*Result, error) {
 	// Use regex to locate the outermost JSON object{} to strip away potential <think> tags or conversational filler
@@ -162,12 +235,12 @@ func ParseResult(raw string) (*Result, error) {
 	jsonBytes := re.Find([]byte(raw))
 
 	if len(jsonBytes) == 0 {
-		return nil, fmt.Errorf("could not locate valid JSON object in response: (raw response: %s)", raw)
+		return nil, fmt.Errorf("%w: could not locate valid JSON object in response: (raw response: %s)", ErrInvalidResponse, raw)
 	}
 
 	var res Result
 	if err := json.Unmarshal(jsonBytes, &res); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w (raw response: %s)", err, raw)
+		return nil, fmt.Errorf("%w: failed to unmarshal JSON: %v (raw response: %s)", ErrInvalidResponse, err, raw)
 	}
 	return &res, nil
 }
@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingProvider reports an error and keeps streaming afterwards
+type failingProvider struct {
+	done chan struct{}
+}
+
+func (p failingProvider) Name() string                          { return "failing" }
+func (p failingProvider) GetAvailableModels() ([]string, error) { return nil, nil }
+
+func (p failingProvider) StreamCompletion(model, sysPrompt, prompt string, contentChan chan<- string, errChan chan<- error) {
+	defer close(p.done)
+	defer close(contentChan)
+	defer close(errChan)
+	errChan <- errors.New("rate limited")
+	contentChan <- "late"
+	errChan <- errors.New("stream closed")
+}
+
+func TestCompleteWithErrorDrainsStream(t *testing.T) {
+	defer func(r *ModelRegistry) { GlobalRegistry = r }(GlobalRegistry)
+	p := failingProvider{done: make(chan struct{})}
+	GlobalRegistry = &ModelRegistry{providers: []Provider{p}, models: map[string]string{}}
+
+	if _, err := CompleteWith("failing/model", "system", "prompt"); err == nil || err.Error() != "rate limited" {
+		t.Fatalf("CompleteWith returned %v, want the stream's first error", err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the stream is still blocked after CompleteWith returned")
+	}
+}
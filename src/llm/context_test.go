@@ -23,3 +23,46 @@ func TestBuildSystemPrompt(t *testing.T) {
 		t.Errorf("Expected prompt to contain CWD info")
 	}
 }
+
+func TestBuildSystemPromptWorkspace(t *testing.T) {
+	ctx := EnvContext{OS: "linux", Shell: "/bin/bash", CWD: "/src"}
+	if strings.Contains(BuildSystemPrompt(ctx), "WORKSPACE SNAPSHOT") {
+		t.Errorf("Expected no workspace section without a snapshot")
+	}
+
+	ctx.Workspace = "Project files:\n- go.mod: Go module demo"
+	if !strings.Contains(BuildSystemPrompt(ctx), "go.mod: Go module demo") {
+		t.Errorf("Expected prompt to contain workspace snapshot")
+	}
+}
+
+func TestShellKind(t *testing.T) {
+	tests := map[string]string{
+		"/bin/zsh":                       "zsh",
+		"/usr/local/bin/bash":            "bash",
+		"/usr/bin/fish":                  "fish",
+		"fish":                           "fish",
+		"powershell (Windows)":           "powershell",
+		"/usr/bin/pwsh":                  "powershell",
+		"C:\\Windows\\system32\\cmd.exe": "cmd",
+		"/bin/sh":                        "sh",
+		"/usr/local/bin/nu":              "nu",
+	}
+	for shell, want := range tests {
+		if got := ShellKind(shell); got != want {
+			t.Errorf("ShellKind(%q) = %q, want %q", shell, got, want)
+		}
+	}
+}
+
+func TestBuildSystemPromptNushell(t *testing.T) {
+	ctx := EnvContext{OS: "linux", Shell: "/bin/bash", CWD: "/src"}
+	if strings.Contains(BuildSystemPrompt(ctx), "NUSHELL RULES") {
+		t.Errorf("Expected no Nushell section for bash")
+	}
+
+	ctx.Shell = "nu"
+	if !strings.Contains(BuildSystemPrompt(ctx), "NUSHELL RULES") {
+		t.Errorf("Expected Nushell section when Nushell is the active shell")
+	}
+}
@@ -0,0 +1,30 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormatOutputTail(t *testing.T) {
+	if got := FormatOutputTail("\n"); got != "(empty)" {
+		t.Errorf("expected empty output to be reported, got %q", got)
+	}
+
+	var sb strings.Builder
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	sb.WriteString("error: login failed, password=hunter2\n")
+
+	tail := FormatOutputTail(sb.String())
+	if !strings.HasPrefix(tail, "… (earlier output omitted)") {
+		t.Errorf("expected truncation note, got:\n%s", tail)
+	}
+	if strings.Contains(tail, "line 1\n") || !strings.Contains(tail, "line 100") {
+		t.Errorf("expected only the last lines to be kept, got:\n%s", tail)
+	}
+	if strings.Contains(tail, "hunter2") {
+		t.Errorf("expected secrets to be redacted, got:\n%s", tail)
+	}
+}
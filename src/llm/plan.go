@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// planMaxSteps caps how many steps of a plan are kept
+const planMaxSteps = 10
+
+// PlanStep is a single command of a multi-step plan
+type PlanStep struct {
+	Command     string `json:"command"`
+	Explanation string `json:"explanation"`
+	Expected    string `json:"expected"`
+}
+
+// Plan is the ordered list of steps returned in --plan mode
+type Plan struct {
+	Summary string     `json:"summary"`
+	Steps   []PlanStep `json:"steps"`
+}
+
+// GeneratePlan asks the model to break prompt down into steps and parses the answer
+func GeneratePlan(prompt string, ctx EnvContext) (*Plan, error) {
+	raw, err := Complete(BuildPlanSystemPrompt(ctx), prompt)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlan(raw)
+}
+
+// ParsePlan parses the raw model response into a Plan. Steps without a command are
+// dropped, and a plan without any step is rejected.
+func ParsePlan(raw string) (*Plan, error) {
+	re := regexp.MustCompile(`(?s)\{.*\}`)
+	jsonBytes := re.Find([]byte(raw))
+
+	if len(jsonBytes) == 0 {
+		return nil, fmt.Errorf("%w: could not locate valid JSON object in response: (raw response: %s)", ErrInvalidResponse, raw)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(jsonBytes, &plan); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal JSON: %v (raw response: %s)", ErrInvalidResponse, err, raw)
+	}
+
+	steps := plan.Steps[:0]
+	for _, step := range plan.Steps {
+		step.Command = strings.TrimSpace(step.Command)
+		if step.Command != "" {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) > planMaxSteps {
+		steps = steps[:planMaxSteps]
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%w: the plan contains no steps (raw response: %s)", ErrInvalidResponse, raw)
+	}
+	plan.Steps = steps
+	return &plan, nil
+}
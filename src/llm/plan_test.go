@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsePlan(t *testing.T) {
+	raw := `<think>venv first</think>
+{"summary": "Set up the project", "steps": [
+  {"command": "python3 -m venv .venv", "explanation": "Create a virtualenv", "expected": "A .venv directory"},
+  {"command": "  ", "explanation": "Empty step"},
+  {"command": ".venv/bin/pip install -r requirements.txt", "explanation": "Install dependencies", "expected": "Successfully installed"}
+]}`
+
+	plan, err := ParsePlan(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.Summary != "Set up the project" {
+		t.Errorf("unexpected summary %q", plan.Summary)
+	}
+	if len(plan.Steps) != 2 {
+		t.Fatalf("expected empty steps to be dropped, got %d steps", len(plan.Steps))
+	}
+	if plan.Steps[1].Command != ".venv/bin/pip install -r requirements.txt" || plan.Steps[1].Expected != "Successfully installed" {
+		t.Errorf("unexpected second step %+v", plan.Steps[1])
+	}
+}
+
+func TestParsePlanInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"no json here",
+		`{"summary": "nothing to do", "steps": []}`,
+		`{"summary": "broken", "steps": [`,
+	} {
+		if _, err := ParsePlan(raw); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("expected ErrInvalidResponse for %q, got %v", raw, err)
+		}
+	}
+}
+
+func TestBuildPlanSystemPrompt(t *testing.T) {
+	prompt := BuildPlanSystemPrompt(EnvContext{OS: "linux", Shell: "/bin/bash", CWD: "/src"})
+	for _, want := range []string{`"steps"`, `"expected"`, "NEW shell process", "/src"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected plan prompt to contain %q", want)
+		}
+	}
+	if strings.Contains(BuildSystemPrompt(EnvContext{}), `"steps"`) {
+		t.Errorf("expected the single-command prompt not to ask for steps")
+	}
+}
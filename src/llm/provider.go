@@ -18,7 +18,7 @@ import (
 type Provider interface {
 	Name() string
 	GetAvailableModels() ([]string, error)
-	StreamCompletion(model, prompt string, ctx EnvContext, contentChan chan<- string, errChan chan<- error)
+	StreamCompletion(model, sysPrompt, prompt string, contentChan chan<- string, errChan chan<- error)
 }
 
 // ModelRegistry holds the active providers and cached models
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"baomihua/guard"
+)
+
+func TestParseReview(t *testing.T) {
+	raw := `<think>the file is a database</think>
+{"risk": "High", "reversible": false, "rationale": " Empties the SQLite database. "}`
+
+	review, err := ParseReview(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if review.Risk != "high" || review.Reversible || review.Rationale != "Empties the SQLite database." {
+		t.Errorf("unexpected review %+v", review)
+	}
+	if lvl := review.Guard().Level; lvl != guard.Danger {
+		t.Errorf("expected high risk to be Danger, got %v", lvl)
+	}
+
+	critical := RiskReview{Risk: "critical"}
+	if lvl := critical.Guard().Level; lvl != guard.Danger {
+		t.Errorf("expected a review never to block, got %v", lvl)
+	}
+}
+
+func TestParseReviewInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"looks fine to me",
+		`{"risk": "spicy", "reversible": true, "rationale": "?"}`,
+		`{"risk": "low",`,
+	} {
+		if _, err := ParseReview(raw); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("expected ErrInvalidResponse for %q, got %v", raw, err)
+		}
+	}
+}
+
+func TestBuildReviewSystemPrompt(t *testing.T) {
+	prompt := buildReviewSystemPrompt(EnvContext{OS: "linux", Shell: "/bin/bash", CWD: "/srv/db"})
+	for _, want := range []string{`"risk"`, `"reversible"`, "untrusted DATA", "/srv/db"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected review prompt to contain %q", want)
+		}
+	}
+}
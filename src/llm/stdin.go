@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of the piped stdin sample that is sent to the model
+const (
+	StdinMaxBytes    = 16 * 1024 // Max bytes read from stdin
+	stdinMaxLines    = 40
+	stdinMaxLineLen  = 300
+	stdinSampleBytes = 4096
+)
+
+// secretPatterns match credentials that must never leave the machine
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`), "[REDACTED PRIVATE KEY]"},
+	{regexp.MustCompile(`(?i)(\b[A-Za-z0-9_.-]*?(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|credentials?)["']?\s*[:=]\s*)["']?[^\s"',;]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9\-._~+/]+=*`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`://[^/\s:@]+:[^/\s@]+@`), "://[REDACTED]@"},                                // Credentials in URLs
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), "[REDACTED]"},                                      // AWS access key IDs
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]+`), "[REDACTED]"}, // JWTs
+	{regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}`), "[REDACTED]"},                         // OpenAI-style API keys
+	{regexp.MustCompile(`\b(?:ghp|gho|ghs|ghu|github_pat)_[A-Za-z0-9_]{20,}`), "[REDACTED]"},        // GitHub tokens
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), "[REDACTED]"},                            // Slack tokens
+}
+
+// RedactSecrets masks passwords, tokens, keys and other credentials in s
+func RedactSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// FormatStdinSample turns raw piped input into a bounded, redacted sample:
+// at most stdinMaxLines lines of stdinMaxLineLen characters and stdinSampleBytes
+// bytes overall. Binary input is reported instead of included.
+func FormatStdinSample(raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	if !utf8.Valid(raw) || strings.ContainsRune(string(raw), 0) {
+		return fmt.Sprintf("(binary data, %d bytes read, content omitted)", len(raw))
+	}
+
+	lines := strings.Split(strings.TrimRight(string(raw), "\n"), "\n")
+	total := len(lines)
+	if len(lines) > stdinMaxLines {
+		lines = lines[:stdinMaxLines]
+	}
+
+	var sb strings.Builder
+	kept := 0
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if utf8.RuneCountInString(line) > stdinMaxLineLen {
+			line = string([]rune(line)[:stdinMaxLineLen]) + " …"
+		}
+		if sb.Len()+len(line) > stdinSampleBytes {
+			break
+		}
+		sb.WriteString(line + "\n")
+		kept++
+	}
+
+	sample := RedactSecrets(sb.String())
+	if kept < total || len(raw) >= StdinMaxBytes {
+		sample += fmt.Sprintf("… (sample truncated, showing the first %d lines)\n", kept)
+	}
+	return strings.TrimRight(sample, "\n")
+}
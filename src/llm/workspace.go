@@ -0,0 +1,394 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// Workspace collection limits. The snapshot is gathered on every invocation,
+// so it has to stay cheap even when bmh is started from $HOME or a huge monorepo.
+const (
+	workspaceTimeout    = 150 * time.Millisecond
+	workspaceGrace      = 50 * time.Millisecond // for a collection that's past the deadline to wrap up
+	workspaceMaxDepth   = 2
+	workspaceMaxEntries = 60
+	workspaceMaxBytes   = 2048
+	workspaceMaxItems   = 15        // max scripts / targets / services listed per project file
+	workspaceFileLimit  = 64 * 1024 // max bytes read from a single project file
+)
+
+// skippedDirs are never worth listing, whether or not they are gitignored
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+	".venv":        true,
+	"__pycache__":  true,
+	".idea":        true,
+	".vscode":      true,
+}
+
+var makeTargetRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_./-]*)\s*:([^=]|$)`)
+
+// CollectWorkspace summarizes the project layout of dir: well-known project files
+// (go.mod, package.json, Makefile, Cargo.toml, pyproject.toml, docker-compose.yml)
+// and a shallow, gitignore-aware directory listing. The result is bounded in both
+// size and collection time, and is empty if nothing useful was found.
+func CollectWorkspace(dir string) string {
+	deadline := time.Now().Add(workspaceTimeout)
+
+	// The collection checks the deadline between reads, but a single read on a
+	// slow network mount can hang for good. It's left behind if it doesn't
+	// finish in time, and the prompt goes without a snapshot.
+	done := make(chan string, 1)
+	go func() {
+		done <- collectWorkspace(dir, deadline)
+	}()
+	select {
+	case out := <-done:
+		return out
+	case <-time.After(time.Until(deadline) + workspaceGrace):
+		return ""
+	}
+}
+
+func collectWorkspace(dir string, deadline time.Time) string {
+	var sb strings.Builder
+	if projects := detectProjects(dir, deadline); len(projects) > 0 {
+		sb.WriteString("Project files:\n")
+		for _, p := range projects {
+			sb.WriteString("- " + p + "\n")
+		}
+	}
+
+	if listing := listWorkspace(dir, deadline); listing != "" {
+		sb.WriteString(fmt.Sprintf("Directory listing (depth %d, gitignored entries omitted):\n", workspaceMaxDepth))
+		sb.WriteString(listing)
+	}
+
+	out := sb.String()
+	if len(out) > workspaceMaxBytes {
+		out = out[:workspaceMaxBytes]
+		if i := strings.LastIndex(out, "\n"); i > 0 {
+			out = out[:i+1]
+		}
+		out += "... (truncated)\n"
+	}
+	return strings.TrimRight(out, "\n")
+}
+
+// detectProjects inspects the well-known project files found directly in dir
+func detectProjects(dir string, deadline time.Time) []string {
+	detectors := []struct {
+		names  []string
+		detect func(data []byte) string
+	}{
+		{[]string{"go.mod"}, detectGoMod},
+		{[]string{"package.json"}, func(data []byte) string { return detectPackageJSON(dir, data) }},
+		{[]string{"Makefile", "makefile", "GNUmakefile"}, detectMakefile},
+		{[]string{"Cargo.toml"}, detectCargo},
+		{[]string{"pyproject.toml"}, detectPyproject},
+		{[]string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"}, detectCompose},
+	}
+
+	var results []string
+	for _, d := range detectors {
+		if time.Now().After(deadline) {
+			break
+		}
+		for _, name := range d.names {
+			data, err := readLimited(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			if summary := d.detect(data); summary != "" {
+				results = append(results, name+": "+summary)
+			}
+			break
+		}
+	}
+	return results
+}
+
+func readLimited(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, workspaceFileLimit))
+}
+
+func detectGoMod(data []byte) string {
+	var module, goVersion string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			module = fields[1]
+		case "go":
+			goVersion = fields[1]
+		}
+	}
+	if module == "" {
+		return "Go module"
+	}
+	if goVersion != "" {
+		return fmt.Sprintf("Go module %s (go %s)", module, goVersion)
+	}
+	return "Go module " + module
+}
+
+func detectPackageJSON(dir string, data []byte) string {
+	var pkg struct {
+		Name    string            `json:"name"`
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return "Node package (unparseable)"
+	}
+
+	// The lockfile tells us which package manager the project actually uses
+	manager := "npm"
+	for _, lock := range []struct{ file, manager string }{
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+		{"bun.lockb", "bun"},
+		{"bun.lock", "bun"},
+	} {
+		if _, err := os.Stat(filepath.Join(dir, lock.file)); err == nil {
+			manager = lock.manager
+			break
+		}
+	}
+
+	summary := fmt.Sprintf("Node package %s (%s)", pkg.Name, manager)
+	if pkg.Name == "" {
+		summary = fmt.Sprintf("Node package (%s)", manager)
+	}
+	if len(pkg.Scripts) > 0 {
+		summary += ", scripts: " + joinLimited(sortedKeys(pkg.Scripts))
+	}
+	return summary
+}
+
+func detectMakefile(data []byte) string {
+	seen := make(map[string]bool)
+	var targets []string
+	for _, line := range strings.Split(string(data), "\n") {
+		m := makeTargetRe.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(m[1], ".") || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		targets = append(targets, m[1])
+	}
+	if len(targets) == 0 {
+		return "Makefile"
+	}
+	return "targets: " + joinLimited(targets)
+}
+
+func detectCargo(data []byte) string {
+	var cargo struct {
+		Package struct {
+			Name string `toml:"name"`
+		} `toml:"package"`
+		Workspace struct {
+			Members []string `toml:"members"`
+		} `toml:"workspace"`
+	}
+	if err := toml.Unmarshal(data, &cargo); err != nil {
+		return "Rust crate (unparseable)"
+	}
+	summary := "Rust crate"
+	if cargo.Package.Name != "" {
+		summary += " " + cargo.Package.Name
+	}
+	if len(cargo.Workspace.Members) > 0 {
+		summary += ", workspace members: " + joinLimited(cargo.Workspace.Members)
+	}
+	return summary
+}
+
+func detectPyproject(data []byte) string {
+	var py struct {
+		Project struct {
+			Name    string            `toml:"name"`
+			Scripts map[string]string `toml:"scripts"`
+		} `toml:"project"`
+		Tool map[string]any `toml:"tool"`
+	}
+	if err := toml.Unmarshal(data, &py); err != nil {
+		return "Python project (unparseable)"
+	}
+	summary := "Python project"
+	if py.Project.Name != "" {
+		summary += " " + py.Project.Name
+	}
+	if len(py.Tool) > 0 {
+		summary += ", tools: " + joinLimited(sortedKeys(py.Tool))
+	}
+	if len(py.Project.Scripts) > 0 {
+		summary += ", scripts: " + joinLimited(sortedKeys(py.Project.Scripts))
+	}
+	return summary
+}
+
+func detectCompose(data []byte) string {
+	var compose struct {
+		Services map[string]any `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return "Docker Compose (unparseable)"
+	}
+	if len(compose.Services) == 0 {
+		return "Docker Compose"
+	}
+	return "Docker Compose services: " + joinLimited(sortedKeys(compose.Services))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinLimited(items []string) string {
+	if len(items) > workspaceMaxItems {
+		return strings.Join(items[:workspaceMaxItems], ", ") + fmt.Sprintf(" (+%d more)", len(items)-workspaceMaxItems)
+	}
+	return strings.Join(items, ", ")
+}
+
+// listWorkspace renders a breadth-limited tree of dir, skipping gitignored entries
+func listWorkspace(dir string, deadline time.Time) string {
+	ignore := loadGitignore(dir)
+
+	var sb strings.Builder
+	count, omitted := 0, 0
+
+	var walk func(rel string, depth int)
+	walk = func(rel string, depth int) {
+		entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			entryRel := path.Join(rel, e.Name())
+			if skippedDirs[e.Name()] || ignore.matches(entryRel, e.IsDir()) {
+				continue
+			}
+			if count >= workspaceMaxEntries || time.Now().After(deadline) {
+				omitted++
+				continue
+			}
+			count++
+
+			name := e.Name()
+			if e.IsDir() {
+				name += "/"
+			}
+			sb.WriteString(strings.Repeat("  ", depth) + name + "\n")
+
+			if e.IsDir() && depth+1 < workspaceMaxDepth {
+				walk(entryRel, depth+1)
+			}
+		}
+	}
+	walk("", 0)
+
+	if omitted > 0 {
+		sb.WriteString(fmt.Sprintf("... (%d more entries omitted)\n", omitted))
+	}
+	return sb.String()
+}
+
+// gitignoreRule is a single, simplified .gitignore pattern
+type gitignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+type gitignore []gitignoreRule
+
+// loadGitignore parses the .gitignore at the root of dir. Nested .gitignore files
+// are deliberately not read to keep collection bounded.
+func loadGitignore(dir string) gitignore {
+	data, err := readLimited(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+
+	var rules gitignore
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r gitignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.HasPrefix(line, "/") {
+			r.anchored = true
+			line = strings.TrimLeft(line, "/")
+		} else if strings.Contains(line, "/") {
+			// A slash in the middle also anchors the pattern to the root
+			r.anchored = !strings.HasPrefix(line, "**/")
+			line = strings.TrimPrefix(line, "**/")
+		}
+		if line == "" {
+			continue
+		}
+		r.pattern = line
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// matches reports whether the slash-separated relative path is ignored.
+// As in git, the last matching rule wins.
+func (g gitignore) matches(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range g {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		var ok bool
+		if r.anchored {
+			ok, _ = path.Match(r.pattern, rel)
+		} else {
+			ok, _ = path.Match(r.pattern, path.Base(rel))
+		}
+		if ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
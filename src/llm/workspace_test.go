@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/demo\n\ngo 1.22\n")
+	writeFile(t, filepath.Join(dir, "package.json"), `{"name": "web", "scripts": {"build": "vite build", "test": "vitest"}}`)
+	writeFile(t, filepath.Join(dir, "pnpm-lock.yaml"), "")
+	writeFile(t, filepath.Join(dir, "Makefile"), "VERSION := 1.0\n.PHONY: test\nbuild: deps\n\tgo build\ntest:\n\tgo test ./...\n")
+	writeFile(t, filepath.Join(dir, "Cargo.toml"), "[package]\nname = \"cli\"\n")
+	writeFile(t, filepath.Join(dir, "pyproject.toml"), "[project]\nname = \"tool\"\n\n[tool.pytest.ini_options]\n")
+	writeFile(t, filepath.Join(dir, "docker-compose.yml"), "services:\n  db:\n    image: postgres\n  api:\n    build: .\n")
+	writeFile(t, filepath.Join(dir, ".gitignore"), "dist/\n*.log\n")
+	writeFile(t, filepath.Join(dir, "dist", "bundle.js"), "")
+	writeFile(t, filepath.Join(dir, "debug.log"), "")
+	writeFile(t, filepath.Join(dir, "src", "main.go"), "")
+	writeFile(t, filepath.Join(dir, "node_modules", "x", "index.js"), "")
+
+	ws := CollectWorkspace(dir)
+
+	for _, want := range []string{
+		"Go module example.com/demo (go 1.22)",
+		"Node package web (pnpm), scripts: build, test",
+		"targets: build, test",
+		"Rust crate cli",
+		"Python project tool, tools: pytest",
+		"Docker Compose services: api, db",
+		"src/",
+		"  main.go",
+	} {
+		if !strings.Contains(ws, want) {
+			t.Errorf("expected workspace snapshot to contain %q, got:\n%s", want, ws)
+		}
+	}
+
+	for _, unwanted := range []string{"dist", "debug.log", "node_modules", "VERSION"} {
+		if strings.Contains(ws, unwanted) {
+			t.Errorf("expected workspace snapshot to omit %q, got:\n%s", unwanted, ws)
+		}
+	}
+}
+
+func TestCollectWorkspaceBounded(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 500; i++ {
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("file-with-a-fairly-long-name-%03d.txt", i)), "")
+	}
+
+	ws := CollectWorkspace(dir)
+	if len(ws) > workspaceMaxBytes+len("... (truncated)") {
+		t.Errorf("expected snapshot to be bounded to %d bytes, got %d", workspaceMaxBytes, len(ws))
+	}
+	if !strings.Contains(ws, "more entries omitted") && !strings.Contains(ws, "(truncated)") {
+		t.Errorf("expected snapshot to report omitted entries, got:\n%s", ws)
+	}
+}
+
+func TestCollectWorkspaceEmpty(t *testing.T) {
+	if ws := CollectWorkspace(t.TempDir()); ws != "" {
+		t.Errorf("expected empty snapshot for empty directory, got %q", ws)
+	}
+}
+
+func TestCollectWorkspaceHangingRead(t *testing.T) {
+	// Opening a FIFO without a writer blocks like a read on a stale network mount
+	dir := t.TempDir()
+	if err := exec.Command("mkfifo", filepath.Join(dir, "go.mod")).Run(); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+
+	start := time.Now()
+	CollectWorkspace(dir)
+	if elapsed := time.Since(start); elapsed > workspaceTimeout+workspaceGrace+time.Second {
+		t.Errorf("expected collection to give up after the deadline, took %v", elapsed)
+	}
+}
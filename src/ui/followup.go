@@ -0,0 +1,216 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"baomihua/executor"
+	"baomihua/llm"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// FollowUpAction is what the user picked in the panel shown after a failed command
+type FollowUpAction int
+
+const (
+	FollowUpDone FollowUpAction = iota
+	FollowUpFix
+	followUpExplain
+)
+
+type followUpItem struct {
+	label  string
+	action FollowUpAction
+}
+
+type followUpModel struct {
+	request     string
+	run         *executor.Execution
+	ctx         llm.EnvContext
+	isZH        bool
+	spinner     spinner.Model
+	menuItems   []followUpItem
+	cursor      int
+	explaining  bool
+	explanation string
+	err         error
+	choice      FollowUpAction
+	isDone      bool
+}
+
+type explanationMsg struct {
+	text string
+	err  error
+}
+
+func initialFollowUpModel(request string, run *executor.Execution, ctx llm.EnvContext) followUpModel {
+	s := spinner.New()
+	s.Spinner = spinner.Line
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	m := followUpModel{
+		request: request,
+		run:     run,
+		ctx:     ctx,
+		isZH:    IsChinese(request),
+		spinner: s,
+	}
+	if m.isZH {
+		m.menuItems = []followUpItem{
+			{label: "🔧 修复 (Fix it)", action: FollowUpFix},
+			{label: "📖 解释输出 (Explain output)", action: followUpExplain},
+			{label: "👋 完成 (Done)", action: FollowUpDone},
+		}
+	} else {
+		m.menuItems = []followUpItem{
+			{label: "🔧 Fix it", action: FollowUpFix},
+			{label: "📖 Explain output", action: followUpExplain},
+			{label: "👋 Done", action: FollowUpDone},
+		}
+	}
+	return m
+}
+
+func (m followUpModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m followUpModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.explaining {
+			if msg.String() == "ctrl+c" {
+				m.isDone = true
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.choice = FollowUpDone
+			m.isDone = true
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j", "tab":
+			if m.cursor < len(m.menuItems)-1 {
+				m.cursor++
+			}
+		case "enter", " ":
+			return m.handleChoice()
+		case "1", "2", "3":
+			idx := int(msg.String()[0] - '1')
+			if idx < len(m.menuItems) {
+				m.cursor = idx
+				return m.handleChoice()
+			}
+		}
+
+	case explanationMsg:
+		m.explaining = false
+		m.explanation = msg.text
+		m.err = msg.err
+		// Explaining twice won't tell anything new
+		for i, item := range m.menuItems {
+			if item.action == followUpExplain {
+				m.menuItems = append(m.menuItems[:i], m.menuItems[i+1:]...)
+				break
+			}
+		}
+		m.cursor = 0
+
+	case spinner.TickMsg:
+		if m.explaining {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+	}
+
+	return m, nil
+}
+
+func (m followUpModel) handleChoice() (tea.Model, tea.Cmd) {
+	selected := m.menuItems[m.cursor]
+	if selected.action != followUpExplain {
+		m.choice = selected.action
+		m.isDone = true
+		return m, tea.Quit
+	}
+
+	m.explaining = true
+	run := m.run
+	return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+		text, err := llm.ExplainOutput(m.request, run.Command, run.ExitCode, run.Stdout, run.Stderr, m.ctx)
+		return explanationMsg{text: text, err: err}
+	})
+}
+
+func (m followUpModel) View() string {
+	var sb strings.Builder
+
+	sb.WriteString("\n")
+	if m.isZH {
+		sb.WriteString(DangerStyle.Render(fmt.Sprintf("❌ 命令执行失败，退出码 %d (耗时 %s)", m.run.ExitCode, m.run.Duration.Round(time.Millisecond))) + "\n")
+	} else {
+		sb.WriteString(DangerStyle.Render(fmt.Sprintf("❌ Command failed with exit code %d after %s", m.run.ExitCode, m.run.Duration.Round(time.Millisecond))) + "\n")
+	}
+
+	if m.explanation != "" {
+		if m.isZH {
+			sb.WriteString("\n" + TitleStyle.Render("📖 解释 (Explanation): ") + ExplanationStyle.Render(m.explanation) + "\n")
+		} else {
+			sb.WriteString("\n" + TitleStyle.Render("📖 Explanation: ") + ExplanationStyle.Render(m.explanation) + "\n")
+		}
+	}
+	if m.err != nil {
+		sb.WriteString("\n" + DangerStyle.Render(fmt.Sprintf("❌ %v", m.err)) + "\n")
+	}
+
+	if m.isDone {
+		return sb.String()
+	}
+
+	sb.WriteString("\n")
+	if m.explaining {
+		if m.isZH {
+			sb.WriteString(fmt.Sprintf(" %s 豹米花正在分析输出...\n", m.spinner.View()))
+		} else {
+			sb.WriteString(fmt.Sprintf(" %s BaoMiHua is reading the output...\n", m.spinner.View()))
+		}
+		return sb.String()
+	}
+
+	if m.isZH {
+		sb.WriteString("请选择下一步动作:\n")
+	} else {
+		sb.WriteString("Select next action:\n")
+	}
+	for i, item := range m.menuItems {
+		cursor := "  "
+		style := ItemStyle
+		if m.cursor == i {
+			cursor = "> "
+			style = SelectedItemStyle
+		}
+		sb.WriteString(style.Render(fmt.Sprintf("%s%d. %s", cursor, i+1, item.label)) + "\n")
+	}
+	return sb.String()
+}
+
+// RunFollowUpUI shows the panel offered after a command failed: ask the model for a
+// fix, have it explain the captured output, or leave
+func RunFollowUpUI(request string, run *executor.Execution, ctx llm.EnvContext) (FollowUpAction, error) {
+	p := tea.NewProgram(initialFollowUpModel(request, run, ctx), programOptions()...)
+	m, err := p.Run()
+	if err != nil {
+		return FollowUpDone, err
+	}
+	return m.(followUpModel).choice, nil
+}
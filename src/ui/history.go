@@ -0,0 +1,431 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"baomihua/executor"
+	"baomihua/guard"
+	"baomihua/history"
+	"baomihua/llm"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// historyPageSize is how many matches are listed at once
+const historyPageSize = 10
+
+type historyModel struct {
+	entries []history.Entry
+	matches []history.Entry
+	isZH    bool
+	ctx     llm.EnvContext
+	input   textinput.Model
+	cursor  int
+	offset  int // Index of the first listed match
+
+	// Set once an entry was picked, the guard checks it again for the replay
+	selected   *history.Entry
+	dir        string // Where the picked entry runs
+	verdict    guard.Verdict
+	reviewing  bool   // The review model is rating the picked entry
+	note       string // e.g. why the review failed
+	menuItems  []menuItem
+	menuCursor int
+
+	action  Action
+	exitMsg string
+	isDone  bool
+}
+
+// historyReviewedMsg carries the review of a picked entry's command
+type historyReviewedMsg struct {
+	command string
+	dir     string
+	verdict guard.Verdict
+	err     error
+}
+
+func initialHistoryModel(entries []history.Entry, query string, ctx llm.EnvContext) historyModel {
+	ti := textinput.New()
+	ti.CharLimit = 256
+	ti.Width = 60
+	ti.Prompt = "🔎 > "
+	ti.PromptStyle = PromptSelectedStyle
+	ti.Cursor.Style = PromptCursorStyle
+	ti.SetValue(query)
+	ti.Focus()
+
+	m := historyModel{
+		entries: entries,
+		ctx:     ctx,
+		input:   ti,
+		action:  ActionCancel,
+	}
+	// The history has no prompt of its own, go with the language of the latest one
+	if len(entries) > 0 {
+		m.isZH = IsChinese(entries[len(entries)-1].Prompt)
+	}
+	if m.isZH {
+		m.input.Placeholder = "模糊搜索提示词和命令..."
+	} else {
+		m.input.Placeholder = "fuzzy search prompts and commands..."
+	}
+	m.matches = history.Search(entries, query)
+	return m
+}
+
+func (m historyModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m historyModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(historyReviewedMsg); ok {
+		if m.selected == nil || m.selected.Command() != msg.command || m.dir != msg.dir {
+			// Went back to the list in the meantime
+			return m, nil
+		}
+		m.verdict = msg.verdict
+		m.reviewing = false
+		if msg.err != nil {
+			if m.isZH {
+				m.note = fmt.Sprintf("⚠️ 模型复核失败，仅使用内置规则: %v", msg.err)
+			} else {
+				m.note = fmt.Sprintf("⚠️ Model review failed, only the built-in rules apply: %v", msg.err)
+			}
+		}
+		m.buildMenu()
+		return m, nil
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		if m.selected != nil {
+			return m.updateMenu(msg)
+		}
+
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.isDone = true
+			return m, tea.Quit
+		case tea.KeyUp:
+			if m.cursor > 0 {
+				m.cursor--
+			}
+			m.scroll()
+			return m, nil
+		case tea.KeyDown, tea.KeyTab:
+			if m.cursor < len(m.matches)-1 {
+				m.cursor++
+			}
+			m.scroll()
+			return m, nil
+		case tea.KeyEnter:
+			if len(m.matches) > 0 {
+				return m, m.selectEntry(m.matches[m.cursor])
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	query := m.input.Value()
+	m.input, cmd = m.input.Update(msg)
+	if m.input.Value() != query {
+		m.matches = history.Search(m.entries, m.input.Value())
+		m.cursor = 0
+		m.offset = 0
+	}
+	return m, cmd
+}
+
+// scroll keeps the cursor inside the listed page
+func (m *historyModel) scroll() {
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+historyPageSize {
+		m.offset = m.cursor - historyPageSize + 1
+	}
+}
+
+// selectEntry shows the menu for an entry. It runs again in the directory it
+// was generated in, or the current one if that's gone. The guard decides again
+// whether it may run there, the rules may have changed since it was generated.
+// When guard.review is "model" the menu waits for the review the returned
+// command runs.
+func (m *historyModel) selectEntry(e history.Entry) tea.Cmd {
+	m.selected = &e
+	m.dir = e.Dir()
+	if m.dir == "" {
+		m.dir, _ = os.Getwd()
+	}
+	m.verdict = guard.CheckIn(e.Command(), m.dir)
+	m.note = ""
+	m.menuItems = nil
+	if !llm.ReviewEnabled() || m.verdict.Level == guard.Blocked {
+		m.buildMenu()
+		return nil
+	}
+
+	m.reviewing = true
+	request, command, dir, v := e.Prompt, e.Command(), m.dir, m.verdict
+	ctx := m.ctx
+	ctx.CWD = dir
+	return func() tea.Msg {
+		review, err := llm.ReviewCommand(request, command, ctx)
+		if err != nil {
+			return historyReviewedMsg{command: command, dir: dir, verdict: v, err: err}
+		}
+		return historyReviewedMsg{command: command, dir: dir, verdict: v.WithReview(command, review.Guard())}
+	}
+}
+
+// buildMenu lists the actions offered for the picked entry given its verdict
+func (m *historyModel) buildMenu() {
+	m.menuCursor = 0
+	m.menuItems = nil
+
+	if m.verdict.Level != guard.Blocked {
+		if m.isZH {
+			m.menuItems = append(m.menuItems, menuItem{label: "🐾 插入终端 (Insert to prompt)", action: ActionInject})
+		} else {
+			m.menuItems = append(m.menuItems, menuItem{label: "🐾 Insert to prompt", action: ActionInject})
+		}
+	}
+	if m.isZH {
+		m.menuItems = append(m.menuItems, menuItem{label: "📋 复制命令 (Copy)", action: ActionCopy})
+	} else {
+		m.menuItems = append(m.menuItems, menuItem{label: "📋 Copy", action: ActionCopy})
+	}
+	if m.verdict.Level < guard.Danger {
+		if m.isZH {
+			m.menuItems = append(m.menuItems, menuItem{label: "🔁 重新执行 (Re-run)", action: ActionExecute})
+		} else {
+			m.menuItems = append(m.menuItems, menuItem{label: "🔁 Re-run", action: ActionExecute})
+		}
+	}
+	if m.isZH {
+		m.menuItems = append(m.menuItems, menuItem{label: "↩️  返回 (Back)", action: ActionCancel})
+	} else {
+		m.menuItems = append(m.menuItems, menuItem{label: "↩️  Back", action: ActionCancel})
+	}
+}
+
+func (m historyModel) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.isDone = true
+		return m, tea.Quit
+	case "esc", "q":
+		m.selected = nil
+		m.reviewing = false
+		return m, nil
+	case "up", "k":
+		if m.menuCursor > 0 {
+			m.menuCursor--
+		}
+	case "down", "j", "tab":
+		if m.menuCursor < len(m.menuItems)-1 {
+			m.menuCursor++
+		}
+	case "enter", " ":
+		if m.reviewing {
+			return m, nil
+		}
+		return m.handleChoice()
+	case "1", "2", "3", "4":
+		if m.reviewing {
+			return m, nil
+		}
+		idx := int(msg.String()[0] - '1')
+		if idx < len(m.menuItems) {
+			m.menuCursor = idx
+			return m.handleChoice()
+		}
+	}
+	return m, nil
+}
+
+func (m historyModel) handleChoice() (tea.Model, tea.Cmd) {
+	command := m.selected.Command()
+
+	switch m.menuItems[m.menuCursor].action {
+	case ActionCancel:
+		m.selected = nil
+		return m, nil
+	case ActionInject:
+		if err := executor.InjectToTerminal(command); err != nil {
+			if m.isZH {
+				m.exitMsg = fmt.Sprintf("\n❌ 插入失败: %v", err)
+			} else {
+				m.exitMsg = fmt.Sprintf("\n❌ Injection failed: %v", err)
+			}
+		} else if m.isZH {
+			m.exitMsg = "\n✅ 已写入终端! (请按回车执行)"
+		} else {
+			m.exitMsg = "\n✅ Injected into terminal! (Press Enter to execute)"
+		}
+	case ActionCopy:
+		if err := executor.CopyToClipboard(command); err != nil {
+			if m.isZH {
+				m.exitMsg = fmt.Sprintf("\n❌ 复制失败: %v", err)
+			} else {
+				m.exitMsg = fmt.Sprintf("\n❌ Copy failed: %v", err)
+			}
+		} else if m.isZH {
+			m.exitMsg = "\n✅ 已复制到剪贴板!"
+		} else {
+			m.exitMsg = "\n✅ Copied to clipboard!"
+		}
+	case ActionExecute:
+		if m.isZH {
+			m.exitMsg = fmt.Sprintf("\n🔁 正在重新执行: %s", command)
+		} else {
+			m.exitMsg = fmt.Sprintf("\n🔁 Re-running: %s", command)
+		}
+	}
+
+	m.action = m.menuItems[m.menuCursor].action
+	m.isDone = true
+	return m, tea.Quit
+}
+
+func (m historyModel) View() string {
+	if m.isDone {
+		return ""
+	}
+	if m.selected != nil {
+		return m.entryView()
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n")
+	if m.isZH {
+		sb.WriteString(TitleStyle.Render(fmt.Sprintf("🕘 历史记录 (%d/%d)", len(m.matches), len(m.entries))) + "\n")
+	} else {
+		sb.WriteString(TitleStyle.Render(fmt.Sprintf("🕘 History (%d/%d)", len(m.matches), len(m.entries))) + "\n")
+	}
+	sb.WriteString(m.input.View() + "\n\n")
+
+	if len(m.matches) == 0 {
+		if m.isZH {
+			sb.WriteString(mutedStyle.Render("  没有匹配的记录") + "\n")
+		} else {
+			sb.WriteString(mutedStyle.Render("  No matching entries") + "\n")
+		}
+	}
+
+	end := min(m.offset+historyPageSize, len(m.matches))
+	for i := m.offset; i < end; i++ {
+		e := m.matches[i]
+		line := fmt.Sprintf("%s  %s", e.Time.Local().Format("2006-01-02 15:04"), e.Command())
+		if i == m.cursor {
+			sb.WriteString(currentStyle.Render("> "+line) + "\n")
+			sb.WriteString("    " + ExplanationStyle.Render(e.Prompt) + "\n")
+		} else {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+
+	sb.WriteString("\n")
+	if m.isZH {
+		sb.WriteString(mutedStyle.Render("[↑/↓] 移动  [enter] 选择  [esc] 退出") + "\n")
+	} else {
+		sb.WriteString(mutedStyle.Render("[↑/↓] move  [enter] select  [esc] quit") + "\n")
+	}
+	return sb.String()
+}
+
+// entryView shows the picked entry and what can be done with it
+func (m historyModel) entryView() string {
+	e := m.selected
+	var sb strings.Builder
+
+	sb.WriteString("\n")
+	if m.isZH {
+		sb.WriteString(TitleStyle.Render("💬 提示词: ") + e.Prompt + "\n")
+		sb.WriteString(TitleStyle.Render("💻 命令: ") + highlightCommand(e.Command(), m.verdict) + "\n")
+		if e.Result.Explanation != "" {
+			sb.WriteString(TitleStyle.Render("🐆 解释: ") + ExplanationStyle.Render(e.Result.Explanation) + "\n")
+		}
+	} else {
+		sb.WriteString(TitleStyle.Render("💬 Prompt: ") + e.Prompt + "\n")
+		sb.WriteString(TitleStyle.Render("💻 Command: ") + highlightCommand(e.Command(), m.verdict) + "\n")
+		if e.Result.Explanation != "" {
+			sb.WriteString(TitleStyle.Render("🐆 Explanation: ") + ExplanationStyle.Render(e.Result.Explanation) + "\n")
+		}
+	}
+
+	outcome := e.Action
+	if e.ExitCode != nil {
+		outcome = fmt.Sprintf("%s, exit %d", e.Action, *e.ExitCode)
+	}
+	sb.WriteString(mutedStyle.Render(fmt.Sprintf("   %s · %s · %s · %s", e.Time.Local().Format("2006-01-02 15:04"), e.Model, e.CWD, outcome)) + "\n")
+
+	// Relative paths in the command mean something else outside its directory
+	switch {
+	case e.CWD != "" && m.dir != e.CWD:
+		if m.isZH {
+			sb.WriteString(ExplanationStyle.Render("   ⚠️ 生成时的目录 "+e.CWD+" 已不存在，将在当前目录 "+m.dir+" 执行") + "\n")
+		} else {
+			sb.WriteString(ExplanationStyle.Render("   ⚠️ "+e.CWD+", where it was generated, is gone; it runs in the current directory "+m.dir) + "\n")
+		}
+	case m.dir != m.ctx.CWD:
+		if m.isZH {
+			sb.WriteString(ExplanationStyle.Render("   📂 将在生成时的目录执行: "+m.dir) + "\n")
+		} else {
+			sb.WriteString(ExplanationStyle.Render("   📂 Runs where it was generated: "+m.dir) + "\n")
+		}
+	}
+
+	if m.reviewing {
+		if m.isZH {
+			sb.WriteString("\n" + mutedStyle.Render("⏳ 模型正在复核该命令...") + "\n")
+		} else {
+			sb.WriteString("\n" + mutedStyle.Render("⏳ The review model is rating the command...") + "\n")
+		}
+		return sb.String()
+	}
+	if note := verdictNote(m.verdict, m.isZH); note != "" {
+		sb.WriteString("\n" + note + "\n")
+	}
+	if m.note != "" {
+		sb.WriteString(ExplanationStyle.Render(m.note) + "\n")
+	}
+
+	if m.isZH {
+		sb.WriteString("\n请选择下一步动作:\n")
+	} else {
+		sb.WriteString("\nSelect next action:\n")
+	}
+	for i, item := range m.menuItems {
+		cursor := "  "
+		style := ItemStyle
+		if m.menuCursor == i {
+			cursor = "> "
+			style = SelectedItemStyle
+		}
+		sb.WriteString(style.Render(fmt.Sprintf("%s%d. %s", cursor, i+1, item.label)) + "\n")
+	}
+	return sb.String()
+}
+
+// RunHistoryUI lets the user fuzzy search the history, starting with query, and
+// insert, copy or re-run an entry. Insert and copy are handled here; for
+// ActionExecute the caller runs the returned entry in its Dir, or the current
+// directory if that's gone.
+func RunHistoryUI(entries []history.Entry, query string, ctx llm.EnvContext) (*history.Entry, Action, string, error) {
+	p := tea.NewProgram(initialHistoryModel(entries, query, ctx), programOptions()...)
+	m, err := p.Run()
+	if err != nil {
+		return nil, ActionCancel, "", err
+	}
+
+	finalModel := m.(historyModel)
+	if finalModel.exitMsg != "" {
+		finalModel.exitMsg += "\n"
+	}
+	return finalModel.selected, finalModel.action, finalModel.exitMsg, nil
+}
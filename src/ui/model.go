@@ -31,24 +31,65 @@ const (
 	ActionExecute
 	ActionCopy
 	ActionCancel
+	ActionPreview
+	ActionSandbox
+	ActionInspect
+	ActionSkip // A step of a plan that was passed over
 )
 
+// String names the action, e.g. in the history file
+func (a Action) String() string {
+	switch a {
+	case ActionInject:
+		return "inject"
+	case ActionExecute:
+		return "execute"
+	case ActionCopy:
+		return "copy"
+	case ActionCancel:
+		return "cancel"
+	case ActionPreview:
+		return "preview"
+	case ActionSandbox:
+		return "sandbox"
+	case ActionInspect:
+		return "inspect"
+	case ActionSkip:
+		return "skip"
+	}
+	return "unknown"
+}
+
 type menuItem struct {
 	label  string
 	action Action
 }
 
+// Options tweaks how the result UI behaves
+type Options struct {
+	// Inline renders a compact, few-line UI for the shell hotkey widget. The only
+	// choices are replacing the prompt line with the command or cancelling.
+	Inline bool
+	// AutoExecute runs the command right away when guard.AutoExecutable allows it
+	// for the AutoExecuteAllow prefixes. Otherwise the menu explains the refusal.
+	AutoExecute      bool
+	AutoExecuteAllow []string
+}
+
 type model struct {
 	prompt    string
+	opts      Options
 	isZH      bool
 	ctx       llm.EnvContext
 	state     state
 	err       error
 	spinner   spinner.Model
 	parsed    *llm.Result
-	safetyLvl guard.Level
+	verdict   guard.Verdict
 	menuItems []menuItem
 	cursor    int
+	note      string // Shown above the menu, e.g. why auto-execute was refused
+	preview   *executor.Preview
 	exitMsg   string
 	isDone    bool
 }
@@ -64,15 +105,16 @@ func IsChinese(s string) bool {
 	return false
 }
 
-func InitialModel(prompt string) model {
+func InitialModel(prompt string, ctx llm.EnvContext, opts Options) model {
 	s := spinner.New()
 	s.Spinner = spinner.Line
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
 
 	return model{
 		prompt:  prompt,
+		opts:    opts,
 		isZH:    IsChinese(prompt),
-		ctx:     llm.GetEnvContext(),
+		ctx:     ctx,
 		state:   stateLoading,
 		spinner: s,
 	}
@@ -87,74 +129,115 @@ func (m model) Init() tea.Cmd {
 
 func (m model) startStreamingCmd() tea.Cmd {
 	return func() tea.Msg {
-		contentChan := make(chan string)
-		errChan := make(chan error)
-
-		go llm.StreamCompletion(m.prompt, m.ctx, contentChan, errChan)
-
-		var sb strings.Builder
-		for {
-			select {
-			case content, ok := <-contentChan:
-				if !ok {
-					contentChan = nil
-				} else {
-					sb.WriteString(content)
-				}
-			case err, ok := <-errChan:
-				if !ok {
-					errChan = nil
-				} else if err != nil {
-					return errMsg{err: err}
-				}
-			}
-
-			if contentChan == nil && errChan == nil {
-				break
-			}
+		res, err := llm.Generate(m.prompt, m.ctx)
+		if err != nil {
+			return errMsg{err: err}
 		}
 
-		res, err := llm.ParseResult(sb.String())
+		verdict, err := llm.CheckWithReview(m.prompt, res.Command, m.ctx)
+		note := ""
 		if err != nil {
-			return errMsg{err: err}
+			if m.isZH {
+				note = fmt.Sprintf("⚠️ 模型复核失败，仅使用内置规则: %v", err)
+			} else {
+				note = fmt.Sprintf("⚠️ Model review failed, only the built-in rules apply: %v", err)
+			}
 		}
 
-		lvl := guard.CheckCommand(res.Command)
+		items := m.buildMenu(res.Command, verdict)
 
-		var items []menuItem
+		return struct {
+			res     *llm.Result
+			verdict guard.Verdict
+			items   []menuItem
+			note    string
+		}{
+			res:     res,
+			verdict: verdict,
+			items:   items,
+			note:    note,
+		}
+	}
+}
 
-		if lvl != guard.Danger {
+// buildMenu lists the actions offered for a generated command given its verdict.
+// Safe commands are executed by default, Caution ones only when picked
+// explicitly, Danger ones can't be executed and Blocked ones can only be copied.
+// When the guard knows a safer way to do the same, it comes first.
+func (m model) buildMenu(command string, v guard.Verdict) []menuItem {
+	var items []menuItem
+	lvl := v.Level
+
+	if m.opts.Inline {
+		// A replaced line is a single Enter away from running
+		if lvl != guard.Blocked {
 			if m.isZH {
-				items = append(items, menuItem{label: "⚡️ 直接执行 (Execute)", action: ActionExecute})
+				items = append(items, menuItem{label: "🐾 替换当前行", action: ActionInject})
 			} else {
-				items = append(items, menuItem{label: "⚡️ Execute", action: ActionExecute})
+				items = append(items, menuItem{label: "🐾 Replace line", action: ActionInject})
 			}
 		}
+		if m.isZH {
+			return append(items, menuItem{label: "🛑 放弃", action: ActionCancel})
+		}
+		return append(items, menuItem{label: "🛑 Cancel", action: ActionCancel})
+	}
 
+	execute := menuItem{label: "⚡️ Execute", action: ActionExecute}
+	if m.isZH {
+		execute.label = "⚡️ 直接执行 (Execute)"
+	}
+
+	if v.Alternative != "" {
 		if m.isZH {
-			items = append(items,
-				menuItem{label: "🐾 插入终端 (Insert to prompt)", action: ActionInject},
-				menuItem{label: "📋 复制命令 (Copy)", action: ActionCopy},
-				menuItem{label: "🛑 放弃 (Cancel)", action: ActionCancel},
-			)
+			items = append(items, menuItem{label: "🔎 先下载查看再运行 (Download, inspect, then run)", action: ActionInspect})
 		} else {
-			items = append(items,
-				menuItem{label: "🐾 Insert to prompt", action: ActionInject},
-				menuItem{label: "📋 Copy", action: ActionCopy},
-				menuItem{label: "🛑 Cancel", action: ActionCancel},
-			)
+			items = append(items, menuItem{label: "🔎 Download, inspect, then run", action: ActionInspect})
 		}
+	}
 
-		return struct {
-			res   *llm.Result
-			lvl   guard.Level
-			items []menuItem
-		}{
-			res:   res,
-			lvl:   lvl,
-			items: items,
+	if lvl == guard.Safe {
+		items = append(items, execute)
+	}
+	if lvl != guard.Blocked {
+		if m.isZH {
+			items = append(items, menuItem{label: "🐾 插入终端 (Insert to prompt)", action: ActionInject})
+		} else {
+			items = append(items, menuItem{label: "🐾 Insert to prompt", action: ActionInject})
+		}
+	}
+	if lvl == guard.Caution {
+		items = append(items, execute)
+	}
+	if m.isZH {
+		items = append(items, menuItem{label: "📋 复制命令 (Copy)", action: ActionCopy})
+	} else {
+		items = append(items, menuItem{label: "📋 Copy", action: ActionCopy})
+	}
+
+	if lvl != guard.Blocked && executor.SandboxAvailable() {
+		if m.isZH {
+			items = append(items, menuItem{label: "🧪 沙箱中试运行 (Execute in sandbox)", action: ActionSandbox})
+		} else {
+			items = append(items, menuItem{label: "🧪 Execute in sandbox", action: ActionSandbox})
 		}
 	}
+
+	if executor.Previewable(command) {
+		if m.isZH {
+			items = append(items, menuItem{label: "🔍 预览影响范围 (Preview)", action: ActionPreview})
+		} else {
+			items = append(items, menuItem{label: "🔍 Preview", action: ActionPreview})
+		}
+	}
+
+	if m.isZH {
+		items = append(items, menuItem{label: "🛑 放弃 (Cancel)", action: ActionCancel})
+	} else {
+		items = append(items, menuItem{label: "🛑 Cancel", action: ActionCancel})
+	}
+
+	return items
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -171,11 +254,11 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				m.isDone = true
 				return m, tea.Quit
-			case "up", "k":
+			case "up", "k", "left", "h":
 				if m.cursor > 0 {
 					m.cursor--
 				}
-			case "down", "j":
+			case "down", "j", "right", "l", "tab":
 				if m.cursor < len(m.menuItems)-1 {
 					m.cursor++
 				}
@@ -209,15 +292,41 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Quit
 
 	case struct {
-		res   *llm.Result
-		lvl   guard.Level
-		items []menuItem
+		res     *llm.Result
+		verdict guard.Verdict
+		items   []menuItem
+		note    string
 	}:
 		m.parsed = msg.res
-		m.safetyLvl = msg.lvl
+		m.verdict = msg.verdict
 		m.menuItems = msg.items
+		m.note = msg.note
 		m.state = stateResult
 
+		if m.opts.AutoExecute && !m.opts.Inline {
+			ok, reason := guard.AutoExecutable(m.parsed.Command, m.opts.AutoExecuteAllow)
+			if ok && m.verdict.Level != guard.Safe {
+				// The model review objects
+				ok, reason = false, m.verdict.Reason
+			}
+			if ok {
+				for i, item := range m.menuItems {
+					if item.action == ActionExecute {
+						m.cursor = i
+						return m.handleChoice()
+					}
+				}
+			}
+			if m.note != "" {
+				m.note += "\n"
+			}
+			if m.isZH {
+				m.note += "ℹ️ 未自动执行: " + reason
+			} else {
+				m.note += "ℹ️ Not auto-executed: " + reason
+			}
+		}
+
 	case spinner.TickMsg:
 		if m.state == stateLoading {
 			var cmd tea.Cmd
@@ -233,6 +342,27 @@ func (m model) handleChoice() (tea.Model, tea.Cmd) {
 	selected := m.menuItems[m.cursor]
 
 	switch selected.action {
+	case ActionInspect:
+		// Swap in the safer command, the user still picks what to do with it
+		alt := *m.parsed
+		alt.Command = m.verdict.Alternative
+		if m.isZH {
+			alt.Explanation = "先把脚本下载到临时文件并用分页器展示，确认后才会运行。"
+		} else {
+			alt.Explanation = "Downloads the script to a temporary file and shows it in a pager first; it only runs once you confirm."
+		}
+		m.parsed = &alt
+		m.verdict = guard.Check(alt.Command)
+		m.menuItems = m.buildMenu(alt.Command, m.verdict)
+		m.cursor = 0
+		m.preview = nil
+		return m, nil
+	case ActionPreview:
+		// The preview is shown above the menu, the user still has to pick an action
+		m.preview = executor.PreviewCommand(m.parsed.Command, m.ctx)
+		m.menuItems = append(m.menuItems[:m.cursor:m.cursor], m.menuItems[m.cursor+1:]...)
+		m.cursor = 0
+		return m, nil
 	case ActionInject:
 		err := executor.InjectToTerminal(m.parsed.Command)
 		if err != nil {
@@ -254,6 +384,12 @@ func (m model) handleChoice() (tea.Model, tea.Cmd) {
 		} else {
 			m.exitMsg = fmt.Sprintf("\n🚀 Executing command: %s", m.parsed.Command)
 		}
+	case ActionSandbox:
+		if m.isZH {
+			m.exitMsg = fmt.Sprintf("\n🧪 正在沙箱中执行: %s", m.parsed.Command)
+		} else {
+			m.exitMsg = fmt.Sprintf("\n🧪 Executing in sandbox: %s", m.parsed.Command)
+		}
 	case ActionCopy:
 		err := executor.CopyToClipboard(m.parsed.Command)
 		if err != nil {
@@ -286,6 +422,10 @@ func (m model) View() string {
 		return ""
 	}
 
+	if m.opts.Inline {
+		return m.inlineView()
+	}
+
 	switch m.state {
 	case stateError:
 		if m.isZH {
@@ -308,21 +448,14 @@ func (m model) View() string {
 	case stateResult:
 		var sb strings.Builder
 
-		sb.WriteString("\n")
-		if m.isZH {
-			sb.WriteString(TitleStyle.Render("💻 命令 (Command): ") + TargetStyle.Render(m.parsed.Command) + "\n")
-			sb.WriteString(TitleStyle.Render("🐆 解释 (Explanation): ") + ExplanationStyle.Render(m.parsed.Explanation) + "\n\n")
-		} else {
-			sb.WriteString(TitleStyle.Render("💻 Command: ") + TargetStyle.Render(m.parsed.Command) + "\n")
-			sb.WriteString(TitleStyle.Render("🐆 Explanation: ") + ExplanationStyle.Render(m.parsed.Explanation) + "\n\n")
+		sb.WriteString("\n" + m.resultHeader())
+
+		if m.preview != nil {
+			sb.WriteString(renderPreview(m.preview, m.isZH) + "\n")
 		}
 
-		if m.safetyLvl == guard.Danger {
-			if m.isZH {
-				sb.WriteString(DangerStyle.Render("⚠️ 警告：豹米花察觉到极度危险的操作，请谨慎行事！") + "\n\n")
-			} else {
-				sb.WriteString(DangerStyle.Render("⚠️ Warning: BaoMiHua detected an extremely dangerous operation, proceed with caution!") + "\n\n")
-			}
+		if m.note != "" {
+			sb.WriteString(ExplanationStyle.Render(m.note) + "\n\n")
 		}
 
 		if m.isZH {
@@ -348,46 +481,87 @@ func (m model) View() string {
 	return ""
 }
 
-// RunUI is the entry point to start the BubbleTea program
-func RunUI(prompt string) (*llm.Result, Action, string, error) {
-	p := tea.NewProgram(InitialModel(prompt))
+// resultHeader renders the command with the part the guard objects to highlighted,
+// its explanation and the guard's reason
+func (m model) resultHeader() string {
+	var sb strings.Builder
+	if m.isZH {
+		sb.WriteString(TitleStyle.Render("💻 命令 (Command): ") + highlightCommand(m.parsed.Command, m.verdict) + "\n")
+		sb.WriteString(TitleStyle.Render("🐆 解释 (Explanation): ") + ExplanationStyle.Render(m.parsed.Explanation) + "\n\n")
+	} else {
+		sb.WriteString(TitleStyle.Render("💻 Command: ") + highlightCommand(m.parsed.Command, m.verdict) + "\n")
+		sb.WriteString(TitleStyle.Render("🐆 Explanation: ") + ExplanationStyle.Render(m.parsed.Explanation) + "\n\n")
+	}
+	if note := verdictNote(m.verdict, m.isZH); note != "" {
+		sb.WriteString(note + "\n\n")
+	}
+	return sb.String()
+}
+
+// inlineView renders the compact layout used by the shell hotkey widget, which
+// draws right below the prompt line and has to stay out of the way
+func (m model) inlineView() string {
+	switch m.state {
+	case stateError:
+		return DangerStyle.Render(fmt.Sprintf("❌ %v", m.err)) + "\n"
+	case stateLoading:
+		modelStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("86")).Render("[" + config.GetModel() + "]")
+		return fmt.Sprintf(" %s 🐆 %s %s\n", m.spinner.View(), modelStyle, ExplanationStyle.Render(m.prompt))
+	case stateResult:
+		var sb strings.Builder
+		sb.WriteString(TitleStyle.Render("💻 ") + highlightCommand(m.parsed.Command, m.verdict) + "\n")
+		sb.WriteString("   " + ExplanationStyle.Render(m.parsed.Explanation) + "\n")
+		if note := verdictNote(m.verdict, m.isZH); note != "" {
+			sb.WriteString(note + "\n")
+		}
+		for i, item := range m.menuItems {
+			label := fmt.Sprintf("%d. %s", i+1, item.label)
+			if m.cursor == i {
+				sb.WriteString(SelectedItemStyle.UnsetPaddingLeft().Render("> " + label))
+			} else {
+				sb.WriteString(lipgloss.NewStyle().PaddingLeft(2).Render(label))
+			}
+			sb.WriteString("  ")
+		}
+		return sb.String() + "\n"
+	}
+	return ""
+}
+
+// RunUI is the entry point to start the BubbleTea program. It also returns the
+// verdict the menu was built from, including the model's review, so a sandbox
+// run can offer the same actions.
+func RunUI(prompt string, ctx llm.EnvContext, opts Options) (*llm.Result, guard.Verdict, Action, string, error) {
+	p := tea.NewProgram(InitialModel(prompt, ctx, opts), programOptions()...)
 	m, err := p.Run()
 	if err != nil {
-		return nil, ActionCancel, "", err
+		return nil, guard.Verdict{}, ActionCancel, "", err
 	}
 
 	finalModel := m.(model)
 	if finalModel.state != stateResult {
 		if finalModel.err != nil {
-			return nil, ActionCancel, "", finalModel.err
+			return nil, guard.Verdict{}, ActionCancel, "", finalModel.err
 		}
-		return nil, ActionCancel, "", nil
+		return nil, guard.Verdict{}, ActionCancel, "", nil
 	}
 
 	if finalModel.cursor < len(finalModel.menuItems) {
 		selected := finalModel.menuItems[finalModel.cursor]
 
+		// The hotkey widget redraws the prompt line itself, so nothing is echoed
+		if opts.Inline {
+			return finalModel.parsed, finalModel.verdict, selected.action, "", nil
+		}
+
 		var sb strings.Builder
 		if finalModel.parsed != nil {
-			sb.WriteString("\n")
-			if finalModel.isZH {
-				sb.WriteString(TitleStyle.Render("💻 命令 (Command): ") + TargetStyle.Render(finalModel.parsed.Command) + "\n")
-				sb.WriteString(TitleStyle.Render("🐆 解释 (Explanation): ") + ExplanationStyle.Render(finalModel.parsed.Explanation) + "\n\n")
-				if finalModel.safetyLvl == guard.Danger {
-					sb.WriteString(DangerStyle.Render("⚠️ 警告：豹米花察觉到极度危险的操作，请谨慎行事！") + "\n\n")
-				}
-			} else {
-				sb.WriteString(TitleStyle.Render("💻 Command: ") + TargetStyle.Render(finalModel.parsed.Command) + "\n")
-				sb.WriteString(TitleStyle.Render("🐆 Explanation: ") + ExplanationStyle.Render(finalModel.parsed.Explanation) + "\n\n")
-				if finalModel.safetyLvl == guard.Danger {
-					sb.WriteString(DangerStyle.Render("⚠️ Warning: BaoMiHua detected an extremely dangerous operation, proceed with caution!") + "\n\n")
-				}
-			}
+			sb.WriteString("\n" + finalModel.resultHeader())
 		}
 		sb.WriteString(finalModel.exitMsg + "\n")
 
-		return finalModel.parsed, selected.action, sb.String(), nil
+		return finalModel.parsed, finalModel.verdict, selected.action, sb.String(), nil
 	}
 
-	return finalModel.parsed, ActionCancel, "", nil
+	return finalModel.parsed, finalModel.verdict, ActionCancel, "", nil
 }
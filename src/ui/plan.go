@@ -0,0 +1,470 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"baomihua/config"
+	"baomihua/executor"
+	"baomihua/guard"
+	"baomihua/llm"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type stepStatus int
+
+const (
+	stepPending stepStatus = iota
+	stepRunning
+	stepDone
+	stepFailed
+	stepSkipped
+)
+
+// planStep is a step of the plan together with its guard verdict and progress
+type planStep struct {
+	llm.PlanStep
+	verdict  guard.Verdict
+	reviewed bool // false while the review model hasn't rated an edited command yet
+	status   stepStatus
+	exitCode int
+}
+
+type planModel struct {
+	prompt   string
+	isZH     bool
+	ctx      llm.EnvContext
+	state    state
+	err      error
+	spinner  spinner.Model
+	summary  string
+	steps    []planStep
+	current  int
+	editing  bool
+	input    textinput.Model
+	note     string // Shown below the steps, e.g. why a step can't run
+	aborted  bool
+	exitCode int // Exit code of the step that stopped the plan
+}
+
+type planMsg struct {
+	plan     *llm.Plan
+	verdicts []guard.Verdict
+	note     string
+}
+
+// stepReviewedMsg carries the review of a step's edited command
+type stepReviewedMsg struct {
+	index   int
+	command string
+	verdict guard.Verdict
+	err     error
+}
+
+type stepFinishedMsg struct{ err error }
+
+var (
+	mutedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	currentStyle = lipgloss.NewStyle().Foreground(catOrange).Bold(true)
+)
+
+func initialPlanModel(prompt string, ctx llm.EnvContext) planModel {
+	s := spinner.New()
+	s.Spinner = spinner.Line
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	ti := textinput.New()
+	ti.CharLimit = 1024
+	ti.Width = 80
+	ti.Prompt = "✏️  "
+	ti.PromptStyle = PromptSelectedStyle
+	ti.Cursor.Style = PromptCursorStyle
+
+	return planModel{
+		prompt:  prompt,
+		isZH:    IsChinese(prompt),
+		ctx:     ctx,
+		state:   stateLoading,
+		spinner: s,
+		input:   ti,
+	}
+}
+
+func (m planModel) Init() tea.Cmd {
+	return tea.Batch(
+		m.spinner.Tick,
+		func() tea.Msg {
+			plan, err := llm.GeneratePlan(m.prompt, m.ctx)
+			if err != nil {
+				return errMsg{err: err}
+			}
+			return m.reviewPlan(plan)
+		},
+	)
+}
+
+func (m planModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.state != stateResult {
+			if msg.String() == "ctrl+c" || msg.String() == "q" || msg.String() == "esc" {
+				m.aborted = true
+				m.state = stateDone
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		if m.editing {
+			return m.updateEditing(msg)
+		}
+		if m.steps[m.current].status == stepRunning {
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "ctrl+c", "q", "esc", "a":
+			m.aborted = true
+			m.state = stateDone
+			return m, tea.Quit
+		case "enter", "r":
+			step := &m.steps[m.current]
+			if !step.reviewed {
+				if m.isZH {
+					m.note = "⏳ 正在等待模型复核编辑后的命令..."
+				} else {
+					m.note = "⏳ Waiting for the model review of the edited command..."
+				}
+				return m, nil
+			}
+			if step.verdict.Level >= guard.Danger {
+				if m.isZH {
+					m.note = "⚠️ 该步骤被判定为危险操作，不能直接执行。请编辑 (e) 或跳过 (s)。"
+				} else {
+					m.note = "⚠️ This step was flagged as dangerous and can't be run from the plan. Edit (e) or skip (s) it."
+				}
+				return m, nil
+			}
+			m.note = ""
+			step.status = stepRunning
+			return m, tea.ExecProcess(executor.Command(step.Command, m.ctx), func(err error) tea.Msg {
+				return stepFinishedMsg{err: err}
+			})
+		case "s":
+			m.note = ""
+			m.steps[m.current].status = stepSkipped
+			return m.advance()
+		case "e":
+			m.note = ""
+			m.editing = true
+			m.input.SetValue(m.steps[m.current].Command)
+			m.input.CursorEnd()
+			return m, tea.Batch(m.input.Focus(), textinput.Blink)
+		}
+
+	case errMsg:
+		m.err = msg.err
+		m.state = stateError
+		return m, tea.Quit
+
+	case planMsg:
+		m.summary = msg.plan.Summary
+		for i, step := range msg.plan.Steps {
+			m.steps = append(m.steps, planStep{PlanStep: step, verdict: msg.verdicts[i], reviewed: true})
+		}
+		m.note = msg.note
+		m.state = stateResult
+
+	case stepReviewedMsg:
+		step := &m.steps[msg.index]
+		if step.Command != msg.command {
+			// Edited again in the meantime, that review is still running
+			return m, nil
+		}
+		step.verdict = msg.verdict
+		step.reviewed = true
+		m.note = ""
+		if msg.err != nil {
+			m.note = m.reviewFailedNote(msg.err)
+		}
+
+	case stepFinishedMsg:
+		step := &m.steps[m.current]
+		step.exitCode = executor.ExitCode(msg.err)
+		if step.exitCode != 0 {
+			step.status = stepFailed
+			m.exitCode = step.exitCode
+			m.state = stateDone
+			return m, tea.Quit
+		}
+		step.status = stepDone
+		return m.advance()
+
+	case spinner.TickMsg:
+		if m.state == stateLoading {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
+	default:
+		if m.editing {
+			var cmd tea.Cmd
+			m.input, cmd = m.input.Update(msg)
+			return m, cmd
+		}
+	}
+
+	return m, nil
+}
+
+// updateEditing handles keys while the current step's command is being edited.
+// The edited command is checked by the guard again before it can run, and
+// reviewed by the model again when guard.review is "model".
+func (m planModel) updateEditing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC, tea.KeyEsc:
+		m.editing = false
+		m.input.Blur()
+		return m, nil
+	case tea.KeyEnter:
+		m.editing = false
+		m.input.Blur()
+		if command := strings.TrimSpace(m.input.Value()); command != "" {
+			step := &m.steps[m.current]
+			step.Command = command
+			step.verdict = guard.Check(command)
+			if llm.ReviewEnabled() && step.verdict.Level != guard.Blocked {
+				step.reviewed = false
+				index, request, ctx := m.current, m.prompt, m.ctx
+				return m, func() tea.Msg {
+					v, err := llm.CheckWithReview(request, command, ctx)
+					return stepReviewedMsg{index: index, command: command, verdict: v, err: err}
+				}
+			}
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// reviewPlan checks the steps of plan with the guard and, when guard.review is
+// "model", has the review model rate them, all steps at once
+func (m planModel) reviewPlan(plan *llm.Plan) planMsg {
+	msg := planMsg{plan: plan, verdicts: make([]guard.Verdict, len(plan.Steps))}
+	errs := make([]error, len(plan.Steps))
+	var wg sync.WaitGroup
+	for i, step := range plan.Steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg.verdicts[i], errs[i] = llm.CheckWithReview(m.prompt, step.Command, m.ctx)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			msg.note = m.reviewFailedNote(err)
+			break
+		}
+	}
+	return msg
+}
+
+func (m planModel) reviewFailedNote(err error) string {
+	if m.isZH {
+		return fmt.Sprintf("⚠️ 模型复核失败，仅使用内置规则: %v", err)
+	}
+	return fmt.Sprintf("⚠️ Model review failed, only the built-in rules apply: %v", err)
+}
+
+// advance moves on to the next step, finishing the plan after the last one
+func (m planModel) advance() (tea.Model, tea.Cmd) {
+	m.current++
+	if m.current >= len(m.steps) {
+		m.current = len(m.steps) - 1
+		m.state = stateDone
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m planModel) View() string {
+	switch m.state {
+	case stateError:
+		if m.isZH {
+			return DangerStyle.Render(fmt.Sprintf("\n❌ 发生错误: %v\n", m.err))
+		}
+		return DangerStyle.Render(fmt.Sprintf("\n❌ Error occurred: %v\n", m.err))
+
+	case stateLoading:
+		modelStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("86")).Render("[" + config.GetModel() + "]")
+		textStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+		if m.isZH {
+			msg := fmt.Sprintf("豹米花 %s 正在规划如何 %q...", modelStyle, m.prompt)
+			return fmt.Sprintf("\n %s %s\n", m.spinner.View(), textStyle.Render(msg))
+		}
+		msg := fmt.Sprintf("BaoMiHua %s is planning how to %q...", modelStyle, m.prompt)
+		return fmt.Sprintf("\n %s %s\n", m.spinner.View(), textStyle.Render(msg))
+	}
+	if len(m.steps) == 0 {
+		// Aborted before the plan arrived
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n")
+	if m.isZH {
+		sb.WriteString(TitleStyle.Render("📋 计划 (Plan): ") + ExplanationStyle.Render(m.summary) + "\n\n")
+	} else {
+		sb.WriteString(TitleStyle.Render("📋 Plan: ") + ExplanationStyle.Render(m.summary) + "\n\n")
+	}
+
+	for i, step := range m.steps {
+		line := fmt.Sprintf("%s %d. %s", stepIcon(step.status), i+1, step.Command)
+		active := m.state == stateResult && i == m.current
+		switch {
+		case active:
+			sb.WriteString(currentStyle.Render(line) + "\n")
+		case step.status == stepFailed:
+			sb.WriteString(DangerStyle.Render(fmt.Sprintf("%s (exit %d)", line, step.exitCode)) + "\n")
+		case step.status == stepSkipped || step.status == stepPending:
+			sb.WriteString(mutedStyle.Render(line) + "\n")
+		default:
+			sb.WriteString(line + "\n")
+		}
+		if !active {
+			continue
+		}
+
+		sb.WriteString("      " + ExplanationStyle.Render(step.Explanation) + "\n")
+		if step.Expected != "" {
+			if m.isZH {
+				sb.WriteString("      " + mutedStyle.Render("预期: "+step.Expected) + "\n")
+			} else {
+				sb.WriteString("      " + mutedStyle.Render("Expected: "+step.Expected) + "\n")
+			}
+		}
+		if note := verdictNote(step.verdict, m.isZH); note != "" {
+			sb.WriteString("      " + note + "\n")
+		}
+	}
+	sb.WriteString("\n")
+
+	if m.state == stateDone {
+		sb.WriteString(m.outcome() + "\n")
+		return sb.String()
+	}
+
+	if m.note != "" {
+		sb.WriteString(ExplanationStyle.Render(m.note) + "\n\n")
+	}
+
+	switch {
+	case m.editing:
+		sb.WriteString(m.input.View() + "\n")
+		if m.isZH {
+			sb.WriteString(mutedStyle.Render("[enter] 确认  [esc] 取消编辑") + "\n")
+		} else {
+			sb.WriteString(mutedStyle.Render("[enter] confirm  [esc] cancel editing") + "\n")
+		}
+	case m.steps[m.current].status == stepRunning:
+		if m.isZH {
+			sb.WriteString(mutedStyle.Render("🚀 正在执行...") + "\n")
+		} else {
+			sb.WriteString(mutedStyle.Render("🚀 Running...") + "\n")
+		}
+	default:
+		if m.isZH {
+			sb.WriteString(mutedStyle.Render("[enter] 执行  [s] 跳过  [e] 编辑  [a] 中止") + "\n")
+		} else {
+			sb.WriteString(mutedStyle.Render("[enter] run  [s] skip  [e] edit  [a] abort") + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// outcome summarizes how the plan ended
+func (m planModel) outcome() string {
+	switch {
+	case m.exitCode != 0:
+		if m.isZH {
+			return DangerStyle.Render(fmt.Sprintf("❌ 第 %d 步失败 (退出码 %d)，计划已停止", m.current+1, m.exitCode))
+		}
+		return DangerStyle.Render(fmt.Sprintf("❌ Step %d failed with exit code %d, plan stopped", m.current+1, m.exitCode))
+	case m.aborted:
+		if m.isZH {
+			return "🛑 计划已中止"
+		}
+		return "🛑 Plan aborted"
+	default:
+		if m.isZH {
+			return "✅ 计划已完成!"
+		}
+		return "✅ Plan finished!"
+	}
+}
+
+func stepIcon(status stepStatus) string {
+	switch status {
+	case stepRunning:
+		return "🚀"
+	case stepDone:
+		return "✅"
+	case stepFailed:
+		return "❌"
+	case stepSkipped:
+		return "⏭️ "
+	}
+	return "▫️ "
+}
+
+// PlanStepResult is a step of a finished plan, as it was last shown, and what
+// became of it
+type PlanStepResult struct {
+	llm.PlanStep
+	Verdict  guard.Verdict
+	Action   Action // ActionExecute, ActionSkip or ActionCancel for the steps the plan didn't get to
+	ExitCode *int   // Only set when the step ran
+}
+
+// results reports what became of each step of the plan
+func (m planModel) results() []PlanStepResult {
+	results := make([]PlanStepResult, 0, len(m.steps))
+	for _, step := range m.steps {
+		r := PlanStepResult{PlanStep: step.PlanStep, Verdict: step.verdict, Action: ActionCancel}
+		switch step.status {
+		case stepDone, stepFailed:
+			r.Action = ActionExecute
+			r.ExitCode = &step.exitCode
+		case stepSkipped:
+			r.Action = ActionSkip
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// RunPlanUI asks the model for a multi-step plan and walks the user through it
+// step by step. It returns what became of each step and the exit code of the
+// step that failed, or 0.
+func RunPlanUI(prompt string, ctx llm.EnvContext) ([]PlanStepResult, int, error) {
+	p := tea.NewProgram(initialPlanModel(prompt, ctx), programOptions()...)
+	m, err := p.Run()
+	if err != nil {
+		return nil, 1, err
+	}
+
+	finalModel := m.(planModel)
+	if finalModel.state == stateError {
+		return nil, 1, finalModel.err
+	}
+	return finalModel.results(), finalModel.exitCode, nil
+}
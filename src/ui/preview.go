@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"baomihua/executor"
+)
+
+// previewMaxPaths is how many affected paths are listed per operation
+const previewMaxPaths = 8
+
+// renderPreview formats the dry-run result of the Preview action
+func renderPreview(p *executor.Preview, isZH bool) string {
+	var sb strings.Builder
+
+	if isZH {
+		sb.WriteString(TitleStyle.Render("🔍 预览 (Preview，基于当前文件系统):") + "\n")
+	} else {
+		sb.WriteString(TitleStyle.Render("🔍 Preview (based on the current filesystem):") + "\n")
+	}
+
+	for _, e := range p.Entries {
+		var counts string
+		if isZH {
+			counts = fmt.Sprintf("%d 个路径, %d 个文件, %d 个目录, 共 %s", len(e.Paths), e.Files, e.Dirs, formatBytes(e.Bytes))
+		} else {
+			counts = fmt.Sprintf("%d paths, %d files, %d dirs, %s total", len(e.Paths), e.Files, e.Dirs, formatBytes(e.Bytes))
+		}
+		sb.WriteString("  " + TargetStyle.Render(e.Operation) + "  " + ExplanationStyle.Render(counts) + "\n")
+
+		for i, path := range e.Paths {
+			if i == previewMaxPaths {
+				if isZH {
+					sb.WriteString(mutedStyle.Render(fmt.Sprintf("    ... 以及另外 %d 个", len(e.Paths)-previewMaxPaths)) + "\n")
+				} else {
+					sb.WriteString(mutedStyle.Render(fmt.Sprintf("    ... and %d more", len(e.Paths)-previewMaxPaths)) + "\n")
+				}
+				break
+			}
+			sb.WriteString("    " + path + "\n")
+		}
+		for _, path := range e.Missing {
+			if isZH {
+				sb.WriteString(mutedStyle.Render("    (不存在) "+path) + "\n")
+			} else {
+				sb.WriteString(mutedStyle.Render("    (not found) "+path) + "\n")
+			}
+		}
+		for _, note := range e.Notes {
+			sb.WriteString(ExplanationStyle.Render("    ℹ️ "+note) + "\n")
+		}
+	}
+
+	if p.Truncated {
+		if isZH {
+			sb.WriteString(ExplanationStyle.Render("  ℹ️ 文件过多，已停止统计，以上数量为下限") + "\n")
+		} else {
+			sb.WriteString(ExplanationStyle.Render("  ℹ️ Too many files, counting stopped early: the numbers above are lower bounds") + "\n")
+		}
+	}
+	for _, reason := range p.Unsupported {
+		if isZH {
+			sb.WriteString(DangerStyle.Render("  ⚠️ 无法预览: "+reason) + "\n")
+		} else {
+			sb.WriteString(DangerStyle.Render("  ⚠️ Not previewed: "+reason) + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// formatBytes renders a size with a binary unit, e.g. "4.2 MiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
 )
 
 var (
@@ -271,7 +272,7 @@ func (m promptModel) View() string {
 
 // RunPromptUI displays an interactive prompt text box
 func RunPromptUI() (string, error) {
-	p := tea.NewProgram(InitialPromptModel())
+	p := tea.NewProgram(InitialPromptModel(), programOptions()...)
 	m, err := p.Run()
 	if err != nil {
 		return "", err
@@ -284,3 +285,12 @@ func RunPromptUI() (string, error) {
 
 	return "", nil
 }
+
+// programOptions reopens the terminal for keyboard input when stdin is a pipe,
+// e.g. 'kubectl get pods | bmh ...', since the piped data has already been consumed
+func programOptions() []tea.ProgramOption {
+	if isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	return []tea.ProgramOption{tea.WithInputTTY()}
+}
@@ -0,0 +1,221 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"baomihua/executor"
+	"baomihua/guard"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sandboxMaxChanges is how many changed paths are listed
+const sandboxMaxChanges = 15
+
+type sandboxModel struct {
+	res       *executor.SandboxResult
+	isZH      bool
+	verdict   guard.Verdict
+	menuItems []menuItem
+	cursor    int
+	exitMsg   string
+	isDone    bool
+}
+
+func initialSandboxModel(prompt string, res *executor.SandboxResult, verdict guard.Verdict) sandboxModel {
+	m := sandboxModel{
+		res:     res,
+		isZH:    IsChinese(prompt),
+		verdict: verdict,
+	}
+
+	// Applying for real goes through the same guard rules as the Execute action
+	if m.verdict.Level < guard.Danger {
+		if m.isZH {
+			m.menuItems = append(m.menuItems, menuItem{label: "✅ 真实执行 (Apply for real)", action: ActionExecute})
+		} else {
+			m.menuItems = append(m.menuItems, menuItem{label: "✅ Apply for real", action: ActionExecute})
+		}
+	}
+	if m.verdict.Level != guard.Blocked {
+		if m.isZH {
+			m.menuItems = append(m.menuItems, menuItem{label: "🐾 插入终端 (Insert to prompt)", action: ActionInject})
+		} else {
+			m.menuItems = append(m.menuItems, menuItem{label: "🐾 Insert to prompt", action: ActionInject})
+		}
+	}
+	if m.isZH {
+		m.menuItems = append(m.menuItems, menuItem{label: "🗑️ 丢弃 (Discard)", action: ActionCancel})
+	} else {
+		m.menuItems = append(m.menuItems, menuItem{label: "🗑️ Discard", action: ActionCancel})
+	}
+	return m
+}
+
+func (m sandboxModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m sandboxModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.cursor = len(m.menuItems) - 1
+			return m.handleChoice()
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j", "tab":
+			if m.cursor < len(m.menuItems)-1 {
+				m.cursor++
+			}
+		case "enter", " ":
+			return m.handleChoice()
+		case "1", "2", "3":
+			idx := int(msg.String()[0] - '1')
+			if idx < len(m.menuItems) {
+				m.cursor = idx
+				return m.handleChoice()
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m sandboxModel) handleChoice() (tea.Model, tea.Cmd) {
+	switch m.menuItems[m.cursor].action {
+	case ActionExecute:
+		if m.isZH {
+			m.exitMsg = fmt.Sprintf("\n🚀 正在真实执行命令: %s", m.res.Command)
+		} else {
+			m.exitMsg = fmt.Sprintf("\n🚀 Applying for real: %s", m.res.Command)
+		}
+	case ActionInject:
+		if err := executor.InjectToTerminal(m.res.Command); err != nil {
+			if m.isZH {
+				m.exitMsg = fmt.Sprintf("\n❌ 插入失败: %v", err)
+			} else {
+				m.exitMsg = fmt.Sprintf("\n❌ Injection failed: %v", err)
+			}
+		} else if m.isZH {
+			m.exitMsg = "\n✅ 已写入终端! (请按回车执行)"
+		} else {
+			m.exitMsg = "\n✅ Injected into terminal! (Press Enter to execute)"
+		}
+	case ActionCancel:
+		if m.isZH {
+			m.exitMsg = "\n🗑️ 已丢弃沙箱中的改动"
+		} else {
+			m.exitMsg = "\n🗑️ Sandbox changes discarded"
+		}
+	}
+	m.isDone = true
+	return m, tea.Quit
+}
+
+func (m sandboxModel) View() string {
+	var sb strings.Builder
+	sb.WriteString("\n" + m.summary())
+
+	if m.isDone {
+		return sb.String()
+	}
+
+	if note := verdictNote(m.verdict, m.isZH); note != "" {
+		sb.WriteString(note + "\n")
+	}
+
+	if m.isZH {
+		sb.WriteString("\n请选择下一步动作:\n")
+	} else {
+		sb.WriteString("\nSelect next action:\n")
+	}
+	for i, item := range m.menuItems {
+		cursor := "  "
+		style := ItemStyle
+		if m.cursor == i {
+			cursor = "> "
+			style = SelectedItemStyle
+		}
+		sb.WriteString(style.Render(fmt.Sprintf("%s%d. %s", cursor, i+1, item.label)) + "\n")
+	}
+	return sb.String()
+}
+
+// summary renders the exit code and the diff of the sandbox run
+func (m sandboxModel) summary() string {
+	var sb strings.Builder
+	res := m.res
+
+	network := "off"
+	if res.Network {
+		network = "on"
+	}
+	if m.isZH {
+		sb.WriteString(TitleStyle.Render("🧪 沙箱结果: ") + ExplanationStyle.Render(fmt.Sprintf("退出码 %d, 网络 %s, %s", res.ExitCode, network, res.Backend)) + "\n")
+	} else {
+		sb.WriteString(TitleStyle.Render("🧪 Sandbox result: ") + ExplanationStyle.Render(fmt.Sprintf("exit code %d, network %s, %s", res.ExitCode, network, res.Backend)) + "\n")
+	}
+
+	if len(res.Changes) == 0 {
+		if m.isZH {
+			sb.WriteString(mutedStyle.Render("  工作目录没有任何改动") + "\n")
+		} else {
+			sb.WriteString(mutedStyle.Render("  No files in the working directory changed") + "\n")
+		}
+		return sb.String()
+	}
+
+	var created, modified, deleted int
+	for _, c := range res.Changes {
+		switch c.Kind {
+		case executor.ChangeCreated:
+			created++
+		case executor.ChangeModified:
+			modified++
+		case executor.ChangeDeleted:
+			deleted++
+		}
+	}
+	if m.isZH {
+		sb.WriteString(ExplanationStyle.Render(fmt.Sprintf("  新建 %d, 修改 %d, 删除 %d", created, modified, deleted)) + "\n")
+	} else {
+		sb.WriteString(ExplanationStyle.Render(fmt.Sprintf("  %d created, %d modified, %d deleted", created, modified, deleted)) + "\n")
+	}
+
+	for i, c := range res.Changes {
+		if i == sandboxMaxChanges {
+			if m.isZH {
+				sb.WriteString(mutedStyle.Render(fmt.Sprintf("    ... 以及另外 %d 项", len(res.Changes)-sandboxMaxChanges)) + "\n")
+			} else {
+				sb.WriteString(mutedStyle.Render(fmt.Sprintf("    ... and %d more", len(res.Changes)-sandboxMaxChanges)) + "\n")
+			}
+			break
+		}
+		switch c.Kind {
+		case executor.ChangeCreated:
+			sb.WriteString(TargetStyle.Render("    + "+c.Path) + mutedStyle.Render(" ("+formatBytes(c.NewSize)+")") + "\n")
+		case executor.ChangeModified:
+			sb.WriteString(TitleStyle.Render("    ~ "+c.Path) + mutedStyle.Render(fmt.Sprintf(" (%s → %s)", formatBytes(c.OldSize), formatBytes(c.NewSize))) + "\n")
+		case executor.ChangeDeleted:
+			sb.WriteString(DangerStyle.Render("    - "+c.Path) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// RunSandboxUI shows what a sandboxed run changed and lets the user apply the
+// command for real, insert it into the prompt or discard it. verdict is the one
+// the command got before the sandbox run, including the model's review.
+func RunSandboxUI(prompt string, res *executor.SandboxResult, verdict guard.Verdict) (Action, string, error) {
+	p := tea.NewProgram(initialSandboxModel(prompt, res, verdict), programOptions()...)
+	m, err := p.Run()
+	if err != nil {
+		return ActionCancel, "", err
+	}
+
+	finalModel := m.(sandboxModel)
+	return finalModel.menuItems[finalModel.cursor].action, finalModel.exitMsg + "\n", nil
+}
@@ -4,10 +4,11 @@ import "github.com/charmbracelet/lipgloss"
 
 var (
 	// Colors
-	catOrange = lipgloss.Color("#FF9D00")
-	catBrown  = lipgloss.Color("#8B5A2B")
-	dangerRed = lipgloss.Color("#FF0000")
-	highlight = lipgloss.Color("#00FF00")
+	catOrange     = lipgloss.Color("#FF9D00")
+	catBrown      = lipgloss.Color("#8B5A2B")
+	dangerRed     = lipgloss.Color("#FF0000")
+	cautionYellow = lipgloss.Color("#FFD700")
+	highlight     = lipgloss.Color("#00FF00")
 
 	// Styles
 	TitleStyle = lipgloss.NewStyle().
@@ -25,6 +26,10 @@ var (
 			Foreground(dangerRed).
 			Bold(true)
 
+	CautionStyle = lipgloss.NewStyle().
+			Foreground(cautionYellow).
+			Bold(true)
+
 	ItemStyle = lipgloss.NewStyle().
 			PaddingLeft(4)
 
@@ -0,0 +1,129 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"baomihua/guard"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// levelStyle is the color a guard level is shown in
+func levelStyle(lvl guard.Level) lipgloss.Style {
+	if lvl == guard.Caution {
+		return CautionStyle
+	}
+	return DangerStyle
+}
+
+// highlightCommand renders the command with the part the verdict points at
+// underlined in the color of its level
+func highlightCommand(command string, v guard.Verdict) string {
+	span := v.Span
+	if v.Level == guard.Safe || span.Start < 0 || span.End > len(command) || span.Start >= span.End {
+		return TargetStyle.Render(command)
+	}
+	return TargetStyle.Render(command[:span.Start]) +
+		levelStyle(v.Level).Underline(true).Render(command[span.Start:span.End]) +
+		TargetStyle.Render(command[span.End:])
+}
+
+// verdictNote explains a verdict and what it restricts, followed by the model's
+// review if there was one. It is empty for Safe commands that weren't reviewed.
+func verdictNote(v guard.Verdict, isZH bool) string {
+	note := levelNote(v, isZH)
+	if v.Review == nil {
+		return note
+	}
+	if note != "" {
+		note += "\n"
+	}
+	return note + reviewNote(v, isZH)
+}
+
+// reviewNote shows what the review model thought of the command
+func reviewNote(v guard.Verdict, isZH bool) string {
+	r := v.Review
+	risk := map[guard.Level]string{guard.Safe: "low", guard.Caution: "medium", guard.Danger: "high"}[r.Level]
+	reversible := "reversible"
+	if !r.Reversible {
+		reversible = "irreversible"
+	}
+	if isZH {
+		risk = map[guard.Level]string{guard.Safe: "低", guard.Caution: "中", guard.Danger: "高"}[r.Level]
+		reversible = "可撤销"
+		if !r.Reversible {
+			reversible = "不可撤销"
+		}
+	}
+
+	var text string
+	if isZH {
+		text = fmt.Sprintf("🤖 模型复核 (%s)：%s风险，%s", r.By, risk, reversible)
+	} else {
+		text = fmt.Sprintf("🤖 Model review (%s): %s risk, %s", r.By, risk, reversible)
+	}
+	// A decisive review's rationale is already the reason
+	if v.RuleID != "model-review" && r.Rationale != "" {
+		text += " · " + r.Rationale
+	}
+	return ExplanationStyle.Render(text)
+}
+
+// levelNote explains a verdict and what it restricts, or is empty for Safe commands
+func levelNote(v guard.Verdict, isZH bool) string {
+	var text string
+	switch v.Level {
+	case guard.Safe:
+		return ""
+	case guard.Caution:
+		if isZH {
+			text = fmt.Sprintf("⚠️ 注意：%s [%s]", v.Reason, v.RuleID)
+		} else {
+			text = fmt.Sprintf("⚠️ Caution: %s [%s]", v.Reason, v.RuleID)
+		}
+	case guard.Danger:
+		if isZH {
+			text = fmt.Sprintf("⚠️ 危险：%s [%s]，不提供直接执行", v.Reason, v.RuleID)
+		} else {
+			text = fmt.Sprintf("⚠️ Danger: %s [%s], it can't be executed from here", v.Reason, v.RuleID)
+		}
+	default:
+		if isZH {
+			text = fmt.Sprintf("⛔ 已拦截：%s [%s]，只能复制", v.Reason, v.RuleID)
+		} else {
+			text = fmt.Sprintf("⛔ Blocked: %s [%s], it can only be copied", v.Reason, v.RuleID)
+		}
+	}
+	if v.Detail != "" {
+		label := "Target"
+		switch {
+		case v.RuleID == "download-exec" && isZH:
+			label = "来源"
+		case v.RuleID == "download-exec":
+			label = "Source"
+		case (v.RuleID == "decode-exec" || v.RuleID == "encoded-command") && isZH:
+			label = "解码内容"
+		case v.RuleID == "decode-exec" || v.RuleID == "encoded-command":
+			label = "Payload"
+		case strings.HasPrefix(v.RuleID, "exfil-") && isZH:
+			label = "数据流向"
+		case strings.HasPrefix(v.RuleID, "exfil-"):
+			label = "Data flow"
+		case isZH:
+			label = "目标"
+		}
+		text += fmt.Sprintf("\n   ↳ %s: %s", label, oneLine(v.Detail, 160))
+	}
+	return levelStyle(v.Level).Render(text)
+}
+
+// oneLine shows text such as a decoded script on a single line, cut to max runes
+func oneLine(text string, max int) string {
+	text = strings.Join(strings.Fields(strings.ReplaceAll(text, "\n", " ⏎ ")), " ")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max]) + "…"
+	}
+	return text
+}